@@ -0,0 +1,190 @@
+package cloudsync
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// ChangeDetection strategy used by Scanner to decide if a file was modified compared to its stored Object.
+type ChangeDetection string
+
+const (
+	// ChangeDetectionModTime relies on BlobStorage.CheckMod, which compares file size and modification time
+	// against the stored Object.
+	ChangeDetectionModTime ChangeDetection = "mtime"
+	// ChangeDetectionSize compares file size against the stored Object size only.
+	ChangeDetectionSize ChangeDetection = "size"
+	// ChangeDetectionChecksum compares a file checksum calculated locally against the stored Object checksum.
+	// Every file is read entirely on each scan.
+	ChangeDetectionChecksum ChangeDetection = "checksum"
+	// ChangeDetectionModTimeChecksum calculates checksums only for files reported as modified by
+	// ChangeDetectionModTime, avoiding uploads of files whose modification time changed but their data did not.
+	ChangeDetectionModTimeChecksum ChangeDetection = "mtime+checksum"
+)
+
+// ChangeReason explains why a file was considered as modified. An empty ChangeReason means the file was not
+// modified.
+type ChangeReason string
+
+const (
+	// ChangeReasonNew no Object was stored using the file key.
+	ChangeReasonNew ChangeReason = "new"
+	// ChangeReasonSize file size differs from the stored Object size.
+	ChangeReasonSize ChangeReason = "size changed"
+	// ChangeReasonModTime file modification time is newer than the stored Object modification time.
+	ChangeReasonModTime ChangeReason = "newer mtime"
+	// ChangeReasonChecksum file checksum differs from the stored Object checksum (or no comparable checksum was
+	// found).
+	ChangeReasonChecksum ChangeReason = "checksum changed"
+	// ChangeReasonModified BlobStorage.CheckMod reported the file as modified with no further details.
+	ChangeReasonModified ChangeReason = "modified"
+)
+
+// validate verifies the change detection mode is known and supported by the given BlobStorage.
+func (c ChangeDetection) validate(store BlobStorage) error {
+	switch c {
+	case ChangeDetectionModTime:
+		return nil
+	case ChangeDetectionSize, ChangeDetectionChecksum, ChangeDetectionModTimeChecksum:
+		if _, ok := store.(BlobStater); !ok {
+			return ErrUnsupportedStorage
+		}
+		return nil
+	default:
+		return ErrInvalidChangeDetection
+	}
+}
+
+// usesChecksums verifies if the change detection mode compares file checksums, which requires them to be stored
+// along uploaded objects (MetadataKeyChecksum).
+func (c ChangeDetection) usesChecksums() bool {
+	return c == ChangeDetectionChecksum || c == ChangeDetectionModTimeChecksum
+}
+
+// detectChange verifies if a file was modified compared to its stored Object using ScannerConfig.ChangeDetection.
+// Files with no stored Object are always considered as modified. Returns an empty ChangeReason if the file was not
+// modified.
+func (s *Scanner) detectChange(ctx context.Context, store BlobStorage, job *fileJob) (ChangeReason, error) {
+	switch s.cfg.Scanner.ChangeDetection {
+	case ChangeDetectionSize:
+		info, err := store.(BlobStater).Stat(ctx, job.key)
+		if errors.Is(err, ErrObjectNotFound) {
+			return ChangeReasonNew, nil
+		} else if err != nil {
+			return "", err
+		} else if info.Size != job.info.Size() {
+			return ChangeReasonSize, nil
+		}
+		return "", nil
+	case ChangeDetectionChecksum:
+		return checksumChanged(ctx, store.(BlobStater), job)
+	case ChangeDetectionModTimeChecksum:
+		wasMod, err := store.CheckMod(ctx, job.key, job.info.ModTime(), job.info.Size())
+		if err != nil || !wasMod {
+			return "", err
+		}
+		return checksumChanged(ctx, store.(BlobStater), job)
+	default:
+		wasMod, err := store.CheckMod(ctx, job.key, job.info.ModTime(), job.info.Size())
+		if err != nil || !wasMod {
+			return "", err
+		} else if s.cfg.Scanner.DryRun {
+			return explainChange(ctx, store, *job), nil
+		}
+		return ChangeReasonModified, nil
+	}
+}
+
+// explainChange finds out why BlobStorage.CheckMod reported a file as modified, using BlobStater if available.
+func explainChange(ctx context.Context, store BlobStorage, job fileJob) ChangeReason {
+	stater, ok := store.(BlobStater)
+	if !ok {
+		return ChangeReasonModified
+	}
+	info, err := stater.Stat(ctx, job.key)
+	switch {
+	case errors.Is(err, ErrObjectNotFound):
+		return ChangeReasonNew
+	case err != nil:
+		return ChangeReasonModified
+	case info.Size != job.info.Size():
+		return ChangeReasonSize
+	case job.info.ModTime().After(info.ModTime):
+		return ChangeReasonModTime
+	default:
+		return ChangeReasonModified
+	}
+}
+
+// checksumChanged compares a file checksum against its stored Object checksum. The checksum persisted by Scanner in
+// Object metadata (MetadataKeyChecksum) is preferred over the one calculated by the blob storage.
+//
+// Files are considered as modified if no comparable checksum is available (e.g. multipart objects). SHA-256 digests
+// are stored into the job, so they are reused once the file gets uploaded.
+func checksumChanged(ctx context.Context, store BlobStater, job *fileJob) (ChangeReason, error) {
+	info, err := store.Stat(ctx, job.key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return ChangeReasonNew, nil
+	} else if err != nil {
+		return "", err
+	} else if info.Size != job.info.Size() {
+		return ChangeReasonSize, nil
+	}
+
+	checksum, algorithm := info.Metadata[MetadataKeyChecksum], ChecksumSHA256
+	if checksum == "" {
+		checksum, algorithm = info.Checksum, info.ChecksumAlgorithm
+	}
+	h := newChecksumHash(algorithm)
+	// composite checksums (i.e. checksum of part checksums) use a '-<parts>' suffix
+	if checksum == "" || h == nil || strings.Contains(checksum, "-") {
+		return ChangeReasonChecksum, nil
+	}
+
+	var digest []byte
+	if algorithm == ChecksumSHA256 {
+		digest, err = job.sha256Digest()
+	} else {
+		digest, err = fileDigest(*job, h)
+	}
+	if err != nil {
+		return "", err
+	} else if base64.StdEncoding.EncodeToString(digest) != checksum {
+		return ChangeReasonChecksum, nil
+	}
+	return "", nil
+}
+
+// fileDigest calculates the digest of a job's file data using the given hash.Hash.
+func fileDigest(job fileJob, h hash.Hash) ([]byte, error) {
+	data, closeData, err := job.open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeData()
+	if _, err = io.Copy(h, data); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// newChecksumHash allocates a hash.Hash for the given checksum algorithm. Returns nil if not supported.
+func newChecksumHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New()
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case ChecksumMD5:
+		return md5.New()
+	default:
+		return nil
+	}
+}
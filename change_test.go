@@ -0,0 +1,174 @@
+package cloudsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeDetection_validate(t *testing.T) {
+	assert.NoError(t, ChangeDetectionModTime.validate(storageWithoutStat{}))
+	assert.ErrorIs(t, ChangeDetectionChecksum.validate(storageWithoutStat{}), ErrUnsupportedStorage)
+	assert.NoError(t, ChangeDetectionChecksum.validate(NoopBlobStorage{}))
+	assert.ErrorIs(t, ChangeDetection("foo").validate(NoopBlobStorage{}), ErrInvalidChangeDetection)
+}
+
+// storageWithoutStat BlobStorage implementation without BlobStater capability.
+type storageWithoutStat struct {
+	BlobStorage
+}
+
+func TestScanner_detectChange(t *testing.T) {
+	data, err := os.ReadFile("./testdata/config.yaml")
+	require.NoError(t, err)
+	info, err := os.Stat("./testdata/config.yaml")
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+	job := fileJob{path: "./testdata/config.yaml", key: "config.yaml", info: info}
+	size := info.Size()
+
+	tests := []struct {
+		name  string
+		mode  ChangeDetection
+		dry   bool
+		store NoopBlobStorage
+		exp   ChangeReason
+		err   error
+	}{
+		{
+			name:  "Modification time",
+			mode:  ChangeDetectionModTime,
+			store: NoopBlobStorage{CheckModBool: true},
+			exp:   ChangeReasonModified,
+		},
+		{
+			name:  "Modification time dry run",
+			mode:  ChangeDetectionModTime,
+			dry:   true,
+			store: NoopBlobStorage{CheckModBool: true, StatInfo: ObjectInfo{Size: size}},
+			exp:   ChangeReasonModTime,
+		},
+		{
+			name:  "Modification time dry run not found",
+			mode:  ChangeDetectionModTime,
+			dry:   true,
+			store: NoopBlobStorage{CheckModBool: true, StatErr: ErrObjectNotFound},
+			exp:   ChangeReasonNew,
+		},
+		{
+			name:  "Size not found",
+			mode:  ChangeDetectionSize,
+			store: NoopBlobStorage{StatErr: ErrObjectNotFound},
+			exp:   ChangeReasonNew,
+		},
+		{
+			name:  "Size storage error",
+			mode:  ChangeDetectionSize,
+			store: NoopBlobStorage{StatErr: ErrFatalStorage},
+			err:   ErrFatalStorage,
+		},
+		{
+			name:  "Size not modified",
+			mode:  ChangeDetectionSize,
+			store: NoopBlobStorage{StatInfo: ObjectInfo{Size: size}},
+		},
+		{
+			name:  "Size modified",
+			mode:  ChangeDetectionSize,
+			store: NoopBlobStorage{StatInfo: ObjectInfo{Size: size + 1}},
+			exp:   ChangeReasonSize,
+		},
+		{
+			name:  "Checksum not found",
+			mode:  ChangeDetectionChecksum,
+			store: NoopBlobStorage{StatErr: ErrObjectNotFound},
+			exp:   ChangeReasonNew,
+		},
+		{
+			name: "Checksum from metadata",
+			mode: ChangeDetectionChecksum,
+			store: NoopBlobStorage{StatInfo: ObjectInfo{
+				Size:              size,
+				Checksum:          "foo",
+				ChecksumAlgorithm: ChecksumMD5,
+				Metadata:          map[string]string{MetadataKeyChecksum: checksum},
+			}},
+		},
+		{
+			name: "Checksum from storage",
+			mode: ChangeDetectionChecksum,
+			store: NoopBlobStorage{StatInfo: ObjectInfo{
+				Size:              size,
+				Checksum:          checksum,
+				ChecksumAlgorithm: ChecksumSHA256,
+			}},
+		},
+		{
+			name: "Checksum modified",
+			mode: ChangeDetectionChecksum,
+			store: NoopBlobStorage{StatInfo: ObjectInfo{
+				Size:              size,
+				Checksum:          checksum,
+				ChecksumAlgorithm: ChecksumCRC32C,
+			}},
+			exp: ChangeReasonChecksum,
+		},
+		{
+			name: "Composite checksum",
+			mode: ChangeDetectionChecksum,
+			store: NoopBlobStorage{StatInfo: ObjectInfo{
+				Size:              size,
+				Checksum:          checksum + "-2",
+				ChecksumAlgorithm: ChecksumSHA256,
+			}},
+			exp: ChangeReasonChecksum,
+		},
+		{
+			name: "Unknown checksum algorithm",
+			mode: ChangeDetectionChecksum,
+			store: NoopBlobStorage{StatInfo: ObjectInfo{
+				Size:              size,
+				Checksum:          checksum,
+				ChecksumAlgorithm: "foo",
+			}},
+			exp: ChangeReasonChecksum,
+		},
+		{
+			name: "Modification time and checksum not modified",
+			mode: ChangeDetectionModTimeChecksum,
+			store: NoopBlobStorage{
+				CheckModBool: true,
+				StatInfo:     ObjectInfo{Size: size, Metadata: map[string]string{MetadataKeyChecksum: checksum}},
+			},
+		},
+		{
+			name: "Modification time and checksum error",
+			mode: ChangeDetectionModTimeChecksum,
+			store: NoopBlobStorage{
+				CheckModErr: errors.New("foo error"),
+				StatInfo:    ObjectInfo{Size: size, Metadata: map[string]string{MetadataKeyChecksum: checksum}},
+			},
+			err: errors.New("foo error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := NewScanner(Config{Scanner: ScannerConfig{ChangeDetection: tt.mode, DryRun: tt.dry}})
+			out, err := scanner.detectChange(context.TODO(), tt.store, &job)
+			if tt.err != nil {
+				assert.EqualError(t, err, tt.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.exp, out)
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
-import "github.com/neutrinocorp/cloudsync/cmd"
+import (
+	"os"
+
+	"github.com/neutrinocorp/cloudsync/cmd"
+)
 
 func main() {
-	cmd.Execute()
+	os.Exit(cmd.Execute())
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/spf13/cobra"
+)
+
+// errMissingPartition no partition ID was specified nor configured.
+var errMissingPartition = errors.New("no partition ID was configured, please specify one using --partition")
+
+func init() {
+	restoreCmd.Flags().StringP("path", "p", "", "Destination directory path")
+	restoreCmd.Flags().String("partition", "", "Partition ID to restore objects from (defaults to "+
+		"configuration file scanner.partition_id, required if none was set)")
+	restoreCmd.Flags().String("prefix", "", "Restore only objects whose keys (relative to partition) start "+
+		"with this prefix")
+	restoreCmd.Flags().Int("concurrency", cloudsync.DefaultRestoreConcurrency, "Number of objects downloaded "+
+		"concurrently")
+	_ = restoreCmd.MarkFlagRequired("path")
+	rootCmd.AddCommand(restoreCmd)
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Download objects from a selected blob storage partition to a local directory",
+	Long: `This command lists all objects from a partition of the selected blob storage and downloads
+them into the specified directory, recreating its directory tree and modification times. If a local file
+already matches the object (same size and modification time), then the command will skip it.`,
+	TraverseChildren: true,
+	Example:          "cloudsync restore -p ./Foo -d AMAZON_S3 --partition 01G82XT3907RASKY2JW8QSZ2RR --prefix docs/",
+	RunE:             restore,
+}
+
+func restore(cmd *cobra.Command, _ []string) error {
+	var dirCfg string
+	var fileCfg string
+	var dirName string
+	var storeType string
+	var partitionID string
+	var prefix string
+	var concurrency int
+
+	dirCfg, _ = cmd.Flags().GetString("configPath")
+	fileCfg, _ = cmd.Flags().GetString("configFile")
+	dirName, _ = cmd.Flags().GetString("path")
+	storeType, _ = cmd.Flags().GetString("driver")
+	partitionID, _ = cmd.Flags().GetString("partition")
+	prefix, _ = cmd.Flags().GetString("prefix")
+	concurrency, _ = cmd.Flags().GetInt("concurrency")
+
+	cmd.SilenceUsage = true
+	_, errCfg := os.Stat(filepath.Join(dirCfg, fileCfg))
+	cloudsync.SaveConfigIfNotExists(dirCfg, fileCfg)
+	cfg, err := cloudsync.NewConfig(dirCfg, fileCfg, dirName)
+	if err != nil {
+		return newCommandError(err, "Could not load configuration file")
+	}
+	if partitionID == "" {
+		// a freshly created configuration file or one without partition_id points to a new, empty partition
+		if errCfg != nil || cfg.PartitionIDGenerated() {
+			return newCommandError(errMissingPartition, "Could not restore objects")
+		}
+		partitionID = cfg.Scanner.PartitionID
+	}
+
+	blobStore, err := storage.NewBlobStorage(cfg, storeType)
+	if err != nil {
+		return newCommandError(err, "Could not load blob storage driver")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	res, err := cloudsync.RestoreObjects(ctx, blobStore, cloudsync.RestoreConfig{
+		PartitionID: partitionID,
+		Prefix:      prefix,
+		Destination: dirName,
+		Concurrency: concurrency,
+		LogErrors:   cfg.Scanner.LogErrors,
+	})
+	if err != nil {
+		return newCommandError(err, "Could not restore objects")
+	} else if res.FailedObjects > 0 {
+		return newCommandError(fmt.Errorf("%d objects failed", res.FailedObjects), "Could not restore objects")
+	}
+	return nil
+}
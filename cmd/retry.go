@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(retryFailedCmd)
+}
+
+var retryFailedCmd = &cobra.Command{
+	Use:   "retry-failed",
+	Short: "Upload objects which failed during previous runs to a selected blob storage",
+	Long: `This command reads the failed jobs journal written by previous upload and watch runs, and 
+schedules exactly those files again without traversing their directories. Files uploaded successfully 
+(or no longer found) are removed from the journal.`,
+	TraverseChildren: true,
+	Example:          "cloudsync retry-failed -d AMAZON_S3",
+	RunE:             retryFailed,
+}
+
+func retryFailed(cmd *cobra.Command, _ []string) error {
+	var dirCfg string
+	var fileCfg string
+	var storeType string
+
+	dirCfg, _ = cmd.Flags().GetString("configPath")
+	fileCfg, _ = cmd.Flags().GetString("configFile")
+	storeType, _ = cmd.Flags().GetString("driver")
+
+	cmd.SilenceUsage = true
+	cfg, err := cloudsync.NewConfig(dirCfg, fileCfg, "")
+	if err != nil {
+		return newCommandError(err, "Could not load configuration file")
+	}
+	cfg.Scanner.Mirror = false
+
+	blobStore, err := storage.NewBlobStorage(cfg, storeType)
+	if err != nil {
+		return newCommandError(err, "Could not load blob storage driver")
+	}
+
+	journal, err := cloudsync.OpenFileJournal(cfg.JournalPath())
+	if err != nil {
+		return newCommandError(err, "Could not open failed jobs journal")
+	}
+	jobs := journal.FailedJobs()
+	_ = journal.Close()
+	if len(jobs) == 0 {
+		log.Info().Msg("No failed jobs found")
+		return nil
+	}
+
+	scanner, closeState, err := newScanner(cfg, storeType)
+	if err != nil {
+		return err
+	}
+	defer closeState()
+	if err = scanner.RetryFailed(blobStore, jobs); err != nil { // blocking I/O
+		return newCommandError(err, "Could not start scanner instance")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+	if err = scanner.Shutdown(ctx); err != nil {
+		return newCommandError(err, "Could not gracefully shutdown scanner instance")
+	}
+	return nil
+}
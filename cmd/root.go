@@ -1,15 +1,57 @@
 package cmd
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/neutrinocorp/cloudsync"
 	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/rs/zerolog/log"
 
 	"github.com/spf13/cobra"
 )
 
+const (
+	// exitCodeError exit code used when a command fails.
+	exitCodeError = 1
+	// exitCodeFatalStorage exit code used when a command was stopped by a non-recovery blob storage error (e.g. missing
+	// bucket or denied access).
+	exitCodeFatalStorage = 3
+)
+
+// commandError error returned by a command, logged along its message once the command returned.
+type commandError struct {
+	msg string
+	err error
+}
+
+func (e commandError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e commandError) Unwrap() error {
+	return e.err
+}
+
+// newCommandError wraps an error returned by a command along the message it will be logged with.
+func newCommandError(err error, msg string) error {
+	return commandError{msg: msg, err: err}
+}
+
+// ExitCode retrieves the program exit code based on the error returned by a command (nil if succeeded).
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, cloudsync.ErrFatalStorage):
+		return exitCodeFatalStorage
+	default:
+		return exitCodeError
+	}
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "cloudsync [OPTIONS] [COMMANDS]",
@@ -21,15 +63,22 @@ Some of the available blob storages drivers are Amazon Simple Storage Service (S
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	SilenceErrors: true, // logged by Execute
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
-func Execute() {
+//
+// Returns the program exit code (see ExitCode), so main exits once commands released their resources.
+func Execute() int {
 	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	var cmdErr commandError
+	if errors.As(err, &cmdErr) {
+		log.Err(cmdErr.err).Msg(cmdErr.msg)
+	} else if err != nil {
+		log.Err(err).Msg("Could not execute command")
 	}
+	return ExitCode(err)
 }
 
 func init() {
@@ -51,7 +100,7 @@ func init() {
 	rootCmd.PersistentFlags().StringP("configFile", "f", "config.yaml", "Configuration file name")
 	rootCmd.PersistentFlags().StringP("driver", "d", "", "Blob storage driver (available drivers: "+
 		strings.Join([]string{storage.AmazonS3Str, storage.GoogleDriveStr, storage.GoogleCloudStr,
-			storage.AzureBlobStr}, ", ")+")")
+			storage.AzureBlobStr, storage.LocalFSStr}, ", ")+")")
 
 	_ = rootCmd.MarkPersistentFlagRequired("driver")
 }
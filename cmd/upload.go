@@ -2,18 +2,21 @@ package cmd
 
 import (
 	"context"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/neutrinocorp/cloudsync"
 	"github.com/neutrinocorp/cloudsync/storage"
-	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
 func init() {
-	uploadCmd.Flags().StringP("path", "p", "", "Directory path to be scanned")
-	_ = uploadCmd.MarkFlagRequired("path")
+	uploadCmd.Flags().StringP("path", "p", "", "Directory path to be scanned "+
+		"(besides scanner.sources from the configuration file)")
+	uploadCmd.Flags().Bool("reconcile", false, "Check every file against the blob storage, even if the local "+
+		"index reports it as unchanged")
+	uploadCmd.Flags().Bool("dry-run", false, "List files which would be uploaded (and why) without uploading them")
+	uploadCmd.Flags().Bool("mirror", false, "Delete remote objects whose local file was removed")
 	rootCmd.AddCommand(uploadCmd)
 }
 
@@ -25,43 +28,97 @@ and compares its content with the selected blob storage contained items. If the
 locally, then the command will upload the new object version to blob storage.`,
 	TraverseChildren: true,
 	Example:          "cloudsync upload -p ./Foo -d AMAZON_S3",
-	Run:              upload,
+	RunE:             upload,
 }
 
-func upload(cmd *cobra.Command, _ []string) {
+func upload(cmd *cobra.Command, _ []string) error {
 	var dirCfg string
 	var fileCfg string
 	var dirName string
 	var storeType string
+	var reconcile bool
+	var dryRun bool
+	var mirror bool
 
 	dirCfg, _ = cmd.Flags().GetString("configPath")
 	fileCfg, _ = cmd.Flags().GetString("configFile")
 	dirName, _ = cmd.Flags().GetString("path")
 	storeType, _ = cmd.Flags().GetString("driver")
+	reconcile, _ = cmd.Flags().GetBool("reconcile")
+	dryRun, _ = cmd.Flags().GetBool("dry-run")
+	mirror, _ = cmd.Flags().GetBool("mirror")
 
+	cmd.SilenceUsage = true
 	cloudsync.SaveConfigIfNotExists(dirCfg, fileCfg)
 	cfg, err := cloudsync.NewConfig(dirCfg, fileCfg, dirName)
 	if err != nil {
-		log.Err(err).Msg("Could not load configuration file")
-		os.Exit(1)
+		return newCommandError(err, "Could not load configuration file")
+	}
+	if reconcile {
+		cfg.Scanner.ForceReconcile = true
+	}
+	if dryRun {
+		cfg.Scanner.DryRun = true
+	}
+	if mirror {
+		cfg.Scanner.Mirror = true
 	}
 
 	blobStore, err := storage.NewBlobStorage(cfg, storeType)
 	if err != nil {
-		log.Err(err).Msg("Could not load blob storage driver")
-		os.Exit(1)
+		return newCommandError(err, "Could not load blob storage driver")
 	}
 
-	scanner := cloudsync.NewScanner(cfg) // blocking I/O
-	if err = scanner.Start(blobStore); err != nil {
-		log.Err(err).Msg("Could not start scanner instance")
-		os.Exit(1)
+	scanner, closeState, err := newScanner(cfg, storeType)
+	if err != nil {
+		return err
+	}
+	defer closeState()
+	if err = scanner.Start(blobStore); err != nil { // blocking I/O
+		return newCommandError(err, "Could not start scanner instance")
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 	if err = scanner.Shutdown(ctx); err != nil {
-		log.Err(err).Msg("Could not gracefully shutdown scanner instance")
-		os.Exit(1)
+		return newCommandError(err, "Could not gracefully shutdown scanner instance")
+	}
+	return nil
+}
+
+// newScanner allocates a cloudsync.Scanner using the local index and failed jobs journal set in Config. Returns an
+// error if any of them could not be opened. Returned function MUST be called to close them.
+func newScanner(cfg cloudsync.Config, storeType string) (*cloudsync.Scanner, func(), error) {
+	scanner := cloudsync.NewScanner(cfg)
+	closers := make([]func() error, 0, 2)
+	closeState := func() {
+		for _, closeFn := range closers {
+			_ = closeFn()
+		}
+	}
+	if indexPath := cfg.IndexPath(); indexPath != "" {
+		index, err := cloudsync.OpenBoltIndex(indexPath, newIndexNamespace(storeType, cfg.Cloud))
+		if err != nil {
+			return nil, nil, newCommandError(err, "Could not open local index")
+		}
+		closers = append(closers, index.Close)
+		scanner.SetIndex(index)
 	}
+	if journalPath := cfg.JournalPath(); journalPath != "" {
+		journal, err := cloudsync.OpenFileJournal(journalPath)
+		if err != nil {
+			closeState()
+			return nil, nil, newCommandError(err, "Could not open failed jobs journal")
+		}
+		closers = append(closers, journal.Close)
+		scanner.SetJournal(journal)
+	}
+	return scanner, closeState, nil
+}
+
+// newIndexNamespace builds a local index namespace from a blob storage driver and its target location, so entries
+// from different blob storages never get mixed.
+func newIndexNamespace(storeType string, cfg cloudsync.CloudConfig) string {
+	return strings.Join([]string{storeType, cfg.Endpoint, cfg.StorageAccount, cfg.Bucket, cfg.Container,
+		cfg.LocalPath}, "|")
 }
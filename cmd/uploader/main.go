@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/cmd"
 	"github.com/neutrinocorp/cloudsync/storage"
 	"github.com/rs/zerolog/log"
 )
@@ -28,29 +29,35 @@ func main() {
 	flag.StringVar(&storeType, "d", "", "Blob storage driver")
 	flag.Parse()
 
+	os.Exit(cmd.ExitCode(upload(dirCfg, fileCfg, dirName, storeType)))
+}
+
+// upload runs a single scanner execution. Errors are logged, so main only exits once resources were released.
+func upload(dirCfg, fileCfg, dirName, storeType string) error {
 	cloudsync.SaveConfigIfNotExists(dirCfg, fileCfg)
 	cfg, err := cloudsync.NewConfig(dirCfg, fileCfg, dirName)
 	if err != nil {
 		log.Err(err).Msg("Could not load configuration file")
-		os.Exit(1)
+		return err
 	}
 
 	blobStore, err := storage.NewBlobStorage(cfg, storeType)
 	if err != nil {
 		log.Err(err).Msg("Could not load blob storage driver")
-		os.Exit(1)
+		return err
 	}
 
 	scanner := cloudsync.NewScanner(cfg) // blocking I/O
 	if err = scanner.Start(blobStore); err != nil {
 		log.Err(err).Msg("Could not start scanner instance")
-		os.Exit(1)
+		return err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 	defer cancel()
 	if err = scanner.Shutdown(ctx); err != nil {
 		log.Err(err).Msg("Could not gracefully shutdown scanner instance")
-		os.Exit(1)
+		return err
 	}
+	return nil
 }
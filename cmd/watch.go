@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	watchCmd.Flags().StringP("path", "p", "", "Directory path to be watched "+
+		"(besides scanner.sources from the configuration file)")
+	watchCmd.Flags().Duration("debounce", 0, "Time to wait after the latest write to a file before uploading it "+
+		"(defaults to configuration file scanner.watch_debounce)")
+	rootCmd.AddCommand(watchCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Continuously upload objects from a local directory to a selected blob storage",
+	Long: `This command uploads every modified object from specified directory (same as upload command) and then 
+keeps listening for file system changes within the directory, uploading files as soon as they stop changing. 
+The command runs until it gets interrupted.`,
+	TraverseChildren: true,
+	Example:          "cloudsync watch -p ./Foo -d AMAZON_S3 --debounce 2s",
+	RunE:             watch,
+}
+
+func watch(cmd *cobra.Command, _ []string) error {
+	var dirCfg string
+	var fileCfg string
+	var dirName string
+	var storeType string
+
+	dirCfg, _ = cmd.Flags().GetString("configPath")
+	fileCfg, _ = cmd.Flags().GetString("configFile")
+	dirName, _ = cmd.Flags().GetString("path")
+	storeType, _ = cmd.Flags().GetString("driver")
+
+	cmd.SilenceUsage = true
+	cloudsync.SaveConfigIfNotExists(dirCfg, fileCfg)
+	cfg, err := cloudsync.NewConfig(dirCfg, fileCfg, dirName)
+	if err != nil {
+		return newCommandError(err, "Could not load configuration file")
+	}
+	if debounce, _ := cmd.Flags().GetDuration("debounce"); debounce > 0 {
+		cfg.Scanner.WatchDebounce = debounce
+	}
+
+	blobStore, err := storage.NewBlobStorage(cfg, storeType)
+	if err != nil {
+		return newCommandError(err, "Could not load blob storage driver")
+	}
+
+	scanner, closeState, err := newScanner(cfg, storeType)
+	if err != nil {
+		return err
+	}
+	defer closeState()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err = scanner.Watch(ctx, blobStore); err != nil { // blocking I/O
+		return newCommandError(err, "Could not watch directory")
+	}
+	log.Info().
+		Uint64("total_upload_jobs", scanner.Stats().GetTotalUploadJobs()).
+		Uint64("total_failed_jobs", scanner.Stats().GetTotalFailedJobs()).
+		Msg("Stopped directory watch")
+	return nil
+}
@@ -4,7 +4,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/oklog/ulid/v2"
 	"github.com/rs/zerolog/log"
@@ -17,6 +17,69 @@ type CloudConfig struct {
 	Bucket    string `yaml:"bucket"`
 	AccessKey string `yaml:"access_key"`
 	SecretKey string `yaml:"secret_key"`
+	// LocalPath target directory used by the local file system blob storage (e.g. a NAS mount).
+	LocalPath string `yaml:"local_path"`
+	// Endpoint custom blob storage service URL (e.g. a local emulator or an S3-compatible service such as MinIO).
+	// Uses the vendor's default if empty.
+	Endpoint string `yaml:"endpoint"`
+	// UsePathStyle address buckets using path-style URLs (https://host/bucket/key) instead of virtual-hosted
+	// URLs (https://bucket.host/key). Required by most S3-compatible services.
+	UsePathStyle bool `yaml:"use_path_style"`
+	// InsecureSkipVerify disables TLS server certificate verification. Use with caution.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	// CACertFile path to a PEM-encoded certificate authority (CA) bundle trusted besides host's root certificates.
+	CACertFile string `yaml:"ca_cert_file"`
+	// DisableChecksum stop sending SHA-256 checksums on uploads (Amazon S3 only). Required by S3-compatible
+	// services rejecting flexible checksums.
+	DisableChecksum bool `yaml:"disable_checksum"`
+	// CredentialsFile path to a service account credentials file (Google Cloud Storage only). Uses
+	// Application Default Credentials (ADC) if empty.
+	CredentialsFile string `yaml:"credentials_file"`
+	// StorageAccount Microsoft Azure storage account name.
+	StorageAccount string `yaml:"storage_account"`
+	// Container Microsoft Azure Blob Storage container name.
+	Container string `yaml:"container"`
+	// AccountKey Microsoft Azure storage account shared key. Takes precedence over SASToken.
+	AccountKey string `yaml:"account_key"`
+	// SASToken Microsoft Azure shared access signature (SAS) token with, at least, read and write permissions
+	// over Container.
+	SASToken string `yaml:"sas_token"`
+	// BlockSize size in bytes of each block staged in parallel by Microsoft Azure Blob Storage uploads
+	// (defaults to 8 MiB). Grown automatically for objects that would exceed the 50,000 blocks limit.
+	BlockSize int64 `yaml:"block_size"`
+}
+
+// EncryptionConfig client-side encryption configuration (see storage.EncryptedStorage). Objects are encrypted before
+// leaving the host if either Passphrase or KeyFile was set.
+type EncryptionConfig struct {
+	// Passphrase secret used to derive the key encryption key (KEK) using scrypt. Ignored if KeyFile was set.
+	Passphrase string `yaml:"passphrase"`
+	// KeyFile path to a file holding a 32-byte key encryption key (raw, hex or base64-encoded). Relative paths are
+	// resolved from the configuration file directory.
+	KeyFile string `yaml:"key_file"`
+	// ChunkSize size of plaintext chunks encrypted independently (defaults to storage.DefaultEncryptionChunkSize).
+	// Object sizes reported by the blob storage are converted back assuming every object uses the same value.
+	ChunkSize ByteSize `yaml:"chunk_size"`
+	// EncryptKeys encrypt object keys as well, segment by segment, so directory structure is preserved while names are
+	// hidden. Keys are encrypted deterministically, so every host using the same passphrase or key file gets the same
+	// keys. Segments (e.g. file names) longer than storage.MaxEncryptedKeySegmentSize (143 bytes) cannot be encrypted.
+	EncryptKeys bool `yaml:"encrypt_keys"`
+}
+
+// IsEnabled verifies if client-side encryption was configured.
+func (c EncryptionConfig) IsEnabled() bool {
+	return c.Passphrase != "" || c.KeyFile != ""
+}
+
+// CompressionConfig compression configuration (see storage.CompressedStorage). Objects are compressed before being
+// encrypted (if enabled) and uploaded.
+type CompressionConfig struct {
+	// Enabled compress objects before uploading them.
+	Enabled bool `yaml:"enabled"`
+	// Codec compression algorithm, either zstd or gzip (defaults to zstd).
+	Codec string `yaml:"codec"`
+	// SkipExtensions file extensions (e.g. .parquet) never compressed, besides well-known compressed formats.
+	SkipExtensions []string `yaml:"skip_extensions"`
 }
 
 // ScannerConfig Scanner configuration.
@@ -37,10 +100,81 @@ type ScannerConfig struct {
 	// DeepTraversing read every node until leafs are reached from a root directory tree. If set to false,
 	// Scanner will read only the root tree files.
 	DeepTraversing bool `yaml:"deep_traversing"`
-	// IgnoredKeys deny list of custom reserved file or folder keys. Scanner will skip items specified here.
+	// MaxDepth maximum number of directory levels traversed below the root directory if DeepTraversing was set as
+	// true (e.g. 1 reads root files and files from its direct child directories). Zero means no limit.
+	MaxDepth int `yaml:"max_depth"`
+	// Symlinks policy used to handle symbolic links (skip, follow or store-as-link). Defaults to SymlinksSkip.
+	Symlinks SymlinkPolicy `yaml:"symlinks"`
+	// IgnoredKeys deny list of gitignore-style patterns (e.g. *.log, build/, /docs/*.md, !keep.log) evaluated
+	// against paths relative to the root directory. Scanner will skip items specified here. Patterns from IgnoreFile
+	// files found during traversal take precedence.
 	IgnoredKeys []string `yaml:"ignored_keys"`
+	// IncludePatterns allow list of gitignore-style patterns (e.g. *.tar.gz, logs/). If set, Scanner will only
+	// upload files matching at least one of them. Evaluated after IgnoredKeys.
+	IncludePatterns []string `yaml:"include_patterns"`
+	// MinSize minimum size of files to upload (e.g. 1024, 10KB, 1MiB). Smaller files are skipped.
+	MinSize ByteSize `yaml:"min_size"`
+	// MaxSize maximum size of files to upload (e.g. 5GiB). Bigger files are skipped.
+	MaxSize ByteSize `yaml:"max_size"`
+	// ModifiedAfter skip files modified before the given date (e.g. 2023-01-31, 2023-01-31T15:04:05Z) or age
+	// relative to the current time (e.g. 30d, 2w, 12h).
+	ModifiedAfter TimeBound `yaml:"modified_after"`
+	// ModifiedBefore skip files modified after the given date (e.g. 2023-01-31) or age relative to the current time
+	// (e.g. 7d, files modified within the last week are skipped).
+	ModifiedBefore TimeBound `yaml:"modified_before"`
+	// Sources directory trees uploaded besides Config.RootDirectory, each one with its own key prefix, partition ID,
+	// ignore rules, hidden-file and traversal settings. Every source is processed in a single run, sharing worker
+	// pools and stats.
+	Sources []SourceConfig `yaml:"sources"`
+	// KeyTemplate template used to build object keys (e.g. {partition}/{hostname}/{yyyy}/{mm}/{relpath}). Placeholders
+	// are {partition}, {prefix} (source key prefix), {hostname}, {username}, {root} (source directory name),
+	// {relpath}, {dir}, {name}, {stem}, {ext}, {yyyy}, {mm}, {dd} (file modification date in UTC) and {sha256}. Values
+	// may be transformed using lower, upper and nfc (e.g. {relpath|nfc|lower}). Empty segments are removed. Mirror
+	// requires templates ending in /{relpath}. Defaults to DefaultKeyTemplate.
+	KeyTemplate string `yaml:"key_template"`
 	// LogErrors disable or enable logging of errors. Useful for development or overall process visibility purposes.
 	LogErrors bool `yaml:"log_errors"`
+	// MaxConcurrentUploads number of files uploaded concurrently, bounding the number of files opened at the same
+	// time. Defaults to DefaultMaxConcurrentUploads.
+	MaxConcurrentUploads int `yaml:"max_concurrent_uploads"`
+	// MaxConcurrentChecks number of files compared concurrently against the remote storage (to know if they were
+	// modified). Defaults to DefaultMaxConcurrentChecks.
+	MaxConcurrentChecks int `yaml:"max_concurrent_checks"`
+	// ChangeDetection strategy used to decide if a file was modified compared to its stored Object (mtime, size,
+	// checksum or mtime+checksum). Defaults to ChangeDetectionModTime.
+	ChangeDetection ChangeDetection `yaml:"change_detection"`
+	// DryRun run traversal and change detection without uploading files nor updating the local state index. Files
+	// which would be uploaded are logged along with the reason.
+	DryRun bool `yaml:"dry_run"`
+	// WatchDebounce time to wait after the latest write to a file before scheduling it in watch mode (e.g. 500ms,
+	// 2s). Defaults to DefaultWatchDebounce.
+	WatchDebounce time.Duration `yaml:"watch_debounce"`
+	// IndexFile path of the local state index used to skip files unchanged since their latest synchronization.
+	// Relative paths are resolved from the configuration file directory. Defaults to DefaultIndexFile.
+	IndexFile string `yaml:"index_file"`
+	// DisableIndex check every file against the blob storage, without reading nor writing the local state index.
+	DisableIndex bool `yaml:"disable_index"`
+	// ForceReconcile check every file against the blob storage even if the local state index reports it as
+	// synchronized. The index is still updated with the results.
+	ForceReconcile bool `yaml:"force_reconcile"`
+	// Mirror delete remote objects (within PartitionID) with no local counterpart once the directory tree was
+	// traversed. Objects which would be skipped by traversing rules (hidden, ignored, etc.) are kept.
+	Mirror bool `yaml:"mirror"`
+	// MirrorSoftDelete move objects removed by mirror mode under the MirrorTrashPrefix (within PartitionID)
+	// instead of deleting them permanently.
+	MirrorSoftDelete bool `yaml:"mirror_soft_delete"`
+	// MirrorMaxDeletePercent abort mirror mode (deleting nothing) if more than this percentage of the remote objects
+	// would be removed. Defaults to DefaultMirrorMaxDeletePercent if nil; set as 0 to abort on any deletion or as 100
+	// to disable.
+	MirrorMaxDeletePercent *float64 `yaml:"mirror_max_delete_percent"`
+	// Retry policy of failed file checks and uploads (e.g. throttling or network failures). Non-recovery storage
+	// errors (ErrFatalStorage) are never retried.
+	Retry RetryPolicy `yaml:"retry"`
+	// CacheControl Cache-Control directives of uploaded objects (e.g. max-age=3600), if supported by the blob storage.
+	CacheControl string `yaml:"cache_control"`
+	// JournalFile path of the journal failed jobs are recorded into, so they may be retried later on. Relative paths
+	// are resolved from the configuration file directory. Defaults to DefaultJournalFile.
+	JournalFile string `yaml:"journal_file"`
 }
 
 // Config Main application configuration.
@@ -49,8 +183,13 @@ type Config struct {
 	RootDirectory string        `yaml:"-"`
 	Cloud         CloudConfig   `yaml:"cloud"`
 	Scanner       ScannerConfig `yaml:"scanner"`
+	// Encryption client-side encryption settings applied to every blob storage driver.
+	Encryption EncryptionConfig `yaml:"encryption"`
+	// Compression compression settings applied to every blob storage driver.
+	Compression CompressionConfig `yaml:"compression"`
 
-	ignoredKeysHashSet map[string]struct{}
+	ignoreMatcher      *IgnoreMatcher
+	partitionGenerated bool
 }
 
 // NewConfig allocates a Config instance used by internal components to perform its processes.
@@ -71,42 +210,64 @@ func NewConfig(path, file, rootDirectory string) (Config, error) {
 	log.Debug().Str("path", filePath).Msg("Loaded config")
 	if cfg.Scanner.PartitionID == "" {
 		cfg.Scanner.PartitionID = ulid.Make().String() // set a tenant id by default
+		cfg.partitionGenerated = true
 	}
 	cfg.RootDirectory = rootDirectory
 	cfg.FilePath = filePath
 	return cfg, nil
 }
 
-func newIgnoredKeysSet(keys []string) map[string]struct{} {
-	if len(keys) == 0 {
-		return nil
+// PartitionIDGenerated reports whether NewConfig allocated a random ScannerConfig.PartitionID as none was
+// configured. Such a partition holds no objects from previous runs.
+func (c Config) PartitionIDGenerated() bool {
+	return c.partitionGenerated
+}
+
+// KeyIsIgnored verifies if a file, using its path relative to the root directory (slash-separated), matches
+// ScannerConfig.IgnoredKeys patterns. Files within ignored directories are ignored as well.
+func (c *Config) KeyIsIgnored(key string) bool {
+	if c.ignoreMatcher == nil {
+		c.ignoreMatcher = NewIgnoreMatcher(c.Scanner.IgnoredKeys)
 	}
+	return c.ignoreMatcher.Match(key, false)
+}
 
-	m := make(map[string]struct{}, len(keys))
-	for _, k := range keys {
-		if strings.HasPrefix(k, "*.") {
-			k = strings.TrimPrefix(k, "*.")
-		}
-		m[k] = struct{}{}
+// IndexPath retrieves the local state index file path. Returns an empty string if the index was disabled or if
+// neither ScannerConfig.IndexFile nor Config.FilePath were set.
+func (c Config) IndexPath() string {
+	if c.Scanner.DisableIndex {
+		return ""
 	}
-	return m
+	return c.resolvePath(c.Scanner.IndexFile, DefaultIndexFile)
 }
 
-// KeyIsIgnored verifies if a specified key was selected to be ignored.
-func (c *Config) KeyIsIgnored(key string) bool {
-	if c.ignoredKeysHashSet == nil {
-		c.ignoredKeysHashSet = newIgnoredKeysSet(c.Scanner.IgnoredKeys)
+// JournalPath retrieves the failed jobs journal file path. Returns an empty string if neither
+// ScannerConfig.JournalFile nor Config.FilePath were set.
+func (c Config) JournalPath() string {
+	return c.resolvePath(c.Scanner.JournalFile, DefaultJournalFile)
+}
+
+// EncryptionKeyPath retrieves the key encryption key file path (see EncryptionConfig.KeyFile). Returns an empty
+// string if none was set.
+func (c Config) EncryptionKeyPath() string {
+	if c.Encryption.KeyFile == "" {
+		return ""
 	}
+	return c.resolvePath(c.Encryption.KeyFile, "")
+}
 
-	splStr := strings.Split(key, ".")
-	if len(splStr) > 1 {
-		extension := splStr[len(splStr)-1]
-		if _, ok := c.ignoredKeysHashSet[extension]; ok {
-			return true
-		}
+// resolvePath resolves a file path relative to the configuration file directory, using defaultFile if path is empty.
+func (c Config) resolvePath(path, defaultFile string) string {
+	switch {
+	case filepath.IsAbs(path):
+		return path
+	case c.FilePath == "":
+		return path
+	case path == "":
+		return filepath.Join(filepath.Dir(c.FilePath), defaultFile)
+	default:
+		return filepath.Join(filepath.Dir(c.FilePath), path)
 	}
-	_, ok := c.ignoredKeysHashSet[key]
-	return ok
 }
 
 // SaveConfig stores the specified Config into host's physical disk.
@@ -115,8 +115,10 @@ func TestNewConfig(t *testing.T) {
 
 			if tt.exp.Scanner.PartitionID == "" && err == nil {
 				assert.NotEmpty(t, out.Scanner.PartitionID)
+				assert.True(t, out.PartitionIDGenerated())
 			} else {
 				assert.Equal(t, tt.exp.Scanner.PartitionID, out.Scanner.PartitionID)
+				assert.False(t, out.PartitionIDGenerated())
 			}
 			assert.Equal(t, tt.exp.Scanner.ReadHidden, out.Scanner.ReadHidden)
 			assert.Equal(t, tt.exp.Scanner.DeepTraversing, out.Scanner.DeepTraversing)
@@ -300,3 +302,89 @@ func TestSaveConfigIfNotExists(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_IndexPath(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  cloudsync.Config
+		exp  string
+	}{
+		{
+			name: "Empty",
+			cfg:  cloudsync.Config{},
+			exp:  "",
+		},
+		{
+			name: "Disabled",
+			cfg: cloudsync.Config{
+				FilePath: filepath.Join("foo", "config.yaml"),
+				Scanner:  cloudsync.ScannerConfig{DisableIndex: true},
+			},
+			exp: "",
+		},
+		{
+			name: "Default",
+			cfg: cloudsync.Config{
+				FilePath: filepath.Join("foo", "config.yaml"),
+			},
+			exp: filepath.Join("foo", cloudsync.DefaultIndexFile),
+		},
+		{
+			name: "Relative",
+			cfg: cloudsync.Config{
+				FilePath: filepath.Join("foo", "config.yaml"),
+				Scanner:  cloudsync.ScannerConfig{IndexFile: "bar.db"},
+			},
+			exp: filepath.Join("foo", "bar.db"),
+		},
+		{
+			name: "Absolute",
+			cfg: cloudsync.Config{
+				FilePath: filepath.Join("foo", "config.yaml"),
+				Scanner:  cloudsync.ScannerConfig{IndexFile: filepath.Join(os.TempDir(), "bar.db")},
+			},
+			exp: filepath.Join(os.TempDir(), "bar.db"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.exp, tt.cfg.IndexPath())
+		})
+	}
+}
+
+func TestConfig_JournalPath(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  cloudsync.Config
+		exp  string
+	}{
+		{
+			name: "Empty",
+			cfg:  cloudsync.Config{},
+			exp:  "",
+		},
+		{
+			name: "Default",
+			cfg: cloudsync.Config{
+				FilePath: filepath.Join("foo", "config.yaml"),
+			},
+			exp: filepath.Join("foo", cloudsync.DefaultJournalFile),
+		},
+		{
+			name: "Relative",
+			cfg: cloudsync.Config{
+				FilePath: filepath.Join("foo", "config.yaml"),
+				Scanner:  cloudsync.ScannerConfig{JournalFile: "bar.jsonl"},
+			},
+			exp: filepath.Join("foo", "bar.jsonl"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.exp, tt.cfg.JournalPath())
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package cloudsync
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultStats accumulates counters of every ScheduleFileUploads execution.
+//
+// Deprecated: Use Scanner.Stats instead.
+var DefaultStats = &Stats{}
+
+// defaultScanner state shared by deprecated package-level functions.
+var defaultScanner = struct {
+	mu       sync.Mutex
+	scanner  *Scanner
+	shutdown chan struct{}
+}{
+	shutdown: make(chan struct{}),
+}
+
+// ListenForSysInterruption waits and gracefully shuts down internal workers when an external agent sends
+// a cancellation signal (e.g. pressing Ctrl+C on shell session running the program).
+//
+// Deprecated: Scanner.Start listens for system interruptions by itself.
+func ListenForSysInterruption(wg *sync.WaitGroup, cancel context.CancelFunc, sysChan <-chan os.Signal) {
+	go func() {
+		<-sysChan
+		log.Debug().
+			Uint64("total_upload_jobs", DefaultStats.GetTotalUploadJobs()).
+			Msg("cloudsync: System interruption detected, exiting")
+		cancel()
+		wg.Wait()
+		log.Debug().Msg("cloudsync: Gracefully closed all background tasks after interruption")
+	}()
+}
+
+// ScheduleFileUploads traverses a directory tree based on specified configuration (Config.RootDirectory) and
+// uploads every file found using a default Scanner. Counters are accumulated into DefaultStats.
+//
+// Blocks until every file found was checked and, if required, uploaded or until ctx gets cancelled.
+//
+// Deprecated: Use NewScanner and Scanner.Start instead.
+func ScheduleFileUploads(ctx context.Context, cfg Config, wg *sync.WaitGroup, storage BlobStorage) error {
+	wg.Add(1)
+	defer wg.Done()
+	scanner := NewScanner(cfg)
+	defaultScanner.mu.Lock()
+	defaultScanner.scanner = scanner
+	defaultScanner.mu.Unlock()
+	err := scanner.start(ctx, storage)
+	DefaultStats.add(scanner.Stats())
+	return err
+}
+
+// ListenAndExecuteUploadJobs blocks until ShutdownUploadWorkers gets called. Upload jobs are executed by the
+// default Scanner used by ScheduleFileUploads.
+//
+// Deprecated: Scanner.Start runs its own upload workers (see ScannerConfig.MaxConcurrentUploads).
+func ListenAndExecuteUploadJobs(_ context.Context, _ BlobStorage, _ *sync.WaitGroup) {
+	<-defaultScanner.shutdown
+}
+
+// ListenUploadErrors blocks until ShutdownUploadWorkers gets called. Failed jobs are logged by the default Scanner
+// used by ScheduleFileUploads if ScannerConfig.LogErrors was set as true.
+//
+// Deprecated: Scanner.Start handles failed jobs by itself (see Scanner.Stats).
+func ListenUploadErrors(_ Config) {
+	<-defaultScanner.shutdown
+}
+
+// ShutdownUploadWorkers waits for ctx to be cancelled, then shuts down the default Scanner used by
+// ScheduleFileUploads and releases ListenAndExecuteUploadJobs and ListenUploadErrors callers.
+//
+// Deprecated: Use Scanner.Shutdown instead.
+func ShutdownUploadWorkers(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+	<-ctx.Done()
+	log.Debug().Msg("cloudsync: Shutting down workers")
+	defaultScanner.mu.Lock()
+	defer defaultScanner.mu.Unlock()
+	if defaultScanner.scanner != nil {
+		_ = defaultScanner.scanner.Shutdown(context.Background())
+		defaultScanner.scanner = nil
+	}
+	select {
+	case <-defaultScanner.shutdown:
+	default:
+		close(defaultScanner.shutdown)
+	}
+}
@@ -0,0 +1,40 @@
+package cloudsync
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleFileUploads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := &recordingBlobStorage{}
+	cfg := Config{
+		RootDirectory: "./testdata",
+		Scanner:       ScannerConfig{PartitionID: "123", DeepTraversing: true},
+	}
+	wg := &sync.WaitGroup{}
+	listeners := sync.WaitGroup{}
+	listeners.Add(2)
+	go func() {
+		defer listeners.Done()
+		ListenAndExecuteUploadJobs(ctx, store, wg)
+	}()
+	go func() {
+		defer listeners.Done()
+		ListenUploadErrors(cfg)
+	}()
+
+	prevTotal := DefaultStats.GetTotalUploadJobs()
+	require.NoError(t, ScheduleFileUploads(ctx, cfg, wg, store))
+	wg.Wait()
+	assert.Len(t, store.keys, 5)
+	assert.Equal(t, prevTotal+5, DefaultStats.GetTotalUploadJobs())
+
+	cancel()
+	ShutdownUploadWorkers(ctx, wg)
+	listeners.Wait()
+}
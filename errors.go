@@ -5,13 +5,35 @@ import (
 	"fmt"
 )
 
-// ErrFatalStorage non-recovery error issued by the blob storage. Programs should panic once they receive this error.
+// ErrFatalStorage non-recovery error issued by the blob storage (e.g. missing bucket or denied access). Scanner stops
+// once it receives this error, returning it to the caller.
 var ErrFatalStorage = errors.New("cloudsync: Got fatal error from blob storage")
 
+// ErrObjectNotFound the requested object does not exist in the blob storage.
+var ErrObjectNotFound = errors.New("cloudsync: Object not found")
+
+// ErrUnsupportedStorage the blob storage does not implement a capability required by an operation
+// (e.g. BlobLister, BlobDownloader).
+var ErrUnsupportedStorage = errors.New("cloudsync: Blob storage does not support operation")
+
+// ErrInvalidChangeDetection the specified ScannerConfig.ChangeDetection mode is not supported.
+var ErrInvalidChangeDetection = errors.New("cloudsync: Invalid change detection mode")
+
+// ErrMirrorThreshold mirror mode was aborted as it would remove more objects than allowed by
+// ScannerConfig.MirrorMaxDeletePercent.
+var ErrMirrorThreshold = errors.New("cloudsync: Mirror would delete too many objects")
+
+// ErrIteratorDone no more items are left in an iterator.
+var ErrIteratorDone = errors.New("cloudsync: No more items in iterator")
+
 // ErrFileUpload generic error generated from a blob upload job.
 type ErrFileUpload struct {
-	Key    string
-	Parent error
+	Key string
+	// Path file's path from host's file system (if known).
+	Path string
+	// Attempts number of times the job was executed (see ScannerConfig.Retry).
+	Attempts int
+	Parent   error
 }
 
 var _ error = ErrFileUpload{}
@@ -0,0 +1,187 @@
+package cloudsync
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidFilter a size or modification time filter could not be parsed.
+var ErrInvalidFilter = errors.New("cloudsync: Invalid filter")
+
+// ByteSize a size in bytes. Parsed from YAML as a plain number of bytes or a number followed by a unit, using either
+// decimal (KB, MB, GB, TB) or binary (KiB, MiB, GiB, TiB) multiples (e.g. 512, 100MB, 5GiB, 1.5 GiB).
+type ByteSize int64
+
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1e3,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1e6,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1e9,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1e12,
+	"tib": 1 << 40,
+}
+
+// ParseByteSize parses a size (e.g. 512, 100MB, 5GiB). An empty string is parsed as zero (no limit). Returns
+// ErrInvalidFilter if it could not be parsed.
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if err != nil || !ok || n*unit > math.MaxInt64 {
+		return 0, fmt.Errorf("%w: size %q", ErrInvalidFilter, s)
+	}
+	return ByteSize(n * unit), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	size, err := ParseByteSize(value.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// TimeBound an absolute point in time or a time relative to the current time (i.e. an age). Parsed from YAML as
+// a date (2006-01-02), a date-time (RFC 3339) or a duration (e.g. 30d, 2w, 12h, 90m).
+type TimeBound struct {
+	raw string
+	// At absolute point in time. Takes precedence over Age.
+	At time.Time
+	// Age duration subtracted from the current time.
+	Age time.Duration
+}
+
+var timeBoundLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+// ParseTimeBound parses an absolute date, date-time or a relative duration (e.g. 2023-01-31, 30d). Returns
+// ErrInvalidFilter if it could not be parsed.
+func ParseTimeBound(s string) (TimeBound, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return TimeBound{}, nil
+	}
+	for _, layout := range timeBoundLayouts {
+		if at, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return TimeBound{raw: s, At: at}, nil
+		}
+	}
+	if age, err := parseAge(s); err == nil {
+		return TimeBound{raw: s, Age: age}, nil
+	}
+	return TimeBound{}, fmt.Errorf("%w: time %q", ErrInvalidFilter, s)
+}
+
+// parseAge parses a duration, supporting days (d) and weeks (w) besides time.ParseDuration units.
+func parseAge(s string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = time.Hour * 24
+	case strings.HasSuffix(s, "w"):
+		unit = time.Hour * 24 * 7
+	default:
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n * float64(unit)), nil
+}
+
+// IsZero indicates if no time was set.
+func (t TimeBound) IsZero() bool {
+	return t.At.IsZero() && t.Age == 0
+}
+
+// Time resolves the point in time relative to now.
+func (t TimeBound) Time(now time.Time) time.Time {
+	if !t.At.IsZero() {
+		return t.At
+	}
+	return now.Add(-t.Age)
+}
+
+func (t TimeBound) String() string {
+	return t.raw
+}
+
+func (t *TimeBound) UnmarshalYAML(value *yaml.Node) error {
+	bound, err := ParseTimeBound(value.Value)
+	if err != nil {
+		return err
+	}
+	*t = bound
+	return nil
+}
+
+func (t TimeBound) MarshalYAML() (interface{}, error) {
+	return t.raw, nil
+}
+
+// newIncludeMatcher allocates an IgnoreMatcher evaluating ScannerConfig.IncludePatterns. Returns nil if no patterns
+// were specified, so every file is included.
+func newIncludeMatcher(patterns []string) *IgnoreMatcher {
+	if len(patterns) == 0 {
+		return nil
+	}
+	return NewIgnoreMatcher(patterns)
+}
+
+// resolveTimeFilters resolves ScannerConfig.ModifiedAfter and ScannerConfig.ModifiedBefore relative to now, so
+// relative bounds (i.e. ages) are resolved once per scan instead of once per file.
+func (s *Scanner) resolveTimeFilters(now time.Time) {
+	s.modifiedAfter, s.modifiedBefore = time.Time{}, time.Time{}
+	if !s.cfg.Scanner.ModifiedAfter.IsZero() {
+		s.modifiedAfter = s.cfg.Scanner.ModifiedAfter.Time(now)
+	}
+	if !s.cfg.Scanner.ModifiedBefore.IsZero() {
+		s.modifiedBefore = s.cfg.Scanner.ModifiedBefore.Time(now)
+	}
+}
+
+// isFileFiltered verifies if a file must not be scheduled as it does not match ScannerConfig.IncludePatterns, size
+// (ScannerConfig.MinSize, ScannerConfig.MaxSize) nor modification time (ScannerConfig.ModifiedAfter,
+// ScannerConfig.ModifiedBefore) filters. Modification time bounds MUST be resolved first (see
+// Scanner.resolveTimeFilters).
+func (s *Scanner) isFileFiltered(rel string, info fs.FileInfo) bool {
+	cfg := s.cfg.Scanner
+	size, modTime := info.Size(), info.ModTime()
+	switch {
+	case cfg.MinSize > 0 && size < int64(cfg.MinSize),
+		cfg.MaxSize > 0 && size > int64(cfg.MaxSize),
+		!s.modifiedAfter.IsZero() && !modTime.After(s.modifiedAfter),
+		!s.modifiedBefore.IsZero() && !modTime.Before(s.modifiedBefore):
+		return true
+	case s.include != nil:
+		return !s.include.Match(rel, false)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,132 @@
+package cloudsync_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp cloudsync.ByteSize
+		err error
+	}{
+		{in: "", exp: 0},
+		{in: "512", exp: 512},
+		{in: "512B", exp: 512},
+		{in: "10KB", exp: 10_000},
+		{in: "10kib", exp: 10 << 10},
+		{in: "1.5 GiB", exp: 3 << 29},
+		{in: "5GiB", exp: 5 << 30},
+		{in: "2TB", exp: 2e12},
+		{in: "10 parsecs", err: cloudsync.ErrInvalidFilter},
+		{in: "GB", err: cloudsync.ErrInvalidFilter},
+		{in: "-1", err: cloudsync.ErrInvalidFilter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			size, err := cloudsync.ParseByteSize(tt.in)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.exp, size)
+		})
+	}
+}
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in  string
+		exp time.Time
+		err error
+	}{
+		{in: "2023-01-31", exp: time.Date(2023, 1, 31, 0, 0, 0, 0, time.Local)},
+		{in: "2023-01-31T15:04:05", exp: time.Date(2023, 1, 31, 15, 4, 5, 0, time.Local)},
+		{in: "2023-01-31T15:04:05Z", exp: time.Date(2023, 1, 31, 15, 4, 5, 0, time.UTC)},
+		{in: "30d", exp: now.AddDate(0, 0, -30)},
+		{in: "2w", exp: now.AddDate(0, 0, -14)},
+		{in: "1.5h", exp: now.Add(-time.Minute * 90)},
+		{in: "yesterday", err: cloudsync.ErrInvalidFilter},
+		{in: "31/01/2023", err: cloudsync.ErrInvalidFilter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			bound, err := cloudsync.ParseTimeBound(tt.in)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				assert.True(t, tt.exp.Equal(bound.Time(now)), bound.Time(now))
+				assert.Equal(t, tt.in, bound.String())
+			}
+		})
+	}
+}
+
+func TestScannerConfig_FiltersYAML(t *testing.T) {
+	cfg := cloudsync.ScannerConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+include_patterns: ["*.tar.gz"]
+min_size: 1KiB
+max_size: 5GiB
+modified_after: 30d
+modified_before: 2023-01-31
+`), &cfg))
+	assert.Equal(t, []string{"*.tar.gz"}, cfg.IncludePatterns)
+	assert.Equal(t, cloudsync.ByteSize(1024), cfg.MinSize)
+	assert.Equal(t, cloudsync.ByteSize(5<<30), cfg.MaxSize)
+	assert.Equal(t, time.Hour*24*30, cfg.ModifiedAfter.Age)
+	assert.Equal(t, time.Date(2023, 1, 31, 0, 0, 0, 0, time.Local), cfg.ModifiedBefore.At)
+
+	out, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "modified_after: 30d")
+
+	assert.ErrorIs(t, yaml.Unmarshal([]byte("max_size: lots"), &cfg), cloudsync.ErrInvalidFilter)
+}
+
+func TestScanner_Filters(t *testing.T) {
+	now := time.Now()
+	root, remote := t.TempDir(), t.TempDir()
+	files := []struct {
+		name    string
+		size    int
+		modTime time.Time
+	}{
+		{name: "recent.tar.gz", size: 64, modTime: now.Add(-time.Hour)},
+		{name: "logs/recent.tar.gz", size: 64, modTime: now.Add(-time.Hour * 24)},
+		{name: "logs/old.tar.gz", size: 64, modTime: now.AddDate(0, 0, -60)},
+		{name: "logs/big.tar.gz", size: 4096, modTime: now.Add(-time.Hour)},
+		{name: "logs/small.tar.gz", size: 1, modTime: now.Add(-time.Hour)},
+		{name: "logs/fresh.tar.gz", size: 64, modTime: now},
+		{name: "logs/recent.txt", size: 64, modTime: now.Add(-time.Hour)},
+	}
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f.name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, make([]byte, f.size), 0644))
+		require.NoError(t, os.Chtimes(path, f.modTime, f.modTime))
+	}
+	cfg := cloudsync.Config{
+		RootDirectory: root,
+		Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+		Scanner: cloudsync.ScannerConfig{
+			DeepTraversing:  true,
+			IncludePatterns: []string{"*.tar.gz"},
+			MinSize:         16,
+			MaxSize:         1024,
+			ModifiedAfter:   cloudsync.TimeBound{Age: time.Hour * 24 * 30},
+			ModifiedBefore:  cloudsync.TimeBound{Age: time.Minute},
+		},
+	}
+	require.NoError(t, cloudsync.NewScanner(cfg).Start(storage.NewLocalFS(cfg)))
+
+	keys := listRemoteKeys(t, remote)
+	assert.Equal(t, "logs/recent.tar.gz,recent.tar.gz", strings.Join(keys, ","))
+}
@@ -0,0 +1,274 @@
+package cloudsync
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// IgnoreFile name of the files holding gitignore-style patterns which Scanner reads from every directory traversed.
+// Patterns apply to the directory the file was found in and its children.
+const IgnoreFile = ".cloudsyncignore"
+
+// ignorePattern a compiled gitignore-style pattern.
+type ignorePattern struct {
+	// negate re-includes paths matched by previous patterns (! prefix).
+	negate bool
+	// dirOnly matches directories only (trailing slash).
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// IgnoreMatcher evaluates slash-separated relative paths against gitignore-compatible patterns (see
+// https://git-scm.com/docs/gitignore). Patterns are grouped by the directory they were defined in, so patterns from
+// deeper directories take precedence over its parents' ones.
+//
+// This struct is goroutine-safe.
+type IgnoreMatcher struct {
+	mu sync.RWMutex
+	// base compiled patterns applying from root, with lower precedence than any ignore file.
+	base []ignorePattern
+	// patterns compiled patterns by the relative directory they apply from ("" for root).
+	patterns map[string][]ignorePattern
+}
+
+// NewIgnoreMatcher allocates an IgnoreMatcher using the given patterns from the root directory (e.g.
+// ScannerConfig.IgnoredKeys).
+func NewIgnoreMatcher(patterns []string) *IgnoreMatcher {
+	return &IgnoreMatcher{
+		base:     compileIgnorePatterns(patterns),
+		patterns: make(map[string][]ignorePattern),
+	}
+}
+
+// Add appends patterns applying from a directory (relative slash-separated path, "" for root). Later patterns take
+// precedence over previous ones.
+func (m *IgnoreMatcher) Add(dir string, patterns []string) {
+	compiled := compileIgnorePatterns(patterns)
+	if len(compiled) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.patterns[dir] = append(m.patterns[dir], compiled...)
+}
+
+// LoadFile reads patterns from an IgnoreFile within the given directory (dir is its path relative to root).
+// Patterns previously loaded from the same file are replaced. Does nothing if the file does not exist.
+func (m *IgnoreMatcher) LoadFile(root, dir string) error {
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(dir), IgnoreFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	compiled := compileIgnorePatterns(lines)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(compiled) == 0 {
+		delete(m.patterns, dir)
+	} else {
+		m.patterns[dir] = compiled
+	}
+	return nil
+}
+
+// Match verifies if a path (relative, slash-separated) is ignored. A path is ignored as well if any of its parent
+// directories are, as git does not allow re-including files from an ignored directory.
+func (m *IgnoreMatcher) Match(rel string, isDir bool) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.base) == 0 && len(m.patterns) == 0 {
+		return false
+	}
+	rel = strings.Trim(rel, "/")
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' && m.match(rel[:i], true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// match evaluates a path against patterns of every parent directory (from root to deepest). Last matching pattern
+// wins.
+func (m *IgnoreMatcher) match(rel string, isDir bool) bool {
+	ignored := matchIgnorePatterns(m.base, rel, isDir, false)
+	dir := ""
+	for {
+		target := rel
+		if dir != "" {
+			target = rel[len(dir)+1:]
+		}
+		ignored = matchIgnorePatterns(m.patterns[dir], target, isDir, ignored)
+		next := strings.IndexByte(target, '/')
+		if next < 0 {
+			return ignored
+		} else if dir == "" {
+			dir = rel[:next]
+		} else {
+			dir = rel[:len(dir)+1+next]
+		}
+	}
+}
+
+// matchIgnorePatterns evaluates a path against patterns, returning the result of the last matching pattern or
+// ignored if none matched.
+func matchIgnorePatterns(patterns []ignorePattern, rel string, isDir, ignored bool) bool {
+	for _, p := range patterns {
+		if (!p.dirOnly || isDir) && p.re.MatchString(rel) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// compileIgnorePatterns converts gitignore pattern lines into ignorePattern, skipping blank lines and comments.
+func compileIgnorePatterns(lines []string) []ignorePattern {
+	compiled := make([]ignorePattern, 0, len(lines))
+	for _, line := range lines {
+		if pattern, ok := compileIgnorePattern(line); ok {
+			compiled = append(compiled, pattern)
+		}
+	}
+	return compiled
+}
+
+// compileIgnorePattern converts a gitignore pattern line into an ignorePattern. Returns false for blank lines and
+// comments.
+func compileIgnorePattern(line string) (ignorePattern, bool) {
+	line = trimIgnoreTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+	p := ignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	// patterns with a slash at the beginning or middle are relative to its directory, others match at any level
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr := strings.Builder{}
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '*' && strings.HasPrefix(line[i:], "**/") && (i == 0 || line[i-1] == '/'):
+			expr.WriteString("(?:.*/)?") // zero or more directories
+			i += 2
+		case c == '*' && line[i:] == "**" && i > 0 && line[i-1] == '/':
+			expr.WriteString(".*") // everything inside
+			i++
+		case c == '*':
+			for i+1 < len(line) && line[i+1] == '*' {
+				i++ // other consecutive asterisks are regular asterisks
+			}
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end, class := translateIgnoreClass(line[i:])
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			expr.WriteString(class)
+			i += end
+		case c == '\\' && i+1 < len(line):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(line[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return ignorePattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+// translateIgnoreClass converts a bracket expression (e.g. [a-z], [!0-9]) at the start of s into a regular expression
+// character class. Returns the index of the closing bracket, or -1 if it is not closed.
+func translateIgnoreClass(s string) (int, string) {
+	i := 1
+	negate := false
+	if i < len(s) && (s[i] == '!' || s[i] == '^') {
+		negate = true
+		i++
+	}
+	start := i
+	if i < len(s) && s[i] == ']' {
+		i++ // literal closing bracket at the beginning
+	}
+	for i < len(s) && s[i] != ']' {
+		i++
+	}
+	if i >= len(s) {
+		return -1, ""
+	}
+	body := strings.ReplaceAll(s[start:i], `\`, `\\`)
+	body = strings.ReplaceAll(body, "[", `\[`)
+	body = strings.ReplaceAll(body, "]", `\]`)
+	if negate {
+		return i, "[^/" + body + "]"
+	}
+	return i, "[" + body + "]"
+}
+
+// trimIgnoreTrailingSpaces removes trailing spaces from a pattern line unless they are escaped with a backslash.
+func trimIgnoreTrailingSpaces(line string) string {
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-2] + " "
+	}
+	return line
+}
+
+// relativeSlashPath retrieves a path relative to root using forward slashes, as evaluated by IgnoreMatcher.
+func relativeSlashPath(root, p string) (string, error) {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return "", err
+	}
+	rel = path.Clean(filepath.ToSlash(rel))
+	if rel == "." {
+		return "", nil
+	}
+	return rel, nil
+}
@@ -0,0 +1,134 @@
+package cloudsync_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreMatcher_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		exp      bool
+	}{
+		{name: "Empty", patterns: nil, path: "foo.txt", exp: false},
+		{name: "Comment", patterns: []string{"#foo.txt"}, path: "#foo.txt", exp: false},
+		{name: "Escaped comment", patterns: []string{`\#foo.txt`}, path: "#foo.txt", exp: true},
+		{name: "Name", patterns: []string{"foo.txt"}, path: "bar/foo.txt", exp: true},
+		{name: "Extension", patterns: []string{"*.go"}, path: "bar/foo.go", exp: true},
+		{name: "Extension mismatch", patterns: []string{"*.go"}, path: "bar/foo.golden", exp: false},
+		{name: "Backup suffix", patterns: []string{"*.tmp~"}, path: "foo.tmp~", exp: true},
+		{name: "Question mark", patterns: []string{"foo.?"}, path: "foo.c", exp: true},
+		{name: "Class", patterns: []string{"foo.[ch]"}, path: "foo.h", exp: true},
+		{name: "Negated class", patterns: []string{"foo.[!ch]"}, path: "foo.h", exp: false},
+		{name: "Range", patterns: []string{"log[0-9].txt"}, path: "log7.txt", exp: true},
+		{name: "Directory only", patterns: []string{"node_modules/"}, path: "a/node_modules", isDir: true, exp: true},
+		{name: "Directory only file", patterns: []string{"node_modules/"}, path: "a/node_modules", exp: false},
+		{name: "Directory children", patterns: []string{"node_modules/"}, path: "a/node_modules/b/c.js", exp: true},
+		{name: "Anchored", patterns: []string{"/foo.txt"}, path: "foo.txt", exp: true},
+		{name: "Anchored nested", patterns: []string{"/foo.txt"}, path: "bar/foo.txt", exp: false},
+		{name: "Middle slash", patterns: []string{"docs/*.md"}, path: "docs/foo.md", exp: true},
+		{name: "Middle slash nested", patterns: []string{"docs/*.md"}, path: "docs/foo/bar.md", exp: false},
+		{name: "Middle slash anchored", patterns: []string{"docs/*.md"}, path: "foo/docs/bar.md", exp: false},
+		{name: "Leading double asterisk", patterns: []string{"**/build"}, path: "a/b/build", isDir: true, exp: true},
+		{name: "Trailing double asterisk", patterns: []string{"build/**"}, path: "build/a/b.o", exp: true},
+		{name: "Trailing double asterisk dir", patterns: []string{"build/**"}, path: "build", isDir: true, exp: false},
+		{name: "Middle double asterisk", patterns: []string{"a/**/b"}, path: "a/b", exp: true},
+		{name: "Middle double asterisk nested", patterns: []string{"a/**/b"}, path: "a/x/y/b", exp: true},
+		{name: "Negation", patterns: []string{"*.log", "!keep.log"}, path: "keep.log", exp: false},
+		{name: "Negation order", patterns: []string{"!keep.log", "*.log"}, path: "keep.log", exp: true},
+		{name: "Negation within ignored dir", patterns: []string{"logs/", "!logs/keep.log"},
+			path: "logs/keep.log", exp: true},
+		{name: "Escaped negation", patterns: []string{`\!foo.txt`}, path: "!foo.txt", exp: true},
+		{name: "Trailing spaces", patterns: []string{"foo.txt   "}, path: "foo.txt", exp: true},
+		{name: "Escaped trailing space", patterns: []string{`foo\ `}, path: "foo ", exp: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := cloudsync.NewIgnoreMatcher(tt.patterns)
+			assert.Equal(t, tt.exp, m.Match(tt.path, tt.isDir))
+		})
+	}
+}
+
+func TestIgnoreMatcher_LoadFile(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "foo", "bar"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(root, cloudsync.IgnoreFile), []byte("# root\n*.log\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo", cloudsync.IgnoreFile),
+		[]byte("!keep.log\n/baz.txt\n"), 0644))
+
+	m := cloudsync.NewIgnoreMatcher([]string{"*.txt", "!qux.txt"})
+	require.NoError(t, m.LoadFile(root, ""))
+	require.NoError(t, m.LoadFile(root, "foo"))
+	require.NoError(t, m.LoadFile(root, "foo/bar")) // not found
+
+	assert.True(t, m.Match("foo.txt", false))
+	assert.False(t, m.Match("qux.txt", false))
+	assert.True(t, m.Match("foo.log", false))
+	assert.True(t, m.Match("keep.log", false))
+	assert.False(t, m.Match("foo/keep.log", false))
+	assert.False(t, m.Match("foo/bar/keep.log", false))
+	assert.True(t, m.Match("foo/bar/foo.log", false))
+	assert.True(t, m.Match("foo/baz.txt", false))
+	assert.False(t, m.Match("foo/bar/qux.txt", false))
+
+	// patterns are replaced once loaded again
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo", cloudsync.IgnoreFile), []byte("\n"), 0644))
+	require.NoError(t, m.LoadFile(root, "foo"))
+	assert.True(t, m.Match("foo/keep.log", false))
+}
+
+func TestScanner_IgnoreFile(t *testing.T) {
+	root, remote := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		cloudsync.IgnoreFile:                  "build/\n*.tmp\n",
+		"foo.txt":                             "",
+		"foo.tmp":                             "",
+		"build/foo.o":                         "",
+		"docs/" + cloudsync.IgnoreFile:        "!keep.tmp\n*.md\n",
+		"docs/keep.tmp":                       "",
+		"docs/foo.md":                         "",
+		"docs/foo.txt":                        "",
+		"docs/guides/keep.tmp":                "",
+		"docs/guides/bar.md":                  "",
+		"docs/guides/" + cloudsync.IgnoreFile: "!bar.md\n",
+		"src/main.go":                         "",
+		"src/main.tmp":                        "",
+		"src/node_modules/foo/index.js":       "",
+		"src/" + cloudsync.IgnoreFile + ".backup": "",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	}
+	cfg := cloudsync.Config{
+		RootDirectory: root,
+		Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+		Scanner: cloudsync.ScannerConfig{
+			DeepTraversing: true,
+			IgnoredKeys:    []string{"node_modules/", "*.backup"},
+		},
+	}
+	require.NoError(t, cloudsync.NewScanner(cfg).Start(storage.NewLocalFS(cfg)))
+
+	keys := listRemoteKeys(t, remote)
+	assert.Equal(t, strings.Join([]string{
+		"docs/foo.txt",
+		"docs/guides/bar.md",
+		"docs/guides/keep.tmp",
+		"docs/keep.tmp",
+		"foo.txt",
+		"src/main.go",
+	}, ","), strings.Join(keys, ","))
+}
@@ -0,0 +1,121 @@
+package cloudsync
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultIndexFile file name of the local state index stored next to the configuration file if
+// ScannerConfig.IndexFile was not set.
+const DefaultIndexFile = "index.db"
+
+// ErrIndexEntryNotFound the requested key has no entry in the Index.
+var ErrIndexEntryNotFound = errors.New("cloudsync: Index entry not found")
+
+// IndexEntry local state of a file recorded after its latest synchronization.
+type IndexEntry struct {
+	// Key object key the file was stored with.
+	Key string `json:"key"`
+	// Size file size (in bytes) by the time it was synchronized.
+	Size int64 `json:"size"`
+	// ModTime file modification time by the time it was synchronized.
+	ModTime time.Time `json:"mod_time"`
+	// Checksum base64-encoded SHA-256 checksum of the uploaded file. Empty if the file was not uploaded by
+	// this host (i.e. it already existed in the blob storage) or no checksum was calculated (see
+	// MetadataKeyChecksum).
+	Checksum string `json:"checksum,omitempty"`
+	// SyncedAt time the file was uploaded or verified against the blob storage.
+	SyncedAt time.Time `json:"synced_at"`
+	// LastError result of the latest upload attempt; empty if it succeeded.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// IsSynced indicates if a file with the given size and modification time was already synchronized.
+func (e IndexEntry) IsSynced(modTime time.Time, size int64) bool {
+	return e.LastError == "" && e.Size == size && e.ModTime.Equal(modTime)
+}
+
+// Index persistent store of files local state, used by Scanner to skip files unchanged since their latest
+// successful synchronization without calling BlobStorage.CheckMod.
+//
+// Implementations MUST be goroutine-safe as they are used by several workers at the same time.
+type Index interface {
+	// Get retrieves an entry using its key. Returns ErrIndexEntryNotFound if no entry was found.
+	Get(key string) (IndexEntry, error)
+	// Put stores (or replaces) an entry.
+	Put(entry IndexEntry) error
+	// Delete removes an entry using its key. Does nothing if no entry was found.
+	Delete(key string) error
+	// Close releases resources used by the Index.
+	Close() error
+}
+
+// BoltIndex Index implementation using an embedded bbolt database file.
+//
+// Entries are grouped by a namespace (e.g. a blob storage driver and bucket), so a single file may be shared by
+// different blob storages.
+type BoltIndex struct {
+	db        *bolt.DB
+	namespace []byte
+}
+
+var _ Index = &BoltIndex{}
+
+// OpenBoltIndex opens (or creates) a bbolt database file, storing entries within the given namespace.
+//
+// Fails if the file is locked by another process for more than a second.
+func OpenBoltIndex(path, namespace string) (*BoltIndex, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	idx := &BoltIndex{
+		db:        db,
+		namespace: []byte(namespace),
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, errBucket := tx.CreateBucketIfNotExists(idx.namespace)
+		return errBucket
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+func (b *BoltIndex) Get(key string) (IndexEntry, error) {
+	entry := IndexEntry{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(b.namespace).Get([]byte(key))
+		if data == nil {
+			return ErrIndexEntryNotFound
+		}
+		return json.Unmarshal(data, &entry)
+	})
+	return entry, err
+}
+
+func (b *BoltIndex) Put(entry IndexEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// batching coalesces writes from several workers into a single disk sync
+	return b.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.namespace).Put([]byte(entry.Key), data)
+	})
+}
+
+func (b *BoltIndex) Delete(key string) error {
+	return b.db.Batch(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.namespace).Delete([]byte(key))
+	})
+}
+
+func (b *BoltIndex) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,57 @@
+package cloudsync_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	idx, err := cloudsync.OpenBoltIndex(path, "foo")
+	require.NoError(t, err)
+
+	_, err = idx.Get("123/foo.txt")
+	assert.ErrorIs(t, err, cloudsync.ErrIndexEntryNotFound)
+
+	modTime := time.Now().Add(-time.Hour)
+	entry := cloudsync.IndexEntry{
+		Key:      "123/foo.txt",
+		Size:     3,
+		ModTime:  modTime,
+		Checksum: "LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=",
+		SyncedAt: time.Now().UTC(),
+	}
+	require.NoError(t, idx.Put(entry))
+	require.NoError(t, idx.Close())
+
+	// entries are persisted and isolated by namespace
+	idx, err = cloudsync.OpenBoltIndex(path, "bar")
+	require.NoError(t, err)
+	_, err = idx.Get("123/foo.txt")
+	assert.ErrorIs(t, err, cloudsync.ErrIndexEntryNotFound)
+	require.NoError(t, idx.Close())
+
+	idx, err = cloudsync.OpenBoltIndex(path, "foo")
+	require.NoError(t, err)
+	defer idx.Close()
+	out, err := idx.Get("123/foo.txt")
+	require.NoError(t, err)
+	assert.Equal(t, entry.Key, out.Key)
+	assert.Equal(t, entry.Checksum, out.Checksum)
+	assert.True(t, out.IsSynced(modTime, 3))
+	assert.False(t, out.IsSynced(modTime, 4))
+	assert.False(t, out.IsSynced(modTime.Add(time.Second), 3))
+
+	out.LastError = "foo error"
+	assert.False(t, out.IsSynced(modTime, 3))
+
+	require.NoError(t, idx.Delete("123/foo.txt"))
+	require.NoError(t, idx.Delete("123/bar.txt"))
+	_, err = idx.Get("123/foo.txt")
+	assert.ErrorIs(t, err, cloudsync.ErrIndexEntryNotFound)
+}
@@ -0,0 +1,220 @@
+package cloudsync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultJournalFile file name of the failed jobs journal stored next to the configuration file if
+// ScannerConfig.JournalFile was not set.
+const DefaultJournalFile = "failed_jobs.jsonl"
+
+// FailedJob a file which could not be checked or uploaded, recorded by Scanner into a Journal.
+type FailedJob struct {
+	// Key object key the file was (or would be) stored with.
+	Key string `json:"key"`
+	// Path absolute path of the file in host's file system.
+	Path string `json:"path"`
+	// Error result of the latest attempt.
+	Error string `json:"error,omitempty"`
+	// Attempts number of times the job was executed before giving up.
+	Attempts int `json:"attempts,omitempty"`
+	// FailedAt time of the latest attempt.
+	FailedAt time.Time `json:"failed_at"`
+	// Resolved indicates the job succeeded afterwards. Only used internally by journal files.
+	Resolved bool `json:"resolved,omitempty"`
+}
+
+// Journal persistent store of failed jobs, used to retry files which could not be synchronized without traversing
+// the whole directory tree again (see Scanner.RetryFailed).
+//
+// Implementations MUST be goroutine-safe as they are used by several workers at the same time.
+type Journal interface {
+	// Record stores (or replaces) a failed job using its key.
+	Record(job FailedJob) error
+	// Resolve removes a failed job using its key. Does nothing if no job was recorded.
+	Resolve(key string) error
+	// FailedJobs retrieves every job recorded and not resolved yet, sorted by key.
+	FailedJobs() []FailedJob
+	// Close releases resources used by the Journal.
+	Close() error
+}
+
+// FileJournal Journal implementation using an append-only JSON Lines file. The file is compacted every time it gets
+// opened, so only unresolved jobs are kept.
+type FileJournal struct {
+	mu   sync.Mutex
+	f    *os.File
+	jobs map[string]FailedJob
+}
+
+var _ Journal = &FileJournal{}
+
+// OpenFileJournal opens (or creates) a journal file, loading its unresolved jobs.
+func OpenFileJournal(path string) (*FileJournal, error) {
+	jobs, err := readJournalFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// compaction: write unresolved jobs into a temporary file which then replaces the journal. Temporary files are
+	// unique, so concurrent processes opening the same journal never write into each other's file.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	j := &FileJournal{
+		f:    f,
+		jobs: jobs,
+	}
+	for _, job := range j.FailedJobs() {
+		if err = j.write(job); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return j, nil
+}
+
+// readJournalFile reads every job from a journal file, keeping the latest line of each key. Resolved jobs are
+// discarded.
+func readJournalFile(path string) (map[string]FailedJob, error) {
+	jobs := make(map[string]FailedJob)
+	f, err := os.Open(filepath.Clean(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return jobs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		job := FailedJob{}
+		if errJSON := json.Unmarshal(scanner.Bytes(), &job); errJSON != nil {
+			continue // partially written line (e.g. process was killed)
+		}
+		if job.Resolved {
+			delete(jobs, job.Key)
+			continue
+		}
+		jobs[job.Key] = job
+	}
+	return jobs, scanner.Err()
+}
+
+func (j *FileJournal) write(job FailedJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = j.f.Write(append(data, '\n'))
+	return err
+}
+
+func (j *FileJournal) Record(job FailedJob) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jobs[job.Key] = job
+	return j.write(job)
+}
+
+func (j *FileJournal) Resolve(key string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.jobs[key]; !ok {
+		return nil
+	}
+	delete(j.jobs, key)
+	return j.write(FailedJob{
+		Key:      key,
+		FailedAt: time.Now().UTC(),
+		Resolved: true,
+	})
+}
+
+func (j *FileJournal) FailedJobs() []FailedJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]FailedJob, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].Key < jobs[b].Key
+	})
+	return jobs
+}
+
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Close()
+}
+
+// RetryFailed runs internal processes to check and, if required, upload the files of the given failed jobs (e.g.
+// read from a Journal) without traversing any source (see Config.Sources). Jobs keep their recorded object keys.
+//
+// Files no longer found are skipped and removed from the Journal (if any).
+//
+// Blocks until every file was checked and, if required, uploaded or until the Scanner gets shut down.
+func (s *Scanner) RetryFailed(store BlobStorage, jobs []FailedJob) error {
+	s.localKeys = nil
+	return s.run(context.Background(), store, func(ctx context.Context) error {
+		log.Info().
+			Int("total_jobs", len(jobs)).
+			Msg("Starting failed jobs retry")
+		for _, job := range jobs {
+			info, err := os.Lstat(job.Path)
+			switch {
+			case errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()):
+				log.Warn().Str("path", job.Path).Msg("cloudsync: File no longer exists, skipping")
+				s.resolveFailedJob(job.Key)
+				continue
+			case err != nil:
+				s.objectUploadJobQueueErr <- ErrFileUpload{
+					Key:    job.Key,
+					Path:   job.Path,
+					Parent: err,
+				}
+				continue
+			case info.Mode()&fs.ModeSymlink != 0:
+				if err = s.scheduleFailedLink(ctx, job, info); err != nil {
+					return err
+				}
+				continue
+			}
+			err = s.scheduleJob(ctx, fileJob{
+				path:   job.Path,
+				key:    job.Key,
+				info:   info,
+				source: s.sourceOf(job.Path),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,162 @@
+package cloudsync_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), cloudsync.DefaultJournalFile)
+	journal, err := cloudsync.OpenFileJournal(path)
+	require.NoError(t, err)
+	assert.Empty(t, journal.FailedJobs())
+
+	failedAt := time.Now().UTC().Truncate(time.Second)
+	for _, key := range []string{"123/foo.txt", "123/bar.txt", "123/baz.txt"} {
+		require.NoError(t, journal.Record(cloudsync.FailedJob{
+			Key:      key,
+			Path:     filepath.Join("/home/foo", key),
+			Error:    "foo error",
+			Attempts: 1,
+			FailedAt: failedAt,
+		}))
+	}
+	require.NoError(t, journal.Record(cloudsync.FailedJob{
+		Key:      "123/foo.txt",
+		Path:     "/home/foo/123/foo.txt",
+		Error:    "bar error",
+		Attempts: 3,
+		FailedAt: failedAt,
+	}))
+	require.NoError(t, journal.Resolve("123/bar.txt"))
+	require.NoError(t, journal.Resolve("123/qux.txt"))
+	require.NoError(t, journal.Close())
+
+	// jobs are persisted and compacted
+	journal, err = cloudsync.OpenFileJournal(path)
+	require.NoError(t, err)
+	defer journal.Close()
+	jobs := journal.FailedJobs()
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "123/baz.txt", jobs[0].Key)
+	assert.Equal(t, cloudsync.FailedJob{
+		Key:      "123/foo.txt",
+		Path:     "/home/foo/123/foo.txt",
+		Error:    "bar error",
+		Attempts: 3,
+		FailedAt: failedAt,
+	}, jobs[1])
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, countLines(data))
+}
+
+func TestOpenFileJournal_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, cloudsync.DefaultJournalFile)
+	journal, err := cloudsync.OpenFileJournal(path)
+	require.NoError(t, err)
+	require.NoError(t, journal.Record(cloudsync.FailedJob{Key: "123/foo.txt", Path: "/home/foo/123/foo.txt"}))
+	require.NoError(t, journal.Close())
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			j, errOpen := cloudsync.OpenFileJournal(path)
+			if errOpen == nil {
+				errOpen = j.Close()
+			}
+			errs <- errOpen
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	journal, err = cloudsync.OpenFileJournal(path)
+	require.NoError(t, err)
+	defer journal.Close()
+	assert.Len(t, journal.FailedJobs(), 1)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1) // no temporary files left behind
+}
+
+func countLines(data []byte) int {
+	n := 0
+	for _, b := range data {
+		if b == '\n' {
+			n++
+		}
+	}
+	return n
+}
+
+// failingBlobStorage cloudsync.BlobStorage implementation failing every upload while Err is set.
+type failingBlobStorage struct {
+	*storage.LocalFS
+	Err error
+}
+
+func (f failingBlobStorage) Upload(ctx context.Context, obj cloudsync.Object) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	return f.LocalFS.Upload(ctx, obj)
+}
+
+func TestScanner_RetryFailed(t *testing.T) {
+	root, remote := t.TempDir(), t.TempDir()
+	for _, name := range []string{"foo.txt", "bar.txt", "baz.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(name), 0644))
+	}
+	journal, err := cloudsync.OpenFileJournal(filepath.Join(t.TempDir(), cloudsync.DefaultJournalFile))
+	require.NoError(t, err)
+	defer journal.Close()
+	cfg := cloudsync.Config{
+		RootDirectory: root,
+		Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+		Scanner: cloudsync.ScannerConfig{
+			PartitionID: "123",
+			Retry:       cloudsync.RetryPolicy{MaxAttempts: 2, BaseBackoff: time.Millisecond},
+		},
+	}
+	uploadErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED} // transient, retried
+	store := failingBlobStorage{LocalFS: storage.NewLocalFS(cfg), Err: uploadErr}
+
+	scanner := cloudsync.NewScanner(cfg)
+	scanner.SetJournal(journal)
+	require.NoError(t, scanner.Start(store))
+	jobs := journal.FailedJobs()
+	require.Len(t, jobs, 3)
+	assert.Equal(t, "123/bar.txt", jobs[0].Key)
+	assert.Equal(t, filepath.Join(root, "bar.txt"), jobs[0].Path)
+	assert.Equal(t, uploadErr.Error(), jobs[0].Error)
+	assert.Equal(t, 2, jobs[0].Attempts)
+
+	// files are retried without traversing the root directory; removed files are discarded
+	require.NoError(t, os.Remove(filepath.Join(root, "baz.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "qux.txt"), []byte("qux.txt"), 0644))
+	store.Err = nil
+	scanner = cloudsync.NewScanner(cloudsync.Config{Cloud: cfg.Cloud})
+	scanner.SetJournal(journal)
+	require.NoError(t, scanner.RetryFailed(store, jobs))
+	assert.Equal(t, uint64(2), scanner.Stats().GetTotalUploadJobs())
+	assert.Empty(t, journal.FailedJobs())
+	for _, key := range []string{"foo.txt", "bar.txt"} {
+		_, err = os.Stat(filepath.Join(remote, "123", key))
+		assert.NoError(t, err, key)
+	}
+	_, err = os.Stat(filepath.Join(remote, "123", "qux.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,268 @@
+package cloudsync
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultKeyTemplate object key template used if ScannerConfig.KeyTemplate was not set.
+const DefaultKeyTemplate = "{partition}/{prefix}/{relpath}"
+
+// ErrInvalidKeyTemplate the specified key template (see ScannerConfig.KeyTemplate) could not be parsed or is not
+// supported by an operation.
+var ErrInvalidKeyTemplate = errors.New("cloudsync: Invalid key template")
+
+// Key template placeholders.
+const (
+	keyPartition = "partition" // partition ID
+	keyPrefix    = "prefix"    // source key prefix
+	keyHostname  = "hostname"  // host name
+	keyUsername  = "username"  // current user name
+	keyRoot      = "root"      // source root directory name
+	keyRelPath   = "relpath"   // file path relative to the root directory
+	keyDir       = "dir"       // file directory relative to the root directory
+	keyName      = "name"      // file name
+	keyStem      = "stem"      // file name without extension
+	keyExt       = "ext"       // file extension without leading dot
+	keyYear      = "yyyy"      // file modification year (UTC)
+	keyMonth     = "mm"        // file modification month (UTC)
+	keyDay       = "dd"        // file modification day (UTC)
+	keySHA256    = "sha256"    // hex-encoded SHA-256 checksum of file data
+)
+
+// keyStaticPlaceholders placeholders whose values are the same for every file within a source.
+var keyStaticPlaceholders = map[string]struct{}{
+	keyPartition: {}, keyPrefix: {}, keyHostname: {}, keyUsername: {}, keyRoot: {},
+}
+
+// keyFilePlaceholders placeholders whose values depend on each file.
+var keyFilePlaceholders = map[string]struct{}{
+	keyRelPath: {}, keyDir: {}, keyName: {}, keyStem: {}, keyExt: {}, keyYear: {}, keyMonth: {}, keyDay: {},
+	keySHA256: {},
+}
+
+// keyTransforms functions applied to placeholder values (e.g. {relpath|lower|nfc}).
+var keyTransforms = map[string]func(string) string{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"nfc":   norm.NFC.String,
+}
+
+// keyToken a literal text or a placeholder along its transforms.
+type keyToken struct {
+	literal     string
+	placeholder string
+	transforms  []func(string) string
+}
+
+// keyTemplate a parsed object key template (e.g. {partition}/{hostname}/{yyyy}/{mm}/{relpath}).
+type keyTemplate struct {
+	tokens []keyToken
+	// static values of static placeholders, resolved once per source.
+	static map[string]string
+}
+
+// parseKeyTemplate parses a template composed of literal text and placeholders wrapped in braces. Placeholders may
+// be followed by transforms separated by pipes (e.g. {name|lower}). Returns ErrInvalidKeyTemplate if a placeholder
+// or transform is unknown, or if no placeholder identifies files (e.g. {relpath}).
+func parseKeyTemplate(template string) (*keyTemplate, error) {
+	raw := template
+	t := &keyTemplate{}
+	for template != "" {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			t.tokens = append(t.tokens, keyToken{literal: template})
+			break
+		} else if start > 0 {
+			t.tokens = append(t.tokens, keyToken{literal: template[:start]})
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unclosed placeholder in %q", ErrInvalidKeyTemplate, raw)
+		}
+		parts := strings.Split(template[start+1:start+end], "|")
+		token := keyToken{placeholder: strings.TrimSpace(parts[0])}
+		_, isStatic := keyStaticPlaceholders[token.placeholder]
+		if _, isFile := keyFilePlaceholders[token.placeholder]; !isStatic && !isFile {
+			return nil, fmt.Errorf("%w: unknown placeholder {%s}", ErrInvalidKeyTemplate, token.placeholder)
+		}
+		for _, name := range parts[1:] {
+			transform, ok := keyTransforms[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown transform %s", ErrInvalidKeyTemplate, name)
+			}
+			token.transforms = append(token.transforms, transform)
+		}
+		t.tokens = append(t.tokens, token)
+		template = template[start+end+1:]
+	}
+	if !t.uses(keyRelPath, keyName, keyStem, keySHA256) {
+		return nil, fmt.Errorf("%w: a file placeholder ({relpath}, {name}, {stem} or {sha256}) is required",
+			ErrInvalidKeyTemplate)
+	}
+	return t, nil
+}
+
+// newSourceKeyTemplate parses a source's key template, resolving its static placeholders.
+func newSourceKeyTemplate(template, partitionID, sourcePrefix, root string) (*keyTemplate, error) {
+	t, err := parseKeyTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	username := ""
+	if u, errUser := user.Current(); errUser == nil {
+		username = u.Username
+	}
+	if abs, errAbs := filepath.Abs(root); errAbs == nil {
+		root = abs
+	}
+	t.static = map[string]string{
+		keyPartition: partitionID,
+		keyPrefix:    sourcePrefix,
+		keyHostname:  hostname,
+		keyUsername:  strings.ReplaceAll(username, "\\", "_"), // e.g. DOMAIN\user
+		keyRoot:      filepath.Base(root),
+	}
+	return t, nil
+}
+
+// staticPrefix retrieves the key prefix shared by every object built using the template (i.e. complete segments
+// rendered from static tokens before the first file placeholder). Returns true if the rest of the template is
+// {relpath} only, so keys could be mapped back to relative paths.
+func (t *keyTemplate) staticPrefix() (string, bool) {
+	b := strings.Builder{}
+	i := 0
+	for ; i < len(t.tokens); i++ {
+		if _, isStatic := keyStaticPlaceholders[t.tokens[i].placeholder]; t.tokens[i].placeholder != "" && !isStatic {
+			break
+		}
+		b.WriteString(t.renderToken(t.tokens[i], nil))
+	}
+	// static text might be part of a file segment (e.g. backup-{relpath})
+	rendered, prefix := b.String(), ""
+	if idx := strings.LastIndexByte(rendered, '/'); idx >= 0 {
+		prefix = cleanObjectKey(rendered[:idx])
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	isRelPath := i == len(t.tokens)-1 && t.tokens[i].placeholder == keyRelPath && len(t.tokens[i].transforms) == 0
+	return prefix, isRelPath && (rendered == "" || strings.HasSuffix(rendered, "/"))
+}
+
+// render builds the object key of a file using the given file placeholder values.
+func (t *keyTemplate) render(values map[string]string) string {
+	b := strings.Builder{}
+	for _, token := range t.tokens {
+		b.WriteString(t.renderToken(token, values))
+	}
+	return cleanObjectKey(b.String())
+}
+
+func (t *keyTemplate) renderToken(token keyToken, values map[string]string) string {
+	if token.placeholder == "" {
+		return token.literal
+	}
+	value, ok := t.static[token.placeholder]
+	if !ok {
+		value = values[token.placeholder]
+	}
+	for _, transform := range token.transforms {
+		value = transform(value)
+	}
+	return value
+}
+
+// uses verifies if any of the given placeholders is used by the template.
+func (t *keyTemplate) uses(placeholders ...string) bool {
+	for _, token := range t.tokens {
+		for _, placeholder := range placeholders {
+			if token.placeholder == placeholder {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fileKeyValues resolves file placeholder values of a job (info is required only if the template uses
+// modification date placeholders).
+//
+// The file's digest is stored into the job when the template uses the {sha256} placeholder.
+func (t *keyTemplate) fileKeyValues(rel string, job *fileJob) (map[string]string, error) {
+	rel = strings.ReplaceAll(rel, "\\", "/")
+	name := path.Base(rel)
+	ext := path.Ext(name)
+	values := map[string]string{
+		keyRelPath: rel,
+		keyName:    name,
+		keyStem:    strings.TrimSuffix(name, ext),
+		keyExt:     strings.TrimPrefix(ext, "."),
+	}
+	if dir := path.Dir(rel); dir != "." {
+		values[keyDir] = dir
+	}
+	if t.uses(keyYear, keyMonth, keyDay) {
+		if job.info == nil {
+			return nil, fmt.Errorf("%w: missing file modification time", ErrInvalidKeyTemplate)
+		}
+		modTime := job.info.ModTime().UTC()
+		values[keyYear] = modTime.Format("2006")
+		values[keyMonth] = modTime.Format("01")
+		values[keyDay] = modTime.Format("02")
+	}
+	if t.uses(keySHA256) {
+		digest, err := job.sha256Digest()
+		if err != nil {
+			return nil, err
+		}
+		values[keySHA256] = hex.EncodeToString(digest)
+	}
+	return values, nil
+}
+
+// cleanObjectKey removes empty segments (e.g. placeholders with no value) and leading or trailing slashes from a key.
+func cleanObjectKey(key string) string {
+	segments := strings.Split(key, "/")
+	cleaned := segments[:0]
+	for _, segment := range segments {
+		if segment != "" {
+			cleaned = append(cleaned, segment)
+		}
+	}
+	return strings.Join(cleaned, "/")
+}
+
+// objectKey builds the object key of a file within the source using its key template (see
+// ScannerConfig.KeyTemplate).
+func (src *scanSource) objectKey(job *fileJob) (string, error) {
+	rel, err := filepath.Rel(src.root, job.path)
+	if err != nil {
+		return "", err
+	}
+	values, err := src.keyTemplate.fileKeyValues(rel, job)
+	if err != nil {
+		return "", err
+	}
+	return src.keyTemplate.render(values), nil
+}
+
+// failedObjectKey builds the object key of a file which could not be read, falling back to its relative path if the
+// key template requires file properties.
+func (src *scanSource) failedObjectKey(path string, info fs.FileInfo) string {
+	if key, err := src.objectKey(&fileJob{path: path, info: info}); err == nil {
+		return key
+	}
+	rel, _ := filepath.Rel(src.root, path)
+	return strings.ReplaceAll(rel, "\\", "/")
+}
@@ -0,0 +1,145 @@
+package cloudsync_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_KeyTemplate(t *testing.T) {
+	root := t.TempDir()
+	modTime := time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"Foo.TXT", "docs/Bar.md", "docs/é.txt", "Makefile"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, []byte("foo"), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	const fooSHA256 = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	tests := []struct {
+		name     string
+		template string
+		expKeys  []string
+	}{
+		{
+			name:    "Default",
+			expKeys: []string{"machine/Foo.TXT", "machine/Makefile", "machine/docs/Bar.md", "machine/docs/é.txt"},
+		},
+		{
+			name:     "Date",
+			template: "{partition}/{yyyy}/{mm}/{dd}/{relpath|nfc|lower}",
+			expKeys: []string{
+				"machine/2023/03/10/docs/bar.md",
+				"machine/2023/03/10/docs/é.txt",
+				"machine/2023/03/10/foo.txt",
+				"machine/2023/03/10/makefile",
+			},
+		},
+		{
+			name:     "Content addressed",
+			template: "{ext|lower}/{sha256}",
+			expKeys:  []string{fooSHA256, "md/" + fooSHA256, "txt/" + fooSHA256},
+		},
+		{
+			name:     "Root and file name",
+			template: "{root}/{dir}/{stem|upper}-{ext}",
+			expKeys: []string{
+				filepath.Base(root) + "/FOO-TXT",
+				filepath.Base(root) + "/MAKEFILE-",
+				filepath.Base(root) + "/docs/BAR-md",
+				filepath.Base(root) + "/docs/É-txt",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := t.TempDir()
+			cfg := cloudsync.Config{
+				RootDirectory: root,
+				Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+				Scanner: cloudsync.ScannerConfig{
+					PartitionID:    "machine",
+					DeepTraversing: true,
+					KeyTemplate:    tt.template,
+				},
+			}
+			require.NoError(t, cloudsync.NewScanner(cfg).Start(storage.NewLocalFS(cfg)))
+			assert.Equal(t, strings.Join(tt.expKeys, ","), strings.Join(listRemoteKeys(t, remote), ","))
+		})
+	}
+}
+
+func TestScanner_SourceKeyTemplate(t *testing.T) {
+	docs, logs, remote := t.TempDir(), t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(docs, "a.txt"), []byte("foo"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(logs, "b.log"), []byte("foo"), 0644))
+	cfg := cloudsync.Config{
+		Cloud: cloudsync.CloudConfig{LocalPath: remote},
+		Scanner: cloudsync.ScannerConfig{
+			KeyTemplate: "backup/{prefix}/{relpath}",
+			Sources: []cloudsync.SourceConfig{
+				{Path: docs, KeyPrefix: "docs"},
+				{Path: logs, KeyPrefix: "logs", KeyTemplate: "{prefix}/{ext}/{name}"},
+			},
+		},
+	}
+	require.NoError(t, cloudsync.NewScanner(cfg).Start(storage.NewLocalFS(cfg)))
+	assert.Equal(t, []string{"backup/docs/a.txt", "logs/log/b.log"}, listRemoteKeys(t, remote))
+}
+
+func TestScanner_InvalidKeyTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{name: "Unknown placeholder", template: "{partition}/{checksum}"},
+		{name: "Unknown transform", template: "{relpath|reverse}"},
+		{name: "Unclosed placeholder", template: "{partition}/{relpath"},
+		{name: "Missing file placeholder", template: "{partition}/{yyyy}/{ext}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cloudsync.Config{
+				RootDirectory: "./testdata",
+				Scanner:       cloudsync.ScannerConfig{KeyTemplate: tt.template},
+			}
+			err := cloudsync.NewScanner(cfg).Start(cloudsync.NoopBlobStorage{})
+			assert.ErrorIs(t, err, cloudsync.ErrInvalidKeyTemplate)
+
+			cfg.Scanner.KeyTemplate = ""
+			cfg.Scanner.Sources = []cloudsync.SourceConfig{{Path: t.TempDir(), KeyTemplate: tt.template}}
+			err = cloudsync.NewScanner(cfg).Start(cloudsync.NoopBlobStorage{})
+			assert.ErrorIs(t, err, cloudsync.ErrInvalidKeyTemplate)
+		})
+	}
+}
+
+func TestScanner_KeyTemplateMirror(t *testing.T) {
+	root, remote := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("foo"), 0644))
+	cfg := cloudsync.Config{
+		RootDirectory: root,
+		Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+		Scanner: cloudsync.ScannerConfig{
+			Mirror:      true,
+			KeyTemplate: "{yyyy}/{relpath}",
+		},
+	}
+	err := cloudsync.NewScanner(cfg).Start(storage.NewLocalFS(cfg))
+	assert.ErrorIs(t, err, cloudsync.ErrInvalidKeyTemplate)
+	assert.Empty(t, listRemoteKeys(t, remote))
+
+	// keys within a static prefix could be mirrored
+	cfg.Scanner.KeyTemplate = "{partition}/{hostname}/files/{relpath}"
+	require.NoError(t, cloudsync.NewScanner(cfg).Start(storage.NewLocalFS(cfg)))
+	hostname, _ := os.Hostname()
+	assert.Equal(t, []string{hostname + "/files/a.txt"}, listRemoteKeys(t, remote))
+}
@@ -0,0 +1,69 @@
+package cloudsync
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// MetadataKeyModTime Object.Metadata key holding the modification time of the original file (RFC 3339 with
+	// nanoseconds), written along every uploaded file.
+	MetadataKeyModTime = "cloudsync_mtime"
+	// MetadataKeyMode Object.Metadata key holding the permission bits of the original file (octal, e.g. 0644).
+	MetadataKeyMode = "cloudsync_mode"
+	// MetadataKeyUID Object.Metadata key holding the user ID owning the original file. Only set on Unix hosts.
+	MetadataKeyUID = "cloudsync_uid"
+	// MetadataKeyGID Object.Metadata key holding the group ID owning the original file. Only set on Unix hosts.
+	MetadataKeyGID = "cloudsync_gid"
+)
+
+// contentSniffSize bytes read to detect the content type of files with unknown extensions (see
+// http.DetectContentType).
+const contentSniffSize = 512
+
+// FormatModTime formats a file modification time as stored by MetadataKeyModTime.
+func FormatModTime(modTime time.Time) string {
+	return modTime.UTC().Format(time.RFC3339Nano)
+}
+
+// ParseModTime parses a file modification time stored by MetadataKeyModTime.
+func ParseModTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// fileMetadata builds the metadata uploaded along a file: its checksum (if calculated), modification time,
+// permission bits, owner (if available) and, for symbolic links uploaded as links, their target path.
+//
+// The modification time is stored by every blob storage, as most of them only report upload times.
+func fileMetadata(job fileJob, checksum string) map[string]string {
+	metadata := map[string]string{
+		MetadataKeyModTime: FormatModTime(job.info.ModTime()),
+		MetadataKeyMode:    "0" + strconv.FormatUint(uint64(job.info.Mode().Perm()), 8),
+	}
+	if checksum != "" {
+		metadata[MetadataKeyChecksum] = checksum
+	}
+	if job.linkTarget != "" {
+		metadata[MetadataKeySymlink] = job.linkTarget
+	}
+	if uid, gid, ok := fileOwner(job.info); ok {
+		metadata[MetadataKeyUID], metadata[MetadataKeyGID] = uid, gid
+	}
+	return metadata
+}
+
+// detectContentType retrieves the MIME type of a file from its extension or, if unknown, by sniffing its first bytes.
+// Symbolic links uploaded as links have no content type.
+func detectContentType(job fileJob, data ReadSeekerAt) string {
+	if job.linkTarget != "" {
+		return ""
+	} else if contentType := mime.TypeByExtension(filepath.Ext(job.path)); contentType != "" {
+		return contentType
+	}
+	head := make([]byte, contentSniffSize)
+	n, _ := data.ReadAt(head, 0)
+	return http.DetectContentType(head[:n])
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cloudsync
+
+import "io/fs"
+
+// fileOwner retrieves the user and group IDs owning a file. Not available on this platform.
+func fileOwner(_ fs.FileInfo) (uid, gid string, ok bool) {
+	return "", "", false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package cloudsync
+
+import (
+	"io/fs"
+	"strconv"
+	"syscall"
+)
+
+// fileOwner retrieves the user and group IDs owning a file.
+func fileOwner(info fs.FileInfo) (uid, gid string, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", false
+	}
+	return strconv.FormatUint(uint64(stat.Uid), 10), strconv.FormatUint(uint64(stat.Gid), 10), true
+}
@@ -0,0 +1,162 @@
+package cloudsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMirrorMaxDeletePercent maximum percentage of remote objects mirror mode may remove if
+	// ScannerConfig.MirrorMaxDeletePercent was not set.
+	DefaultMirrorMaxDeletePercent = 10
+	// MirrorTrashPrefix key prefix (within the partition ID of each source) objects are moved to by mirror mode if
+	// ScannerConfig.MirrorSoftDelete was set as true. As it is hidden, objects within it are never mirrored.
+	MirrorTrashPrefix = ".trash"
+)
+
+// validateMirror verifies the given BlobStorage implements capabilities required by mirror mode and object keys of
+// every source could be mapped back to local files (see ScannerConfig.KeyTemplate).
+func (s *Scanner) validateMirror(store BlobStorage) error {
+	_, isLister := store.(BlobLister)
+	_, isDeleter := store.(BlobDeleter)
+	_, isCopier := store.(BlobCopier)
+	if !isLister || !isDeleter || (s.cfg.Scanner.MirrorSoftDelete && !isCopier) {
+		return ErrUnsupportedStorage
+	}
+	for _, src := range s.sources {
+		if !src.invertibleKeys {
+			return fmt.Errorf("%w: mirror mode requires templates ending in /{relpath} (source %s)",
+				ErrInvalidKeyTemplate, src.root)
+		}
+	}
+	return nil
+}
+
+// mirrorDeletions lists remote objects within the key prefix of every source (see Config.Sources) and deletes (or
+// moves to trash if ScannerConfig.MirrorSoftDelete was set as true) every object with no local counterpart found
+// during traversal. If key prefixes of sources overlap, objects are evaluated by the source with the longest one.
+//
+// Objects which traversing rules would skip (e.g. hidden or ignored keys) are never deleted. Nothing is deleted if
+// the given context is done, as traversal might be incomplete, nor if more than
+// ScannerConfig.MirrorMaxDeletePercent of remote objects would be removed (ErrMirrorThreshold is returned then).
+func (s *Scanner) mirrorDeletions(ctx context.Context, store BlobStorage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	totalObjects := 0
+	keys := make([]string, 0)
+	listedPrefixes := make(map[string]struct{}, len(s.sources))
+	for _, src := range s.sources {
+		if _, ok := listedPrefixes[src.keyPrefix]; ok {
+			continue
+		}
+		listedPrefixes[src.keyPrefix] = struct{}{}
+		err := listObjects(ctx, listKeys(ctx, store, src.keyPrefix), func(obj ObjectInfo) {
+			owner := s.sourceOfKey(obj.Key)
+			if strings.HasSuffix(obj.Key, "/") || owner.isKeySkipped(strings.TrimPrefix(obj.Key, owner.keyPrefix)) {
+				return // directory placeholder or out of traversal scope
+			} else if owner.keyPrefix != src.keyPrefix {
+				return // listed along the owner's prefix
+			}
+			totalObjects++
+			if _, ok := s.localKeys[obj.Key]; !ok {
+				keys = append(keys, obj.Key)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	deletePercent := float64(len(keys)) * 100 / float64(totalObjects)
+	if maxDeletePercent := *s.cfg.Scanner.MirrorMaxDeletePercent; deletePercent > maxDeletePercent {
+		return fmt.Errorf("%w: %d of %d objects (%.2f%%), maximum is %.2f%%", ErrMirrorThreshold, len(keys),
+			totalObjects, deletePercent, maxDeletePercent)
+	}
+
+	log.Info().
+		Int("total_objects", totalObjects).
+		Int("total_deletions", len(keys)).
+		Bool("soft_delete", s.cfg.Scanner.MirrorSoftDelete).
+		Msg("Starting mirror deletions")
+	for _, key := range keys {
+		src := s.sourceOfKey(key)
+		if s.cfg.Scanner.DryRun {
+			s.stats.increaseDeletedObjects()
+			src.stats.increaseDeletedObjects()
+			log.Info().Str("object_key", key).Msg("cloudsync: Would delete object")
+			continue
+		}
+		err := s.deleteObject(ctx, store, key, src.partitionPrefix)
+		switch {
+		case errors.Is(err, ErrFatalStorage) || ctx.Err() != nil:
+			return err
+		case err != nil:
+			if s.cfg.Scanner.LogErrors {
+				log.Err(err).Str("object_key", key).Msg("cloudsync: Object deletion failed")
+			}
+			s.stats.increaseFailedJobs()
+			src.stats.increaseFailedJobs()
+		default:
+			s.stats.increaseDeletedObjects()
+			src.stats.increaseDeletedObjects()
+			log.Info().Str("object_key", key).Msg("cloudsync: Deleted object")
+		}
+	}
+	return nil
+}
+
+// deleteObject removes an object from the given BlobStorage, moving it under MirrorTrashPrefix (within the given
+// partition prefix) first if ScannerConfig.MirrorSoftDelete was set as true. Its local state index entry (if any) is
+// removed as well, so the file gets uploaded again if restored locally.
+func (s *Scanner) deleteObject(ctx context.Context, store BlobStorage, key, partitionPrefix string) error {
+	if s.cfg.Scanner.MirrorSoftDelete {
+		trashKey := partitionPrefix + MirrorTrashPrefix + "/" + strings.TrimPrefix(key, partitionPrefix)
+		if err := store.(BlobCopier).Copy(ctx, key, trashKey); err != nil {
+			return err
+		}
+	}
+	if err := store.(BlobDeleter).Delete(ctx, key); err != nil {
+		return err
+	}
+	if s.index == nil {
+		return nil
+	}
+	if err := s.index.Delete(key); err != nil && s.cfg.Scanner.LogErrors {
+		log.Err(err).Str("object_key", key).Msg("cloudsync: Could not update local index")
+	}
+	return nil
+}
+
+// isKeySkipped verifies if a file stored using the given key (relative to the source's key prefix) would be skipped
+// by traversing rules (see Scanner.isDirSkipped and Scanner.isFileSkipped).
+func (src *scanSource) isKeySkipped(rel string) bool {
+	names := strings.Split(rel, "/")
+	dirs, file := names[:len(names)-1], names[len(names)-1]
+	if len(dirs) > 0 && (!src.deepTraversing || src.isTooDeep(len(dirs))) {
+		return true
+	}
+	for _, dir := range dirs {
+		if strings.HasPrefix(dir, ".") {
+			return true
+		}
+	}
+	return (strings.HasPrefix(file, ".") && !src.readHidden) || src.ignore.Match(rel, false)
+}
+
+// listKeys lists objects within a key prefix using BlobKeyLister if implemented by the given BlobStorage, as only
+// their keys are required.
+func listKeys(ctx context.Context, store BlobStorage, prefix string) ObjectIterator {
+	if lister, ok := store.(BlobKeyLister); ok {
+		return lister.ListKeys(ctx, prefix)
+	}
+	return store.(BlobLister).List(ctx, prefix)
+}
@@ -0,0 +1,144 @@
+package cloudsync_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_Mirror(t *testing.T) {
+	tests := []struct {
+		name       string
+		staleKeys  []string
+		cfg        cloudsync.ScannerConfig
+		expDeleted []string
+		expTrash   []string
+		expDeletes uint64
+		err        error
+	}{
+		{
+			name:       "Within threshold",
+			staleKeys:  []string{"baz/stale.txt"},
+			expDeleted: []string{"baz/stale.txt"},
+			expDeletes: 1,
+		},
+		{
+			name:      "Above threshold",
+			staleKeys: []string{"stale.txt", "baz/stale.txt"},
+			err:       cloudsync.ErrMirrorThreshold,
+		},
+		{
+			name:       "Custom threshold",
+			staleKeys:  []string{"stale.txt", "baz/stale.txt"},
+			cfg:        cloudsync.ScannerConfig{MirrorMaxDeletePercent: percent(100)},
+			expDeleted: []string{"stale.txt", "baz/stale.txt"},
+			expDeletes: 2,
+		},
+		{
+			name:      "Zero threshold",
+			staleKeys: []string{"baz/stale.txt"},
+			cfg:       cloudsync.ScannerConfig{MirrorMaxDeletePercent: percent(0)},
+			err:       cloudsync.ErrMirrorThreshold,
+		},
+		{
+			name:       "Soft delete",
+			staleKeys:  []string{"baz/stale.txt"},
+			cfg:        cloudsync.ScannerConfig{MirrorSoftDelete: true},
+			expDeleted: []string{"baz/stale.txt"},
+			expTrash:   []string{"baz/stale.txt"},
+			expDeletes: 1,
+		},
+		{
+			name:       "Dry run",
+			staleKeys:  []string{"baz/stale.txt"},
+			cfg:        cloudsync.ScannerConfig{DryRun: true},
+			expDeletes: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, remote := t.TempDir(), t.TempDir()
+			localKeys := []string{"foo.txt", "bar.txt", "baz/foo.txt", "baz/bar.txt"}
+			for i := 0; i < 5; i++ {
+				localKeys = append(localKeys, fmt.Sprintf("qux/%d.txt", i))
+			}
+			for _, key := range localKeys {
+				path := filepath.Join(root, filepath.FromSlash(key))
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+				require.NoError(t, os.WriteFile(path, []byte(key), 0644))
+			}
+
+			cfg := cloudsync.Config{
+				RootDirectory: root,
+				Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+				Scanner:       tt.cfg,
+			}
+			cfg.Scanner.PartitionID = "123"
+			cfg.Scanner.DeepTraversing = true
+			cfg.Scanner.IgnoredKeys = []string{"*.log"}
+			cfg.Scanner.Mirror = true
+			store := storage.NewLocalFS(cfg)
+			// objects out of traversal scope are never deleted
+			keptKeys := []string{"foo.log", ".hidden.txt", ".git/HEAD", "456/foo.txt"}
+			for _, key := range append(append(tt.staleKeys, keptKeys...), localKeys...) {
+				if !strings.HasPrefix(key, "456/") {
+					key = "123/" + key
+				}
+				require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+					Key:  key,
+					Data: strings.NewReader(key),
+				}))
+			}
+
+			scanner := cloudsync.NewScanner(cfg)
+			err := scanner.Start(store)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.expDeletes, scanner.Stats().GetTotalDeletedObjects())
+			for _, key := range append(append(tt.staleKeys, keptKeys...), localKeys...) {
+				if !strings.HasPrefix(key, "456/") {
+					key = "123/" + key
+				}
+				_, errStat := store.Stat(context.TODO(), key)
+				if contains(tt.expDeleted, strings.TrimPrefix(key, "123/")) {
+					assert.ErrorIs(t, errStat, cloudsync.ErrObjectNotFound, key)
+				} else {
+					assert.NoError(t, errStat, key)
+				}
+			}
+			for _, key := range tt.expTrash {
+				_, errStat := store.Stat(context.TODO(), "123/"+cloudsync.MirrorTrashPrefix+"/"+key)
+				assert.NoError(t, errStat, key)
+			}
+		})
+	}
+}
+
+func TestScanner_MirrorUnsupportedStorage(t *testing.T) {
+	scanner := cloudsync.NewScanner(cloudsync.Config{
+		RootDirectory: t.TempDir(),
+		Scanner:       cloudsync.ScannerConfig{Mirror: true},
+	})
+	assert.ErrorIs(t, scanner.Start(storageWithoutCapabilities{}), cloudsync.ErrUnsupportedStorage)
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func percent(v float64) *float64 {
+	return &v
+}
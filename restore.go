@@ -0,0 +1,278 @@
+package cloudsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultRestoreConcurrency number of objects downloaded concurrently by RestoreObjects if none was specified.
+const DefaultRestoreConcurrency = 10
+
+// RestoreConfig RestoreObjects configuration.
+type RestoreConfig struct {
+	// PartitionID logical partition (see ScannerConfig.PartitionID) to restore objects from.
+	PartitionID string
+	// Prefix restore only objects whose keys (relative to PartitionID) start with this value.
+	Prefix string
+	// Destination local directory where objects will be written into. Directory tree is recreated from object keys.
+	Destination string
+	// Concurrency number of objects downloaded concurrently. Defaults to DefaultRestoreConcurrency.
+	Concurrency int
+	// LogErrors disable or enable logging of errors.
+	LogErrors bool
+}
+
+// RestoreResult counters of a RestoreObjects execution.
+type RestoreResult struct {
+	TotalObjects    uint64
+	RestoredObjects uint64
+	SkippedObjects  uint64
+	FailedObjects   uint64
+}
+
+// RestoreObjects downloads every object from a logical partition (and, optionally, a key prefix) into a local
+// directory, recreating its directory tree and restoring the modification times, permission bits and (if allowed)
+// owners of the original files stored as object metadata. Symbolic links uploaded using SymlinksStoreAsLink are
+// recreated as links.
+//
+// Objects already matching local files (same size and modification time, or same link target) are skipped. Failed
+// downloads are counted in RestoreResult and won't stop the process; only listing and non-recovery (ErrFatalStorage)
+// errors will.
+//
+// Given BlobStorage MUST implement both BlobLister and BlobDownloader; ErrUnsupportedStorage is returned otherwise.
+// If it also implements BlobStater, objects listed without metadata are stated one by one to retrieve it.
+func RestoreObjects(ctx context.Context, store BlobStorage, cfg RestoreConfig) (RestoreResult, error) {
+	lister, isLister := store.(BlobLister)
+	downloader, isDownloader := store.(BlobDownloader)
+	stater, _ := store.(BlobStater)
+	if !isLister || !isDownloader {
+		return RestoreResult{}, ErrUnsupportedStorage
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultRestoreConcurrency
+	}
+
+	partitionPrefix := ""
+	if cfg.PartitionID != "" {
+		partitionPrefix = cfg.PartitionID + "/"
+	}
+	log.Info().
+		Str("partition_id", cfg.PartitionID).
+		Str("prefix", cfg.Prefix).
+		Str("destination", cfg.Destination).
+		Msg("Starting objects restore")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	res := RestoreResult{}
+	jobs := make(chan ObjectInfo)
+	fatalErr := atomic.Value{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range jobs {
+				restored, err := restoreObject(ctx, downloader, stater, cfg.Destination,
+					strings.TrimPrefix(obj.Key, partitionPrefix), obj)
+				switch {
+				case errors.Is(err, ErrFatalStorage):
+					fatalErr.Store(err)
+					cancel()
+					atomic.AddUint64(&res.FailedObjects, 1)
+				case err != nil:
+					if cfg.LogErrors {
+						log.Err(err).Str("object_key", obj.Key).Msg("cloudsync: Object restore failed")
+					}
+					atomic.AddUint64(&res.FailedObjects, 1)
+				case restored:
+					log.Info().Str("object_key", obj.Key).Msg("cloudsync: Restored object")
+					atomic.AddUint64(&res.RestoredObjects, 1)
+				default:
+					atomic.AddUint64(&res.SkippedObjects, 1)
+				}
+			}
+		}()
+	}
+
+	listErr := listObjects(ctx, lister.List(ctx, partitionPrefix+cfg.Prefix), func(obj ObjectInfo) {
+		if strings.HasSuffix(obj.Key, "/") {
+			return // directory placeholder
+		}
+		res.TotalObjects++
+		jobs <- obj
+	})
+	close(jobs)
+	wg.Wait()
+	if err, ok := fatalErr.Load().(error); ok {
+		return res, err
+	} else if listErr != nil && !errors.Is(listErr, context.Canceled) {
+		return res, listErr
+	}
+	log.Info().
+		Uint64("total_objects", res.TotalObjects).
+		Uint64("restored_objects", res.RestoredObjects).
+		Uint64("skipped_objects", res.SkippedObjects).
+		Uint64("failed_objects", res.FailedObjects).
+		Msg("Completed objects restore")
+	return res, ctx.Err()
+}
+
+// listObjects walks through an ObjectIterator, calling fn for each ObjectInfo until the iterator or the given
+// context is done.
+func listObjects(ctx context.Context, it ObjectIterator, fn func(ObjectInfo)) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		obj, err := it.Next()
+		if errors.Is(err, ErrIteratorDone) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fn(obj)
+	}
+}
+
+// restoreObject downloads an object into destination using a relative path (key without partition), restoring the
+// properties of its original file afterwards. Returns false if a local file already matches the object.
+func restoreObject(ctx context.Context, store BlobDownloader, stater BlobStater, destination, relativePath string,
+	obj ObjectInfo) (bool, error) {
+	path := filepath.Join(destination, filepath.FromSlash(relativePath))
+	if !isWithinDir(destination, path) {
+		return false, fmt.Errorf("cloudsync: Object key %s escapes destination directory", obj.Key)
+	}
+	if len(obj.Metadata) == 0 && stater != nil {
+		info, err := stater.Stat(ctx, obj.Key)
+		if err != nil {
+			return false, err
+		}
+		obj.Metadata = info.Metadata
+	}
+
+	modTime := obj.ModTime
+	if value, ok := obj.Metadata[MetadataKeyModTime]; ok {
+		if t, err := ParseModTime(value); err == nil {
+			modTime = t
+		}
+	}
+	linkTarget, isLink := obj.Metadata[MetadataKeySymlink]
+	if info, err := os.Lstat(path); err == nil && isRestored(path, info, obj.Size, modTime, linkTarget, isLink) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return false, err
+	} else if err = checkRealDir(destination, filepath.Dir(path)); err != nil {
+		return false, fmt.Errorf("cloudsync: Object key %s escapes destination directory: %w", obj.Key, err)
+	}
+	if isLink {
+		return true, restoreSymlink(path, linkTarget, obj.Metadata)
+	}
+
+	// write into a temporary file first so partially downloaded objects never override existing files
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cloudsync-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if err = store.Download(ctx, obj.Key, tmp); err != nil {
+		_ = tmp.Close()
+		return false, err
+	}
+	if err = tmp.Close(); err != nil {
+		return false, err
+	} else if err = restoreFileProperties(tmp.Name(), obj.Metadata); err != nil {
+		return false, err
+	}
+	if !modTime.IsZero() {
+		if err = os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+			return false, err
+		}
+	}
+	return true, os.Rename(tmp.Name(), path)
+}
+
+// isWithinDir verifies if a path is the given directory or any of its descendants, lexically.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkRealDir verifies that a directory within destination does not resolve outside of it (e.g. through a
+// symbolic link restored before).
+func checkRealDir(destination, dir string) error {
+	realDestination, err := filepath.EvalSymlinks(destination)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	} else if !isWithinDir(realDestination, realDir) {
+		return fmt.Errorf("directory %s resolves to %s", dir, realDir)
+	}
+	return nil
+}
+
+// isRestored verifies if a local file already matches an object: links must point to the same target, while files
+// must have the same size and modification time.
+func isRestored(path string, info os.FileInfo, size int64, modTime time.Time, linkTarget string, isLink bool) bool {
+	if isLink {
+		target, err := os.Readlink(path)
+		return err == nil && target == linkTarget
+	}
+	return info.Mode().IsRegular() && info.Size() == size &&
+		info.ModTime().Truncate(time.Second).Equal(modTime.Truncate(time.Second))
+}
+
+// restoreSymlink replaces path with a symbolic link to target, restoring its owner if allowed.
+func restoreSymlink(path, target string, metadata map[string]string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	} else if err = os.Symlink(target, path); err != nil {
+		return err
+	}
+	restoreOwner(path, metadata)
+	return nil
+}
+
+// restoreFileProperties applies the permission bits (MetadataKeyMode) and, if allowed, owner (MetadataKeyUID and
+// MetadataKeyGID) of an original file to a restored one.
+func restoreFileProperties(path string, metadata map[string]string) error {
+	if value, ok := metadata[MetadataKeyMode]; ok {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil {
+			return fmt.Errorf("cloudsync: Invalid file mode %q: %w", value, err)
+		} else if err = os.Chmod(path, fs.FileMode(mode).Perm()); err != nil {
+			return err
+		}
+	}
+	restoreOwner(path, metadata)
+	return nil
+}
+
+// restoreOwner changes the owner of a restored file (or link) to the one stored in its metadata. Failures are
+// ignored as only privileged users may give files away (and some platforms do not support owners at all).
+func restoreOwner(path string, metadata map[string]string) {
+	uid, errUID := strconv.Atoi(metadata[MetadataKeyUID])
+	gid, errGID := strconv.Atoi(metadata[MetadataKeyGID])
+	if errUID != nil || errGID != nil {
+		return
+	}
+	if err := os.Lchown(path, uid, gid); err != nil {
+		log.Debug().Err(err).Str("path", path).Msg("cloudsync: Could not restore file owner")
+	}
+}
@@ -0,0 +1,200 @@
+package cloudsync_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreObjects(t *testing.T) {
+	remote := t.TempDir()
+	store := storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: remote}})
+	for _, key := range []string{"123/foo.txt", "123/docs/bar.txt", "123/docs/baz/baz.txt", "456/foo.txt"} {
+		require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+			Key:  key,
+			Data: strings.NewReader(key),
+		}))
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(filepath.Join(remote, "123", "docs", "bar.txt"), modTime, modTime))
+
+	tests := []struct {
+		name   string
+		store  cloudsync.BlobStorage
+		cfg    cloudsync.RestoreConfig
+		expRes cloudsync.RestoreResult
+		err    error
+	}{
+		{
+			name:  "Unsupported storage",
+			store: storageWithoutCapabilities{},
+			err:   cloudsync.ErrUnsupportedStorage,
+		},
+		{
+			name: "Storage critical error",
+			store: cloudsync.NoopBlobStorage{
+				ListObjects: []cloudsync.ObjectInfo{{Key: "123/foo.txt"}},
+				DownloadErr: cloudsync.ErrFatalStorage,
+			},
+			cfg: cloudsync.RestoreConfig{
+				PartitionID: "123",
+				Destination: t.TempDir(),
+			},
+			expRes: cloudsync.RestoreResult{TotalObjects: 1, FailedObjects: 1},
+			err:    cloudsync.ErrFatalStorage,
+		},
+		{
+			name: "Storage non-critical error",
+			store: cloudsync.NoopBlobStorage{
+				ListObjects: []cloudsync.ObjectInfo{{Key: "123/foo.txt"}, {Key: "123/../../bar.txt"}},
+				DownloadErr: errors.New("foo error"),
+			},
+			cfg: cloudsync.RestoreConfig{
+				PartitionID: "123",
+				Destination: t.TempDir(),
+			},
+			expRes: cloudsync.RestoreResult{TotalObjects: 2, FailedObjects: 2},
+		},
+		{
+			name:  "Prefix",
+			store: store,
+			cfg: cloudsync.RestoreConfig{
+				PartitionID: "123",
+				Prefix:      "docs/",
+				Destination: t.TempDir(),
+			},
+			expRes: cloudsync.RestoreResult{TotalObjects: 2, RestoredObjects: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := cloudsync.RestoreObjects(context.TODO(), tt.store, tt.cfg)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.expRes, res)
+		})
+	}
+
+	t.Run("Full partition", func(t *testing.T) {
+		dst := t.TempDir()
+		cfg := cloudsync.RestoreConfig{
+			PartitionID: "123",
+			Destination: dst,
+			Concurrency: 2,
+		}
+		res, err := cloudsync.RestoreObjects(context.TODO(), store, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, cloudsync.RestoreResult{TotalObjects: 3, RestoredObjects: 3}, res)
+		for _, key := range []string{"foo.txt", "docs/bar.txt", "docs/baz/baz.txt"} {
+			data, errRead := os.ReadFile(filepath.Join(dst, filepath.FromSlash(key)))
+			require.NoError(t, errRead)
+			assert.Equal(t, "123/"+key, string(data))
+		}
+		info, err := os.Stat(filepath.Join(dst, "docs", "bar.txt"))
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(info.ModTime()))
+
+		// files already restored are skipped
+		require.NoError(t, os.WriteFile(filepath.Join(dst, "foo.txt"), []byte("foo"), 0644))
+		res, err = cloudsync.RestoreObjects(context.TODO(), store, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, cloudsync.RestoreResult{TotalObjects: 3, RestoredObjects: 1, SkippedObjects: 2}, res)
+		data, err := os.ReadFile(filepath.Join(dst, "foo.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "123/foo.txt", string(data))
+	})
+}
+
+// storageWithoutCapabilities cloudsync.BlobStorage implementation without optional capabilities.
+type storageWithoutCapabilities struct {
+	cloudsync.BlobStorage
+}
+
+// metadataLessStorage cloudsync.BlobStorage listing objects without their metadata, as Amazon S3 does.
+type metadataLessStorage struct {
+	*storage.LocalFS
+}
+
+func (m metadataLessStorage) List(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	infos := make([]cloudsync.ObjectInfo, 0)
+	it := m.LocalFS.List(ctx, prefix)
+	for info, err := it.Next(); err == nil; info, err = it.Next() {
+		info.Metadata = nil
+		infos = append(infos, info)
+	}
+	return cloudsync.NewSliceObjectIterator(infos)
+}
+
+func TestRestoreObjects_Metadata(t *testing.T) {
+	store := storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: t.TempDir()}})
+	modTime := time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "123/docs/foo.txt",
+		Data: strings.NewReader("foo"),
+		Metadata: map[string]string{
+			cloudsync.MetadataKeyModTime: cloudsync.FormatModTime(modTime),
+			cloudsync.MetadataKeyMode:    "0600",
+		},
+	}))
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:      "123/docs/bar.txt",
+		Data:     strings.NewReader("foo.txt"),
+		Metadata: map[string]string{cloudsync.MetadataKeySymlink: "foo.txt", cloudsync.MetadataKeyMode: "0777"},
+	}))
+
+	dst := t.TempDir()
+	cfg := cloudsync.RestoreConfig{PartitionID: "123", Destination: dst}
+	res, err := cloudsync.RestoreObjects(context.TODO(), metadataLessStorage{LocalFS: store}, cfg)
+	if err == nil && res.FailedObjects > 0 {
+		t.Skip("symbolic links are not supported")
+	}
+	require.NoError(t, err)
+	assert.Equal(t, cloudsync.RestoreResult{TotalObjects: 2, RestoredObjects: 2}, res)
+
+	info, err := os.Stat(filepath.Join(dst, "docs", "foo.txt"))
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()))
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+	target, err := os.Readlink(filepath.Join(dst, "docs", "bar.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo.txt", target)
+
+	// restored files and links are skipped using their original properties
+	res, err = cloudsync.RestoreObjects(context.TODO(), metadataLessStorage{LocalFS: store}, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, cloudsync.RestoreResult{TotalObjects: 2, SkippedObjects: 2}, res)
+}
+
+func TestRestoreObjects_SymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	store := cloudsync.NoopBlobStorage{ListObjects: []cloudsync.ObjectInfo{
+		{Key: "123/docs", Metadata: map[string]string{cloudsync.MetadataKeySymlink: outside}},
+		{Key: "123/docs/foo.txt"},
+	}}
+	res, err := cloudsync.RestoreObjects(context.TODO(), store, cloudsync.RestoreConfig{
+		PartitionID: "123",
+		Destination: t.TempDir(),
+		Concurrency: 1,
+	})
+	require.NoError(t, err)
+	if res.RestoredObjects == 0 {
+		t.Skip("symbolic links are not supported")
+	}
+	// files are never written through restored links pointing outside the destination directory
+	assert.Equal(t, cloudsync.RestoreResult{TotalObjects: 2, RestoredObjects: 1, FailedObjects: 1}, res)
+	entries, err := os.ReadDir(outside)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,156 @@
+package cloudsync
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultRetryMaxAttempts number of times a job is executed (including the first execution) if
+	// RetryPolicy.MaxAttempts was not set.
+	DefaultRetryMaxAttempts = 3
+	// DefaultRetryBaseBackoff time to wait before the first retry if RetryPolicy.BaseBackoff was not set.
+	DefaultRetryBaseBackoff = time.Millisecond * 500
+	// DefaultRetryMaxBackoff maximum time to wait between retries if RetryPolicy.MaxBackoff was not set.
+	DefaultRetryMaxBackoff = time.Second * 30
+	// DefaultRetryJitter fraction of each backoff randomized if RetryPolicy.Jitter was not set.
+	DefaultRetryJitter = 0.5
+)
+
+// RetryPolicy configuration of failed jobs retries. Backoff doubles after each failed attempt (exponential backoff)
+// until MaxBackoff is reached.
+type RetryPolicy struct {
+	// MaxAttempts number of times a job is executed, including the first execution. Set as 1 to disable retries.
+	// Defaults to DefaultRetryMaxAttempts.
+	MaxAttempts int `yaml:"max_attempts"`
+	// BaseBackoff time to wait before the first retry (e.g. 500ms). Defaults to DefaultRetryBaseBackoff.
+	BaseBackoff time.Duration `yaml:"base_backoff"`
+	// MaxBackoff maximum time to wait between retries (e.g. 30s). Defaults to DefaultRetryMaxBackoff.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// Jitter fraction (from 0 to 1) of each backoff randomized, so failed jobs from several workers or hosts are not
+	// retried at the same time. Defaults to DefaultRetryJitter; set a negative value to disable.
+	Jitter float64 `yaml:"jitter"`
+	// IsRetryable classifies errors as transient (retryable) or not. Defaults to IsRetryableError.
+	IsRetryable func(err error) bool `yaml:"-"`
+}
+
+// withDefaults fills RetryPolicy fields not set with its default values.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if p.BaseBackoff <= 0 {
+		p.BaseBackoff = DefaultRetryBaseBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if p.MaxBackoff < p.BaseBackoff {
+		p.MaxBackoff = p.BaseBackoff
+	}
+	if p.Jitter == 0 {
+		p.Jitter = DefaultRetryJitter
+	} else if p.Jitter < 0 {
+		p.Jitter = 0
+	} else if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	if p.IsRetryable == nil {
+		p.IsRetryable = IsRetryableError
+	}
+	return p
+}
+
+// backoff calculates time to wait after the given failed attempt (starting from 1). rnd MUST be a number within
+// [0, 1) used to randomize a fraction (RetryPolicy.Jitter) of the backoff.
+func (p RetryPolicy) backoff(attempt int, rnd float64) time.Duration {
+	backoff := p.BaseBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff - time.Duration(float64(backoff)*p.Jitter*rnd)
+}
+
+// IsRetryableError default RetryPolicy.IsRetryable implementation. Only errors known to be transient are retried:
+// throttling, server and timeout errors reported by blob storages (errors exposing an HTTP status code through an
+// HTTPStatusCode() int method, or an error code through an ErrorCode() string method, as AWS SDK errors do) and network
+// failures. Any other error (e.g. non-recovery storage errors, rejected requests or invalid objects) is permanent.
+func IsRetryableError(err error) bool {
+	var codeErr interface{ ErrorCode() string }
+	var statusErr interface{ HTTPStatusCode() int }
+	var netErr net.Error
+	switch {
+	case err == nil,
+		errors.Is(err, ErrFatalStorage),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &codeErr) && isRetryableErrorCode(codeErr.ErrorCode()):
+		return true
+	case errors.As(err, &statusErr):
+		return isRetryableStatusCode(statusErr.HTTPStatusCode())
+	case errors.As(err, &netErr),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryableErrorCode verifies if a blob storage API error code reports throttling or a request timeout.
+func isRetryableErrorCode(code string) bool {
+	switch code {
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestTimeout", "RequestTimeTooSkewed":
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryableStatusCode verifies if an HTTP status code reports a request timeout, throttling or a server error.
+func isRetryableStatusCode(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests ||
+		(code >= http.StatusInternalServerError && code != http.StatusNotImplemented)
+}
+
+// retry executes fn until it succeeds, it returns a non-retryable error, ScannerConfig.Retry attempts are exhausted
+// or the given context is done. Returns the number of attempts along with the latest error.
+func (s *Scanner) retry(ctx context.Context, key string, fn func() error) (int, error) {
+	policy := s.cfg.Scanner.Retry
+	attempt := 1
+	for ; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || !policy.IsRetryable(err) {
+			return attempt, err
+		}
+
+		backoff := policy.backoff(attempt, rand.Float64())
+		log.Warn().
+			Err(err).
+			Str("object_key", key).
+			Int("attempt", attempt).
+			Str("backoff", backoff.String()).
+			Msg("cloudsync: Job failed, retrying")
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
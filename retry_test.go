@@ -0,0 +1,201 @@
+package cloudsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_withDefaults(t *testing.T) {
+	policy := RetryPolicy{}.withDefaults()
+	assert.Equal(t, DefaultRetryMaxAttempts, policy.MaxAttempts)
+	assert.Equal(t, DefaultRetryBaseBackoff, policy.BaseBackoff)
+	assert.Equal(t, DefaultRetryMaxBackoff, policy.MaxBackoff)
+	assert.Equal(t, DefaultRetryJitter, policy.Jitter)
+	assert.NotNil(t, policy.IsRetryable)
+
+	policy = RetryPolicy{BaseBackoff: time.Minute, MaxBackoff: time.Second, Jitter: -1}.withDefaults()
+	assert.Equal(t, time.Minute, policy.MaxBackoff)
+	assert.Equal(t, float64(0), policy.Jitter)
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := RetryPolicy{
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Second * 10,
+		Jitter:      0.5,
+	}
+	tests := []struct {
+		attempt int
+		rnd     float64
+		exp     time.Duration
+	}{
+		{attempt: 1, rnd: 0, exp: time.Second},
+		{attempt: 2, rnd: 0, exp: time.Second * 2},
+		{attempt: 3, rnd: 0, exp: time.Second * 4},
+		{attempt: 4, rnd: 0, exp: time.Second * 8},
+		{attempt: 5, rnd: 0, exp: time.Second * 10},
+		{attempt: 100, rnd: 0, exp: time.Second * 10},
+		{attempt: 1, rnd: 0.5, exp: time.Millisecond * 750},
+		{attempt: 5, rnd: 0.99, exp: time.Millisecond * 5050},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d-%f", tt.attempt, tt.rnd), func(t *testing.T) {
+			assert.Equal(t, tt.exp, policy.backoff(tt.attempt, tt.rnd))
+		})
+	}
+}
+
+// apiError error reported by a blob storage API, exposing its error and HTTP status codes as AWS SDK errors do.
+type apiError struct {
+	code   string
+	status int
+}
+
+func (e apiError) Error() string {
+	return fmt.Sprintf("api error %s (%d)", e.code, e.status)
+}
+
+func (e apiError) ErrorCode() string {
+	return e.code
+}
+
+func (e apiError) HTTPStatusCode() int {
+	return e.status
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		err error
+		exp bool
+	}{
+		{err: nil, exp: false},
+		{err: ErrFatalStorage, exp: false},
+		{err: fmt.Errorf("foo: %w", ErrFatalStorage), exp: false},
+		{err: ErrObjectNotFound, exp: false},
+		{err: ErrUnsupportedStorage, exp: false},
+		{err: ErrInvalidKeyTemplate, exp: false},
+		{err: context.Canceled, exp: false},
+		{err: context.DeadlineExceeded, exp: false},
+		{err: &fs.PathError{Op: "open", Path: "foo.txt", Err: fs.ErrNotExist}, exp: false},
+		{err: errors.New("foo error"), exp: false},
+		{err: apiError{code: "InvalidArgument", status: http.StatusBadRequest}, exp: false},
+		{err: apiError{code: "AccessDenied", status: http.StatusForbidden}, exp: false},
+		{err: apiError{code: "NoSuchKey", status: http.StatusNotFound}, exp: false},
+		{err: apiError{code: "NotImplemented", status: http.StatusNotImplemented}, exp: false},
+		{err: apiError{code: "RequestTimeout", status: http.StatusBadRequest}, exp: true},
+		{err: apiError{code: "TooManyRequests", status: http.StatusTooManyRequests}, exp: true},
+		{err: apiError{code: "SlowDown", status: http.StatusServiceUnavailable}, exp: true},
+		{err: fmt.Errorf("foo: %w", apiError{code: "InternalError", status: http.StatusInternalServerError}), exp: true},
+		{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, exp: true},
+		{err: fmt.Errorf("foo: %w", syscall.ECONNRESET), exp: true},
+		{err: io.ErrUnexpectedEOF, exp: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.err), func(t *testing.T) {
+			assert.Equal(t, tt.exp, IsRetryableError(tt.err))
+		})
+	}
+}
+
+// flakyBlobStorage BlobStorage implementation failing the first uploads of every object key.
+type flakyBlobStorage struct {
+	NoopBlobStorage
+	mu       sync.Mutex
+	failures int
+	attempts map[string]int
+}
+
+func (f *flakyBlobStorage) Upload(_ context.Context, obj Object) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[obj.Key]++
+	if f.attempts[obj.Key] <= f.failures {
+		return f.UploadErr
+	}
+	return nil
+}
+
+func TestScanner_Retry(t *testing.T) {
+	tests := []struct {
+		name        string
+		uploadErr   error
+		failures    int
+		expAttempts int
+		expFailed   uint64
+		err         error
+	}{
+		{
+			name:        "Transient error",
+			uploadErr:   apiError{code: "SlowDown", status: http.StatusServiceUnavailable},
+			failures:    2,
+			expAttempts: 3,
+		},
+		{
+			name:        "Attempts exhausted",
+			uploadErr:   apiError{code: "SlowDown", status: http.StatusServiceUnavailable},
+			failures:    3,
+			expAttempts: 3,
+			expFailed:   5,
+		},
+		{
+			name:        "Permanent error",
+			uploadErr:   errors.New("foo error"),
+			failures:    3,
+			expAttempts: 1,
+			expFailed:   5,
+		},
+		{
+			name:        "Fatal error",
+			uploadErr:   ErrFatalStorage,
+			failures:    1,
+			expAttempts: 1,
+			expFailed:   1,
+			err:         ErrFatalStorage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &flakyBlobStorage{
+				NoopBlobStorage: NoopBlobStorage{CheckModBool: true, UploadErr: tt.uploadErr},
+				failures:        tt.failures,
+				attempts:        make(map[string]int),
+			}
+			scanner := NewScanner(Config{
+				RootDirectory: "./testdata",
+				Scanner: ScannerConfig{
+					DeepTraversing:       true,
+					MaxConcurrentUploads: 1,
+					Retry: RetryPolicy{
+						BaseBackoff: time.Millisecond,
+						MaxBackoff:  time.Millisecond * 2,
+					},
+				},
+			})
+			assert.ErrorIs(t, scanner.Start(store), tt.err)
+			for key, attempts := range store.attempts {
+				assert.LessOrEqual(t, attempts, tt.expAttempts, key)
+			}
+			if tt.err != nil {
+				// remaining jobs are not scheduled once the scanner gets stopped
+				assert.GreaterOrEqual(t, scanner.Stats().GetTotalFailedJobs(), tt.expFailed)
+				return
+			}
+			assert.Len(t, store.attempts, 5)
+			for key, attempts := range store.attempts {
+				assert.Equal(t, tt.expAttempts, attempts, key)
+			}
+			assert.Equal(t, tt.expFailed, scanner.Stats().GetTotalFailedJobs())
+		})
+	}
+}
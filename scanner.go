@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,18 +15,72 @@ import (
 
 // Scanner main component which reads and schedules upload jobs based on the files found on directories specified
 // in Config.
+//
+// Each Scanner owns its job queues and Stats, so multiple instances may run concurrently within the same process.
+// A Scanner may be started again once a previous Start call returned.
 type Scanner struct {
 	cfg           Config
+	mu            sync.Mutex
+	stats         *Stats
+	index         Index
+	journal       Journal
+	sources       []*scanSource
+	include       *IgnoreMatcher
 	baseCtx       context.Context
 	baseCtxCancel context.CancelFunc
 	startTime     time.Time
 	shutdownWg    sync.WaitGroup
+	// fatalErr non-recovery error which stopped the latest (or current) execution.
+	fatalErr error
+	// localKeys object keys of every file found during the latest traversal. Only used by mirror mode.
+	localKeys map[string]struct{}
+	// modifiedAfter, modifiedBefore modification time filters resolved for the current scan (see
+	// Scanner.resolveTimeFilters), zero if not set.
+	modifiedAfter, modifiedBefore time.Time
+
+	// fileCheckJobQueue queue used by scheduler to trigger file modification check jobs executions as background
+	// tasks.
+	fileCheckJobQueue chan fileJob
+	// objectUploadJobQueue queue used by check workers to trigger object upload jobs executions as background tasks.
+	objectUploadJobQueue chan fileJob
+	// objectUploadJobQueueErr queue used to perform actions when jobs executions running as background tasks
+	// fail (i.e. logging errors).
+	objectUploadJobQueueErr chan ErrFileUpload
 }
 
 // NewScanner allocates a new Scanner instance which will use specified Config.
+//
+// Worker pool sizes are set to DefaultMaxConcurrentChecks and DefaultMaxConcurrentUploads if not specified. Change
+// detection mode, symlink policy, watch debounce interval and mirror deletion threshold are set to
+// ChangeDetectionModTime, SymlinksSkip, DefaultWatchDebounce and DefaultMirrorMaxDeletePercent if not specified.
+// RetryPolicy fields not specified are set to its defaults as well (e.g. DefaultRetryMaxAttempts).
 func NewScanner(cfg Config) *Scanner {
+	if cfg.Scanner.MaxConcurrentChecks <= 0 {
+		cfg.Scanner.MaxConcurrentChecks = DefaultMaxConcurrentChecks
+	}
+	if cfg.Scanner.MaxConcurrentUploads <= 0 {
+		cfg.Scanner.MaxConcurrentUploads = DefaultMaxConcurrentUploads
+	}
+	cfg.RootDirectory = strings.TrimSuffix(cfg.RootDirectory, "\"")
+	if cfg.Scanner.WatchDebounce <= 0 {
+		cfg.Scanner.WatchDebounce = DefaultWatchDebounce
+	}
+	if cfg.Scanner.ChangeDetection == "" {
+		cfg.Scanner.ChangeDetection = ChangeDetectionModTime
+	}
+	if cfg.Scanner.Symlinks == "" {
+		cfg.Scanner.Symlinks = SymlinksSkip
+	}
+	if cfg.Scanner.MirrorMaxDeletePercent == nil {
+		maxDeletePercent := float64(DefaultMirrorMaxDeletePercent)
+		cfg.Scanner.MirrorMaxDeletePercent = &maxDeletePercent
+	}
+	cfg.Scanner.Retry = cfg.Scanner.Retry.withDefaults()
 	return &Scanner{
 		cfg:           cfg,
+		sources:       newScanSources(cfg),
+		include:       newIncludeMatcher(cfg.Scanner.IncludePatterns),
+		stats:         &Stats{},
 		baseCtx:       nil,
 		baseCtxCancel: nil,
 		startTime:     time.Time{},
@@ -33,37 +88,201 @@ func NewScanner(cfg Config) *Scanner {
 	}
 }
 
-// Start bootstraps and runs internal processes to read files and schedule upload jobs.
+// SetIndex sets the local state index used to skip remote checks of files unchanged since their latest
+// synchronization (see ScannerConfig.ForceReconcile). The Index is not closed by the Scanner.
+//
+// MUST be called before Start.
+func (s *Scanner) SetIndex(index Index) {
+	s.index = index
+}
+
+// SetJournal sets the journal failed jobs are recorded into, so they may be retried later on using
+// Scanner.RetryFailed. Jobs are removed from the Journal once they succeed. The Journal is not closed by the Scanner.
+//
+// MUST be called before Start.
+func (s *Scanner) SetJournal(journal Journal) {
+	s.journal = journal
+}
+
+// Stats retrieves counters of the latest (or current) Start execution.
+func (s *Scanner) Stats() *Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// SourceStats retrieves counters of the latest (or current) Start execution by source directory (see
+// Config.Sources). Current upload jobs are only tracked by Scanner.Stats.
+func (s *Scanner) SourceStats() map[string]*Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]*Stats, len(s.sources))
+	for _, src := range s.sources {
+		stats[src.root] = src.stats
+	}
+	return stats
+}
+
+// Start bootstraps and runs internal processes to read files and schedule upload jobs. Every source (see
+// Config.Sources) is traversed within the same run, sharing worker pools; ErrInvalidSource is returned if none was
+// specified.
+//
+// If ScannerConfig.Mirror was set as true, remote objects with no local counterpart are deleted once every file was
+// scheduled (see Scanner.mirrorDeletions). Given BlobStorage MUST implement both BlobLister and BlobDeleter (and
+// BlobCopier if ScannerConfig.MirrorSoftDelete was set as true) then; ErrUnsupportedStorage is returned otherwise.
+//
+// If the blob storage returns a non-recovery error (ErrFatalStorage), scheduling stops, jobs in progress are
+// drained and the error is returned.
+//
+// Blocks until every file found was checked and, if required, uploaded or until the Scanner gets shut down.
 func (s *Scanner) Start(store BlobStorage) error {
+	return s.start(context.Background(), store)
+}
+
+// start runs Scanner.Start using parent as base context.
+func (s *Scanner) start(parent context.Context, store BlobStorage) error {
+	if err := validateSources(s.cfg); err != nil {
+		return err
+	} else if !s.cfg.Scanner.Mirror {
+		s.localKeys = nil
+		return s.run(parent, store, s.scheduleFileUploads)
+	} else if err := s.validateMirror(store); err != nil {
+		return err
+	}
+
+	s.localKeys = make(map[string]struct{})
+	return s.run(parent, store, func(ctx context.Context) error {
+		if err := s.scheduleFileUploads(ctx); err != nil {
+			return err
+		}
+		return s.mirrorDeletions(ctx, store)
+	})
+}
+
+// run bootstraps internal queues and workers, then calls schedule to produce file modification check jobs. Once
+// schedule returns, queues are drained and closed.
+func (s *Scanner) run(parent context.Context, store BlobStorage, schedule func(ctx context.Context) error) error {
 	if store == nil {
 		return errors.New("cloudsync: Invalid blob storage")
+	} else if err := s.cfg.Scanner.ChangeDetection.validate(store); err != nil {
+		return err
+	} else if err = s.cfg.Scanner.Symlinks.validate(); err != nil {
+		return err
 	}
 
-	s.baseCtx, s.baseCtxCancel = context.WithCancel(context.Background())
-	wg := new(sync.WaitGroup)
+	s.shutdownWg.Add(1)
+	defer s.shutdownWg.Done()
+	s.mu.Lock()
+	s.baseCtx, s.baseCtxCancel = context.WithCancel(parent)
+	s.stats = &Stats{}
+	s.sources = newScanSources(s.cfg) // ignore files are read again on every run
+	s.fatalErr = nil
+	s.mu.Unlock()
+	s.fileCheckJobQueue = make(chan fileJob)
+	s.objectUploadJobQueue = make(chan fileJob)
+	s.objectUploadJobQueueErr = make(chan ErrFileUpload)
 
+	runCtx, stop := context.WithCancel(s.baseCtx)
+	defer stop()
 	sysChan := make(chan os.Signal, 2)
 	signal.Notify(sysChan, os.Interrupt, syscall.SIGTERM)
-	ListenForSysInterruption(&s.shutdownWg, s.baseCtxCancel, sysChan)
+	defer signal.Stop(sysChan)
+	go s.listenForSysInterruption(runCtx, sysChan)
 
-	go ListenAndExecuteUploadJobs(s.baseCtx, store, wg)
-	go ListenUploadErrors(s.cfg)
-	go ShutdownUploadWorkers(s.baseCtx, &s.shutdownWg)
+	checkWg, uploadWg, errWg := sync.WaitGroup{}, sync.WaitGroup{}, sync.WaitGroup{}
+	errWg.Add(1)
+	go func() {
+		defer errWg.Done()
+		s.listenUploadErrors()
+	}()
+	uploadWg.Add(s.cfg.Scanner.MaxConcurrentUploads)
+	for i := 0; i < s.cfg.Scanner.MaxConcurrentUploads; i++ {
+		go func() {
+			defer uploadWg.Done()
+			s.listenAndExecuteUploadJobs(s.baseCtx, store)
+		}()
+	}
+	checkWg.Add(s.cfg.Scanner.MaxConcurrentChecks)
+	for i := 0; i < s.cfg.Scanner.MaxConcurrentChecks; i++ {
+		go func() {
+			defer checkWg.Done()
+			s.listenAndExecuteCheckJobs(s.baseCtx, store)
+		}()
+	}
 
 	s.startTime = time.Now()
-	log.Info().Msg("Starting file upload jobs")
-	if err := ScheduleFileUploads(s.baseCtx, s.cfg, wg, store); err != nil {
-		return err
+	s.resolveTimeFilters(s.startTime)
+	log.Info().
+		Int("max_concurrent_checks", s.cfg.Scanner.MaxConcurrentChecks).
+		Int("max_concurrent_uploads", s.cfg.Scanner.MaxConcurrentUploads).
+		Str("change_detection", string(s.cfg.Scanner.ChangeDetection)).
+		Bool("use_index", s.index != nil).
+		Bool("force_reconcile", s.cfg.Scanner.ForceReconcile).
+		Bool("dry_run", s.cfg.Scanner.DryRun).
+		Bool("mirror", s.localKeys != nil).
+		Msg("Starting file upload jobs")
+	err := schedule(s.baseCtx)
+
+	// queues are closed in pipeline order, so every job already scheduled gets drained by workers
+	close(s.fileCheckJobQueue)
+	checkWg.Wait()
+	close(s.objectUploadJobQueue)
+	uploadWg.Wait()
+	close(s.objectUploadJobQueueErr)
+	errWg.Wait()
+	if len(s.sources) > 1 {
+		for _, src := range s.sources {
+			log.Info().
+				Str("root_directory", src.root).
+				Str("key_prefix", src.keyPrefix).
+				Uint64("total_upload_jobs", src.stats.GetTotalUploadJobs()).
+				Uint64("total_upload_bytes", src.stats.GetTotalUploadBytes()).
+				Uint64("total_deleted_objects", src.stats.GetTotalDeletedObjects()).
+				Uint64("total_failed_jobs", src.stats.GetTotalFailedJobs()).
+				Msg("Completed source")
+		}
 	}
-	wg.Wait()
-	return nil
+	if s.cfg.Scanner.DryRun {
+		log.Info().
+			Uint64("total_objects", s.stats.GetTotalUploadJobs()).
+			Uint64("total_bytes", s.stats.GetTotalUploadBytes()).
+			Uint64("total_deleted_objects", s.stats.GetTotalDeletedObjects()).
+			Uint64("total_failed_jobs", s.stats.GetTotalFailedJobs()).
+			Msg("Completed dry run, no files were uploaded")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fatalErr != nil {
+		return s.fatalErr
+	}
+	return err
+}
+
+// abort stops the current execution due to a non-recovery error, which will be returned by Start.
+func (s *Scanner) abort(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fatalErr != nil {
+		return
+	}
+	s.fatalErr = err
+	if s.baseCtxCancel != nil {
+		s.baseCtxCancel()
+	}
+	log.Err(err).Msg("cloudsync: Got non-recovery error, stopping scanner")
 }
 
 // Shutdown stops all internal process gracefully. Moreover, the shutdown process will stop if the specified
 // context was cancelled, avoiding application deadlocks if used with context.WithTimeout() in expense of
 // a corrupted shutdown.
 func (s *Scanner) Shutdown(ctx context.Context) error {
-	s.baseCtxCancel()
+	s.mu.Lock()
+	cancel := s.baseCtxCancel
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil // never started
+	}
+	cancel()
 	select {
 	case <-ctx.Done():
 		return nil
@@ -71,8 +290,10 @@ func (s *Scanner) Shutdown(ctx context.Context) error {
 		s.shutdownWg.Wait()
 		log.Info().
 			Str("took", time.Since(s.startTime).String()).
-			Uint64("total_upload_jobs", DefaultStats.GetTotalUploadJobs()).
-			Uint64("total_failed_jobs", DefaultStats.GetTotalFailedJobs()).
+			Uint64("total_upload_jobs", s.Stats().GetTotalUploadJobs()).
+			Uint64("total_upload_bytes", s.Stats().GetTotalUploadBytes()).
+			Uint64("total_deleted_objects", s.Stats().GetTotalDeletedObjects()).
+			Uint64("total_failed_jobs", s.Stats().GetTotalFailedJobs()).
 			Msg("Completed all file upload jobs")
 	}
 	return nil
@@ -2,6 +2,11 @@ package cloudsync
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -9,7 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func testNewScanner(t *testing.T) {
+func TestNewScanner(t *testing.T) {
 	tests := []struct {
 		name         string
 		rootDir      string
@@ -59,3 +64,174 @@ func testNewScanner(t *testing.T) {
 		cancel()
 	}
 }
+
+// recordingBlobStorage BlobStorage implementation keeping track of uploaded object keys.
+type recordingBlobStorage struct {
+	NoopBlobStorage
+	mu     sync.Mutex
+	keys   []string
+	checks int
+}
+
+func (r *recordingBlobStorage) CheckMod(_ context.Context, _ string, _ time.Time, _ int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks++
+	return true, r.CheckModErr
+}
+
+func (r *recordingBlobStorage) Upload(_ context.Context, obj Object) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, obj.Key)
+	return r.UploadErr
+}
+
+func TestScanner_Concurrent(t *testing.T) {
+	expKeys := []string{"config.yaml", "config.1.yaml", "config.2.yaml", "foo/foo.yaml", "foo/bar.yaml"}
+	scanners := make([]*Scanner, 0, 3)
+	stores := make([]*recordingBlobStorage, 0, 3)
+	for _, partition := range []string{"123", "456", "789"} {
+		scanners = append(scanners, NewScanner(Config{
+			RootDirectory: "./testdata",
+			Scanner: ScannerConfig{
+				PartitionID:          partition,
+				DeepTraversing:       true,
+				MaxConcurrentChecks:  2,
+				MaxConcurrentUploads: 1,
+			},
+		}))
+		stores = append(stores, &recordingBlobStorage{})
+	}
+
+	for round := 1; round <= 2; round++ { // scanners might be restarted
+		wg := sync.WaitGroup{}
+		wg.Add(len(scanners))
+		for i := range scanners {
+			go func(scanner *Scanner, store BlobStorage) {
+				defer wg.Done()
+				assert.NoError(t, scanner.Start(store))
+				assert.NoError(t, scanner.Shutdown(context.TODO()))
+			}(scanners[i], stores[i])
+		}
+		wg.Wait()
+
+		for i, scanner := range scanners {
+			assert.Equal(t, uint64(len(expKeys)), scanner.Stats().GetTotalUploadJobs())
+			assert.Equal(t, uint64(0), scanner.Stats().GetTotalFailedJobs())
+			assert.Len(t, stores[i].keys, len(expKeys)*round)
+			for _, key := range stores[i].keys {
+				assert.Contains(t, expKeys, strings.TrimPrefix(key, scanner.cfg.Scanner.PartitionID+"/"))
+			}
+		}
+	}
+}
+
+func TestScanner_Index(t *testing.T) {
+	index, err := OpenBoltIndex(filepath.Join(t.TempDir(), DefaultIndexFile), "foo")
+	require.NoError(t, err)
+	defer index.Close()
+	cfg := Config{
+		RootDirectory: "./testdata",
+		Scanner: ScannerConfig{
+			PartitionID:    "123",
+			DeepTraversing: true,
+			Retry:          RetryPolicy{MaxAttempts: 1},
+		},
+	}
+	run := func(cfg Config, store *recordingBlobStorage) {
+		scanner := NewScanner(cfg)
+		scanner.SetIndex(index)
+		require.NoError(t, scanner.Start(store))
+		require.NoError(t, scanner.Shutdown(context.TODO()))
+	}
+
+	store := &recordingBlobStorage{NoopBlobStorage: NoopBlobStorage{UploadErr: errors.New("foo error")}}
+	run(cfg, store)
+	assert.Equal(t, 5, store.checks)
+	assert.Len(t, store.keys, 5)
+
+	// failed uploads are checked again
+	store = &recordingBlobStorage{}
+	run(cfg, store)
+	assert.Equal(t, 5, store.checks)
+	assert.Len(t, store.keys, 5)
+
+	store = &recordingBlobStorage{}
+	run(cfg, store)
+	assert.Equal(t, 0, store.checks)
+	assert.Empty(t, store.keys)
+	_, err = index.Get("123/config.yaml")
+	require.NoError(t, err)
+
+	cfg.Scanner.ForceReconcile = true
+	run(cfg, store)
+	assert.Equal(t, 5, store.checks)
+	assert.Len(t, store.keys, 5)
+}
+
+func TestScanner_DryRun(t *testing.T) {
+	index, err := OpenBoltIndex(filepath.Join(t.TempDir(), DefaultIndexFile), "foo")
+	require.NoError(t, err)
+	defer index.Close()
+	store := &recordingBlobStorage{}
+	scanner := NewScanner(Config{
+		RootDirectory: "./testdata",
+		Scanner: ScannerConfig{
+			DeepTraversing: true,
+			DryRun:         true,
+		},
+	})
+	scanner.SetIndex(index)
+	require.NoError(t, scanner.Start(store))
+	require.NoError(t, scanner.Shutdown(context.TODO()))
+
+	expBytes := uint64(0)
+	for _, path := range []string{"config.yaml", "config.1.yaml", "config.2.yaml", "foo/foo.yaml", "foo/bar.yaml"} {
+		info, errStat := os.Stat(filepath.Join("./testdata", path))
+		require.NoError(t, errStat)
+		expBytes += uint64(info.Size())
+	}
+	assert.Equal(t, 5, store.checks)
+	assert.Empty(t, store.keys)
+	assert.Equal(t, uint64(5), scanner.Stats().GetTotalUploadJobs())
+	assert.Equal(t, uint64(0), scanner.Stats().GetCurrentUploadJobs())
+	assert.Equal(t, expBytes, scanner.Stats().GetTotalUploadBytes())
+	_, err = index.Get("config.yaml")
+	assert.ErrorIs(t, err, ErrIndexEntryNotFound)
+}
+
+func TestScanner_FatalStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		store   *recordingBlobStorage
+		expKeys int
+	}{
+		{
+			name:  "Check",
+			store: &recordingBlobStorage{NoopBlobStorage: NoopBlobStorage{CheckModErr: ErrFatalStorage}},
+		},
+		{
+			name:    "Upload",
+			store:   &recordingBlobStorage{NoopBlobStorage: NoopBlobStorage{UploadErr: ErrFatalStorage}},
+			expKeys: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := NewScanner(Config{
+				RootDirectory: "./testdata",
+				Scanner: ScannerConfig{
+					DeepTraversing:       true,
+					MaxConcurrentChecks:  1,
+					MaxConcurrentUploads: 1,
+				},
+			})
+			assert.ErrorIs(t, scanner.Start(tt.store), ErrFatalStorage)
+			// remaining files are neither checked nor uploaded
+			assert.LessOrEqual(t, tt.store.checks, 2)
+			assert.Len(t, tt.store.keys, tt.expKeys)
+			assert.Equal(t, uint64(1), scanner.Stats().GetTotalFailedJobs())
+		})
+	}
+}
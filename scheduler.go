@@ -2,136 +2,240 @@ package cloudsync
 
 import (
 	"context"
-	"fmt"
+	"crypto/sha256"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 
 	"github.com/rs/zerolog/log"
 )
 
-// objectUploadJobQueue queue used by scheduler to trigger object upload jobs executions as background tasks.
-var objectUploadJobQueue = make(chan Object)
+// listenForSysInterruption waits and gracefully shuts down the Scanner when an external agent sends
+// a cancellation signal (e.g. pressing Ctrl+C on shell session running the program).
+//
+// Will stop listening once the given context is done.
+func (s *Scanner) listenForSysInterruption(ctx context.Context, sysChan <-chan os.Signal) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-sysChan:
+	}
+	log.Debug().
+		Uint64("total_upload_jobs", s.stats.GetTotalUploadJobs()).
+		Uint64("current_upload_jobs", s.stats.GetCurrentUploadJobs()).
+		Msg("cloudsync: System interruption detected, exiting")
+	s.baseCtxCancel()
+}
 
-// objectUploadJobQueueErr queue used by scheduler to perform actions when object upload jobs executions running as
-// background tasks fail (i.e. logging errors).
-var objectUploadJobQueueErr = make(chan ErrFileUpload)
+// fileJob a file found by the scheduler, pending to be checked and/or uploaded by background workers.
+//
+// Files are opened by upload workers only, keeping the number of open file handles bounded by
+// ScannerConfig.MaxConcurrentUploads.
+type fileJob struct {
+	// path file's path from host's file system.
+	path string
+	// key object key the file will be stored with.
+	key string
+	// info file's properties read during directory tree traversal.
+	info fs.FileInfo
+	// source the file belongs to, nil if unknown (e.g. retried failed jobs from a removed source).
+	source *scanSource
+	// linkTarget target path of a symbolic link uploaded as link (see SymlinksStoreAsLink), empty otherwise.
+	linkTarget string
+	// reason why the file was scheduled to be uploaded.
+	reason ChangeReason
+	// digest SHA-256 digest of the file's data, nil until calculated (see fileJob.sha256Digest).
+	digest []byte
+}
 
-// ListenForSysInterruption waits and gracefully shuts down internal workers when an external agent sends
-// a cancellation signal (e.g. pressing Ctrl+C on shell session running the program).
-func ListenForSysInterruption(wg *sync.WaitGroup, cancel context.CancelFunc, sysChan <-chan os.Signal) {
-	go func() {
-		<-sysChan
-		log.Debug().
-			Uint64("total_upload_jobs", DefaultStats.GetTotalUploadJobs()).
-			Uint64("current_upload_jobs", DefaultStats.GetCurrentUploadJobs()).
-			Msg("cloudsync: System interruption detected, exiting")
-		cancel()
-		wg.Wait()
-		log.Debug().
-			Uint64("corrupted_upload_jobs", DefaultStats.GetCurrentUploadJobs()).
-			Msg("cloudsync: Gracefully closed all background tasks after interruption")
-	}()
+// open opens the file's data. Symbolic links uploaded as links (SymlinksStoreAsLink) hold their target path as data.
+// Returned function MUST be called to release the file.
+func (j fileJob) open() (ReadSeekerAt, func() error, error) {
+	if j.linkTarget != "" {
+		return strings.NewReader(j.linkTarget), func() error { return nil }, nil
+	}
+	f, err := os.Open(j.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
 }
 
-// ScheduleFileUploads traverses a directory tree based on specified configuration (Config.RootDirectory) and
-// schedules upload jobs for each file found within all directories (if ScannerConfig.DeepTraversing was set
-// as true) or files found in root directory only.
+// sha256Digest calculates the SHA-256 digest of the file's data. The digest is calculated once per job and then
+// reused by the key template ({sha256}), checksum change detection and upload metadata, so files are read once.
+func (j *fileJob) sha256Digest() ([]byte, error) {
+	if j.digest != nil {
+		return j.digest, nil
+	}
+	data, closeData, err := j.open()
+	if err != nil {
+		return nil, err
+	}
+	defer closeData()
+	h := sha256.New()
+	if _, err = io.Copy(h, data); err != nil {
+		return nil, err
+	}
+	j.digest = h.Sum(nil)
+	return j.digest, nil
+}
+
+// scheduleFileUploads traverses the directory tree of every source (see Config.Sources) based on specified
+// configuration and schedules file modification check jobs for each file found within all directories (if
+// ScannerConfig.DeepTraversing was set as true) or files found in root directory only.
 //
 // Furthermore, based on specified Config, a traversing process might get skipped if folder is hidden (uses
 // '.' prefix character) or object/folder key was specified to be ignored explicitly in Config file.
-func ScheduleFileUploads(ctx context.Context, cfg Config, wg *sync.WaitGroup, storage BlobStorage) error {
-	cfg.RootDirectory = strings.TrimSuffix(cfg.RootDirectory, "\"")
-	log.Info().
-		Str("root_directory", cfg.RootDirectory).
-		Msg("Starting directory upload")
-	return filepath.WalkDir(cfg.RootDirectory, func(path string, d fs.DirEntry, err error) error {
+//
+// Jobs are sent to a fixed number of check workers (listenAndExecuteCheckJobs), so traversing blocks while all
+// workers are busy. Sources are traversed one after the other, sharing the same workers.
+func (s *Scanner) scheduleFileUploads(ctx context.Context) error {
+	for _, src := range s.sources {
+		log.Info().
+			Str("root_directory", src.root).
+			Str("key_prefix", src.keyPrefix).
+			Msg("Starting directory upload")
+		if err := s.scheduleDirectory(ctx, src, src.root, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduleDirectory traverses a directory tree within a source, scheduling file modification check jobs for each
+// file found. If not nil, onDir is called for each directory traversed (including dir).
+func (s *Scanner) scheduleDirectory(ctx context.Context, src *scanSource, dir string,
+	onDir func(path string) error) error {
+	return s.walkDirectory(ctx, src, dir, onDir, []string{src.realRoot})
+}
+
+// walkDirectory traverses a directory tree within a source (see Scanner.scheduleDirectory). Symbolic links are
+// handled by Scanner.scheduleLink, using chain to detect cycles. If dir itself is a symbolic link, it is always
+// followed.
+func (s *Scanner) walkDirectory(ctx context.Context, src *scanSource, dir string, onDir func(path string) error,
+	chain []string) error {
+	if info, err := os.Lstat(dir); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		dir += string(filepath.Separator) // makes filepath.WalkDir resolve the link
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		isHidden := d.Name() != "." && strings.HasPrefix(d.Name(), ".")
-		if d.IsDir() && ((isHidden || cfg.KeyIsIgnored(d.Name())) || (!cfg.Scanner.DeepTraversing && cfg.RootDirectory != path)) {
+		if d.IsDir() && s.isDirSkipped(src, path) {
 			return fs.SkipDir
-		} else if d.IsDir() || (isHidden && !cfg.Scanner.ReadHidden) || cfg.KeyIsIgnored(d.Name()) {
+		} else if d.IsDir() {
+			s.loadIgnoreFile(src, path)
+			if onDir != nil {
+				return onDir(path)
+			}
+			return nil
+		} else if d.Type()&fs.ModeSymlink != 0 {
+			return s.scheduleLink(ctx, src, path, onDir, chain)
+		} else if s.isFileSkipped(src, path) {
 			return nil // ignore
 		}
 
-		rel, err := filepath.Rel(cfg.RootDirectory, path)
-		if err != nil && objectUploadJobQueueErr != nil {
-			objectUploadJobQueueErr <- ErrFileUpload{
-				Key:    d.Name(),
+		info, err := d.Info()
+		if err != nil {
+			key := src.failedObjectKey(path, nil)
+			s.trackLocalKey(key)
+			s.objectUploadJobQueueErr <- ErrFileUpload{
+				Key:    key,
+				Path:   path,
 				Parent: err,
 			}
 			return nil
 		}
-
-		info, _ := d.Info()
-		wg.Add(1)
-		go scheduleFileUpload(scheduleFileUploadArgs{
-			ctx:          ctx,
-			cfg:          cfg,
-			wg:           wg,
-			storage:      storage,
-			path:         path,
-			relativePath: rel,
-			info:         info,
-		})
-		return nil
+		return s.scheduleFile(ctx, src, fileJob{path: path, info: info})
 	})
 }
 
-type scheduleFileUploadArgs struct {
-	ctx          context.Context
-	cfg          Config
-	wg           *sync.WaitGroup
-	storage      BlobStorage
-	path         string
-	relativePath string
-	info         fs.FileInfo
+// isDirSkipped verifies if a directory must not be traversed (hidden, ignored, a child directory if
+// ScannerConfig.DeepTraversing is false, deeper than ScannerConfig.MaxDepth or the root of a nested source, which
+// traverses it instead).
+func (s *Scanner) isDirSkipped(src *scanSource, path string) bool {
+	rel, err := relativeSlashPath(src.root, path)
+	if err != nil || rel == "" {
+		return err != nil
+	}
+	name := filepath.Base(path)
+	return !src.deepTraversing || src.isTooDeep(strings.Count(rel, "/")+1) || strings.HasPrefix(name, ".") ||
+		src.ignore.Match(rel, true) || s.sourceOf(path) != src
 }
 
-// scheduleFileUpload performs the actual scheduling process for an object upload job.
-//
-// In addition, it adds a prefix specified in ScannerConfig.PartitionID to create a logical partition.
-func scheduleFileUpload(args scheduleFileUploadArgs) {
-	if args.cfg.Scanner.PartitionID != "" {
-		args.relativePath = fmt.Sprintf("%s/%s", args.cfg.Scanner.PartitionID, args.relativePath)
+// isFileSkipped verifies if a file must not be scheduled (hidden if ScannerConfig.ReadHidden is false or ignored).
+func (s *Scanner) isFileSkipped(src *scanSource, path string) bool {
+	name := filepath.Base(path)
+	isHidden := name != "." && strings.HasPrefix(name, ".")
+	if isHidden && !src.readHidden {
+		return true
 	}
-	args.relativePath = strings.ReplaceAll(args.relativePath, "\\", "/")
+	rel, err := relativeSlashPath(src.root, path)
+	return err != nil || src.ignore.Match(rel, false)
+}
 
-	wasMod, err := args.storage.CheckMod(args.ctx, args.relativePath, args.info.ModTime(), args.info.Size())
-	if !wasMod && err != nil && objectUploadJobQueueErr != nil {
-		objectUploadJobQueueErr <- ErrFileUpload{
-			Key:    args.info.Name(),
-			Parent: err,
-		}
+// loadIgnoreFile reads IgnoreFile patterns (if any) from a directory within a source.
+func (s *Scanner) loadIgnoreFile(src *scanSource, dir string) {
+	rel, err := relativeSlashPath(src.root, dir)
+	if err == nil {
+		err = src.ignore.LoadFile(src.root, rel)
 	}
-	if !wasMod || err != nil {
-		args.wg.Done()
-		return
+	if err != nil && s.cfg.Scanner.LogErrors {
+		log.Err(err).Str("path", dir).Msg("cloudsync: Could not read ignore file")
 	}
+}
 
-	var obj *os.File
-	obj, err = os.Open(args.path)
-	if err != nil && objectUploadJobQueueErr != nil {
-		objectUploadJobQueueErr <- ErrFileUpload{
-			Key:    args.info.Name(),
+// trackLocalKey records the object key of a file found during traversal, so mirror mode keeps its remote
+// counterpart. Does nothing if mirror mode is disabled.
+func (s *Scanner) trackLocalKey(key string) {
+	if s.localKeys != nil {
+		s.localKeys[key] = struct{}{}
+	}
+}
+
+// scheduleFile sends a file modification check job (path and info are required) to check workers unless the file
+// does not pass include, size nor modification time filters (see Scanner.isFileFiltered), so remote storage is never
+// queried for it. Blocks until a worker receives the job or the given context is done.
+//
+// Filtered files are still tracked by mirror mode, so their remote counterparts are kept.
+func (s *Scanner) scheduleFile(ctx context.Context, src *scanSource, job fileJob) error {
+	rel, _ := relativeSlashPath(src.root, job.path)
+	isFiltered := s.isFileFiltered(rel, job.info)
+	if isFiltered && s.localKeys == nil {
+		log.Debug().Str("path", job.path).Msg("cloudsync: Skipped filtered file")
+		return nil // skip building the key as it might require reading the file (e.g. {sha256})
+	}
+	key, err := src.objectKey(&job)
+	if err != nil {
+		s.objectUploadJobQueueErr <- ErrFileUpload{
+			Key:    src.failedObjectKey(job.path, job.info),
+			Path:   job.path,
 			Parent: err,
 		}
-		args.wg.Done()
-		return
+		return nil
 	}
-	if objectUploadJobQueue != nil {
-		DefaultStats.increaseUploadJobs()
-		objectUploadJobQueue <- Object{
-			Key:  args.relativePath,
-			Data: obj,
-			CleanupFunc: func() error {
-				return obj.Close()
-			},
-		}
+	s.trackLocalKey(key)
+	if isFiltered {
+		log.Debug().Str("path", job.path).Msg("cloudsync: Skipped filtered file")
+		return nil
+	}
+	job.key, job.source = key, src
+	return s.scheduleJob(ctx, job)
+}
+
+// scheduleJob sends a file modification check job to check workers. Blocks until a worker receives the job or the
+// given context is done.
+func (s *Scanner) scheduleJob(ctx context.Context, job fileJob) error {
+	if err := ctx.Err(); err != nil {
+		return err // Scanner was stopped
+	}
+	select {
+	case s.fileCheckJobQueue <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
@@ -12,7 +12,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func testScheduleFileUploads(t *testing.T) {
+func TestScanner_ScheduleFileUploads(t *testing.T) {
 	tests := []struct {
 		name            string
 		cfg             Config
@@ -47,6 +47,9 @@ func testScheduleFileUploads(t *testing.T) {
 			name: "Storage non-critical error",
 			cfg: Config{
 				RootDirectory: "./testdata",
+				Scanner: ScannerConfig{
+					Retry: RetryPolicy{BaseBackoff: time.Millisecond},
+				},
 			},
 			storage: NoopBlobStorage{
 				CheckModBool: false,
@@ -181,39 +184,37 @@ func testScheduleFileUploads(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.TODO()
-			if objectUploadJobQueue == nil {
-				objectUploadJobQueue = make(chan Object, 0)
-			}
-			if objectUploadJobQueueErr == nil {
-				objectUploadJobQueueErr = make(chan ErrFileUpload, 0)
-			}
-			wg := sync.WaitGroup{}
+			scanner := newTestScanner(tt.cfg)
 			mu := sync.Mutex{}
 			outKeys := make([]string, 0, len(tt.expReceivedKeys))
-			err := ScheduleFileUploads(ctx, tt.cfg, &wg, tt.storage)
-			assert.Equal(t, tt.expErr, err != nil)
+			checkWg := sync.WaitGroup{}
+			checkWg.Add(2)
+			for i := 0; i < 2; i++ {
+				go func() {
+					defer checkWg.Done()
+					scanner.listenAndExecuteCheckJobs(ctx, tt.storage)
+				}()
+			}
+			done := make(chan struct{})
 			go func() {
-				for work := range objectUploadJobQueue {
+				defer close(done)
+				for work := range scanner.objectUploadJobQueue {
 					mu.Lock()
-					outKeys = append(outKeys, work.Key)
+					outKeys = append(outKeys, work.key)
 					mu.Unlock()
-					_ = work.CleanupFunc()
-					wg.Done()
 				}
 			}()
 			go func() { // required to avoid routine deadlock error
-				for range objectUploadJobQueueErr {
+				for range scanner.objectUploadJobQueueErr {
 				}
 			}()
-			wg.Wait()
-			if objectUploadJobQueue != nil {
-				close(objectUploadJobQueue)
-				objectUploadJobQueue = nil
-			}
-			if objectUploadJobQueueErr != nil {
-				close(objectUploadJobQueueErr)
-				objectUploadJobQueueErr = nil
-			}
+			err := scanner.scheduleFileUploads(ctx)
+			assert.Equal(t, tt.expErr, err != nil)
+			close(scanner.fileCheckJobQueue)
+			checkWg.Wait()
+			close(scanner.objectUploadJobQueue)
+			close(scanner.objectUploadJobQueueErr)
+			<-done
 
 			require.Len(t, outKeys, len(tt.expReceivedKeys))
 			for _, v := range outKeys {
@@ -235,18 +236,28 @@ func (f fakeSystemSignal) String() string {
 
 func (f fakeSystemSignal) Signal() {}
 
-func testListenForSysInterruption(t *testing.T) {
-	wg := sync.WaitGroup{}
+func TestScanner_ListenForSysInterruption(t *testing.T) {
+	scanner := NewScanner(Config{})
 	ctx, cancel := context.WithCancel(context.TODO())
+	scanner.baseCtx, scanner.baseCtxCancel = ctx, cancel
 	c := make(chan os.Signal, 2)
-	ListenForSysInterruption(&wg, cancel, c)
+	go scanner.listenForSysInterruption(context.TODO(), c)
 	go func() {
 		c <- fakeSystemSignal{}
 	}()
 	select {
 	case <-time.After(time.Millisecond * 100):
-		t.Fatal("testListenForSysInterruption: timeout reached")
+		t.Fatal("TestScanner_ListenForSysInterruption: timeout reached")
 	case <-ctx.Done():
 		return
 	}
 }
+
+// newTestScanner allocates a Scanner with its internal queues ready to be used by workers.
+func newTestScanner(cfg Config) *Scanner {
+	scanner := NewScanner(cfg)
+	scanner.fileCheckJobQueue = make(chan fileJob)
+	scanner.objectUploadJobQueue = make(chan fileJob)
+	scanner.objectUploadJobQueueErr = make(chan ErrFileUpload)
+	return scanner
+}
@@ -0,0 +1,218 @@
+package cloudsync
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidSource the specified sources (see ScannerConfig.Sources) are missing or not valid.
+var ErrInvalidSource = errors.New("cloudsync: Invalid source")
+
+// SourceConfig a local directory tree uploaded by Scanner. Settings not specified are inherited from ScannerConfig.
+type SourceConfig struct {
+	// Path directory to upload. Relative paths are resolved from the configuration file directory.
+	Path string `yaml:"path"`
+	// KeyPrefix prefix added to object keys of files within Path, placed after the partition ID (e.g. photos/2023).
+	KeyPrefix string `yaml:"key_prefix"`
+	// PartitionID overrides ScannerConfig.PartitionID for files within Path.
+	PartitionID string `yaml:"partition_id"`
+	// IgnoredKeys gitignore-style patterns evaluated after ScannerConfig.IgnoredKeys, against paths relative to Path.
+	IgnoredKeys []string `yaml:"ignored_keys"`
+	// ReadHidden overrides ScannerConfig.ReadHidden if set.
+	ReadHidden *bool `yaml:"read_hidden"`
+	// DeepTraversing overrides ScannerConfig.DeepTraversing if set.
+	DeepTraversing *bool `yaml:"deep_traversing"`
+	// MaxDepth overrides ScannerConfig.MaxDepth if set.
+	MaxDepth *int `yaml:"max_depth"`
+	// Symlinks overrides ScannerConfig.Symlinks if set.
+	Symlinks SymlinkPolicy `yaml:"symlinks"`
+	// KeyTemplate overrides ScannerConfig.KeyTemplate if set.
+	KeyTemplate string `yaml:"key_template"`
+}
+
+// Sources retrieves every directory tree to upload: Config.RootDirectory (if set) using ScannerConfig settings and
+// then ScannerConfig.Sources, resolving relative paths from the configuration file directory.
+func (c Config) Sources() []SourceConfig {
+	sources := make([]SourceConfig, 0, len(c.Scanner.Sources)+1)
+	if c.RootDirectory != "" {
+		sources = append(sources, SourceConfig{Path: c.RootDirectory})
+	}
+	for _, src := range c.Scanner.Sources {
+		if src.Path != "" {
+			src.Path = c.resolvePath(src.Path, "")
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// validateSources verifies at least one source was specified and every source has a unique path, a valid
+// SymlinkPolicy and a valid key template (if set).
+func validateSources(cfg Config) error {
+	sources := cfg.Sources()
+	if len(sources) == 0 {
+		return fmt.Errorf("%w: no directories were specified", ErrInvalidSource)
+	}
+	paths := make(map[string]struct{}, len(sources))
+	for _, src := range sources {
+		if src.Path == "" {
+			return fmt.Errorf("%w: missing path", ErrInvalidSource)
+		}
+		if src.Symlinks != "" {
+			if err := src.Symlinks.validate(); err != nil {
+				return err
+			}
+		}
+		if _, err := parseKeyTemplate(src.sourceKeyTemplate(cfg.Scanner)); err != nil {
+			return err
+		}
+		path := filepath.Clean(src.Path)
+		if _, ok := paths[path]; ok {
+			return fmt.Errorf("%w: duplicated path %s", ErrInvalidSource, src.Path)
+		}
+		paths[path] = struct{}{}
+	}
+	return nil
+}
+
+// scanSource a directory tree traversed by Scanner with its settings resolved.
+type scanSource struct {
+	root string
+	// absRoot absolute path of root, used to find the source of absolute paths (e.g. from a Journal).
+	absRoot string
+	// realRoot absolute path of root with symbolic links evaluated, used to detect symbolic link cycles.
+	realRoot string
+	// partitionPrefix object key prefix of the source's partition (e.g. "partition/"), empty if none.
+	partitionPrefix string
+	// keyPrefix object key prefix of every file within root, including partitionPrefix (e.g. "partition/photos/").
+	keyPrefix   string
+	keyTemplate *keyTemplate
+	// invertibleKeys indicates whether object keys are keyPrefix followed by relative paths, so keys could be mapped
+	// back to local files (required by mirroring).
+	invertibleKeys bool
+	readHidden     bool
+	deepTraversing bool
+	// maxDepth maximum number of directory levels traversed below root, zero if unlimited.
+	maxDepth int
+	symlinks SymlinkPolicy
+	ignore   *IgnoreMatcher
+	// stats counters of jobs from files within root. Scanner.stats holds the combined counters.
+	stats *Stats
+}
+
+// newScanSources resolves settings of every source from the given Config (see Config.Sources).
+func newScanSources(cfg Config) []*scanSource {
+	configs := cfg.Sources()
+	sources := make([]*scanSource, 0, len(configs))
+	for _, src := range configs {
+		partitionID := cfg.Scanner.PartitionID
+		if src.PartitionID != "" {
+			partitionID = src.PartitionID
+		}
+		s := &scanSource{
+			root:           filepath.Clean(src.Path),
+			readHidden:     cfg.Scanner.ReadHidden,
+			deepTraversing: cfg.Scanner.DeepTraversing,
+			maxDepth:       cfg.Scanner.MaxDepth,
+			symlinks:       cfg.Scanner.Symlinks,
+			ignore:         NewIgnoreMatcher(append(append([]string{}, cfg.Scanner.IgnoredKeys...), src.IgnoredKeys...)),
+			stats:          &Stats{},
+		}
+		if partitionID != "" {
+			s.partitionPrefix = partitionID + "/"
+		}
+		prefix := strings.Trim(strings.ReplaceAll(src.KeyPrefix, "\\", "/"), "/")
+		template, err := newSourceKeyTemplate(src.sourceKeyTemplate(cfg.Scanner), partitionID, prefix, s.root)
+		if err != nil {
+			// templates are verified by validateSources
+			template, _ = newSourceKeyTemplate(DefaultKeyTemplate, partitionID, prefix, s.root)
+		}
+		s.keyTemplate = template
+		s.keyPrefix, s.invertibleKeys = template.staticPrefix()
+		if abs, err := filepath.Abs(s.root); err == nil {
+			s.absRoot = abs
+		} else {
+			s.absRoot = s.root
+		}
+		if realRoot, err := filepath.EvalSymlinks(s.absRoot); err == nil {
+			s.realRoot = realRoot
+		} else {
+			s.realRoot = s.absRoot
+		}
+		if src.ReadHidden != nil {
+			s.readHidden = *src.ReadHidden
+		}
+		if src.DeepTraversing != nil {
+			s.deepTraversing = *src.DeepTraversing
+		}
+		if src.MaxDepth != nil {
+			s.maxDepth = *src.MaxDepth
+		}
+		if src.Symlinks != "" {
+			s.symlinks = src.Symlinks
+		}
+		sources = append(sources, s)
+	}
+	return sources
+}
+
+// sourceKeyTemplate retrieves the key template of the source: SourceConfig.KeyTemplate, ScannerConfig.KeyTemplate or
+// DefaultKeyTemplate.
+func (c SourceConfig) sourceKeyTemplate(cfg ScannerConfig) string {
+	if c.KeyTemplate != "" {
+		return c.KeyTemplate
+	} else if cfg.KeyTemplate != "" {
+		return cfg.KeyTemplate
+	}
+	return DefaultKeyTemplate
+}
+
+// isTooDeep verifies if a directory at the given depth (number of directory levels below root) exceeds the
+// source's maximum depth.
+func (src *scanSource) isTooDeep(depth int) bool {
+	return src.maxDepth > 0 && depth > src.maxDepth
+}
+
+// sourceOf retrieves the source a path belongs to. If sources are nested, the deepest one is retrieved. Returns nil
+// if the path is not within any source.
+func (s *Scanner) sourceOf(path string) *scanSource {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	var owner *scanSource
+	for _, src := range s.sources {
+		rel, err := filepath.Rel(src.absRoot, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if owner == nil || len(src.absRoot) > len(owner.absRoot) {
+			owner = src
+		}
+	}
+	return owner
+}
+
+// sourceOfKey retrieves the source an object key belongs to, using the longest matching key prefix. Returns nil if
+// the key is not within any source.
+func (s *Scanner) sourceOfKey(key string) *scanSource {
+	var owner *scanSource
+	for _, src := range s.sources {
+		if !strings.HasPrefix(key, src.keyPrefix) {
+			continue
+		}
+		if owner == nil || len(src.keyPrefix) > len(owner.keyPrefix) {
+			owner = src
+		}
+	}
+	return owner
+}
+
+// sourceStats retrieves the counters of the source a path belongs to, or nil if none.
+func (s *Scanner) sourceStats(path string) *Stats {
+	if src := s.sourceOf(path); src != nil {
+		return src.stats
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package cloudsync_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Sources(t *testing.T) {
+	cfg := cloudsync.Config{
+		FilePath:      filepath.Join("/etc", "cloudsync", "config.yaml"),
+		RootDirectory: "./foo",
+		Scanner: cloudsync.ScannerConfig{
+			Sources: []cloudsync.SourceConfig{
+				{Path: "bar", KeyPrefix: "bar"},
+				{Path: filepath.Join("/var", "log"), PartitionID: "logs"},
+			},
+		},
+	}
+	sources := cfg.Sources()
+	require.Len(t, sources, 3)
+	assert.Equal(t, "./foo", sources[0].Path)
+	assert.Equal(t, filepath.Join("/etc", "cloudsync", "bar"), sources[1].Path)
+	assert.Equal(t, "bar", sources[1].KeyPrefix)
+	assert.Equal(t, filepath.Join("/var", "log"), sources[2].Path)
+	assert.Equal(t, "logs", sources[2].PartitionID)
+}
+
+func TestScanner_InvalidSources(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  cloudsync.Config
+	}{
+		{name: "Empty", cfg: cloudsync.Config{}},
+		{name: "Missing path", cfg: cloudsync.Config{
+			Scanner: cloudsync.ScannerConfig{Sources: []cloudsync.SourceConfig{{KeyPrefix: "foo"}}},
+		}},
+		{name: "Duplicated path", cfg: cloudsync.Config{
+			RootDirectory: "./testdata",
+			Scanner:       cloudsync.ScannerConfig{Sources: []cloudsync.SourceConfig{{Path: "testdata/"}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cloudsync.NewScanner(tt.cfg).Start(cloudsync.NoopBlobStorage{})
+			assert.ErrorIs(t, err, cloudsync.ErrInvalidSource)
+		})
+	}
+}
+
+func TestScanner_Sources(t *testing.T) {
+	docs, photos, remote := t.TempDir(), t.TempDir(), t.TempDir()
+	files := []string{
+		filepath.Join(docs, "a.txt"),
+		filepath.Join(docs, ".hidden"),
+		filepath.Join(docs, "drafts", "b.txt"),
+		filepath.Join(docs, "drafts", "c.tmp"),
+		filepath.Join(docs, "archive", "d.txt"), // nested source
+		filepath.Join(photos, "e.jpg"),
+		filepath.Join(photos, ".hidden"),
+		filepath.Join(photos, "2023", "f.jpg"),
+	}
+	for _, path := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, []byte("foo"), 0644))
+	}
+	readHidden, deepTraversing := true, false
+	cfg := cloudsync.Config{
+		Cloud: cloudsync.CloudConfig{LocalPath: remote},
+		Scanner: cloudsync.ScannerConfig{
+			PartitionID:    "machine",
+			DeepTraversing: true,
+			Mirror:         true,
+			Sources: []cloudsync.SourceConfig{
+				{Path: docs, KeyPrefix: "/docs/", IgnoredKeys: []string{"*.tmp"}},
+				{Path: filepath.Join(docs, "archive"), PartitionID: "archive"},
+				{Path: photos, KeyPrefix: "photos", ReadHidden: &readHidden, DeepTraversing: &deepTraversing},
+			},
+		},
+	}
+	// objects out of any source are never mirrored
+	require.NoError(t, os.MkdirAll(filepath.Join(remote, "other"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(remote, "other", "g.txt"), []byte("foo"), 0644))
+
+	scanner := cloudsync.NewScanner(cfg)
+	require.NoError(t, scanner.Start(storage.NewLocalFS(cfg)))
+	assert.Equal(t, strings.Join([]string{
+		"archive/d.txt",
+		"machine/docs/a.txt",
+		"machine/docs/drafts/b.txt",
+		"machine/photos/.hidden",
+		"machine/photos/e.jpg",
+		"other/g.txt",
+	}, ","), strings.Join(listRemoteKeys(t, remote), ","))
+
+	assert.EqualValues(t, 5, scanner.Stats().GetTotalUploadJobs())
+	sourceStats := scanner.SourceStats()
+	require.Len(t, sourceStats, 3)
+	assert.EqualValues(t, 2, sourceStats[docs].GetTotalUploadJobs())
+	assert.EqualValues(t, 1, sourceStats[filepath.Join(docs, "archive")].GetTotalUploadJobs())
+	assert.EqualValues(t, 2, sourceStats[photos].GetTotalUploadJobs())
+	assert.EqualValues(t, 6, sourceStats[photos].GetTotalUploadBytes())
+
+	// removed files are mirrored within their own source
+	require.NoError(t, os.Remove(filepath.Join(photos, "e.jpg")))
+	maxDeletePercent := 100.0
+	cfg.Scanner.MirrorMaxDeletePercent = &maxDeletePercent
+	scanner = cloudsync.NewScanner(cfg)
+	require.NoError(t, scanner.Start(storage.NewLocalFS(cfg)))
+	assert.NotContains(t, listRemoteKeys(t, remote), "machine/photos/e.jpg")
+	assert.Len(t, listRemoteKeys(t, remote), 5)
+	assert.EqualValues(t, 1, scanner.SourceStats()[photos].GetTotalDeletedObjects())
+	assert.EqualValues(t, 0, scanner.SourceStats()[docs].GetTotalDeletedObjects())
+}
+
+// listRemoteKeys retrieves the sorted keys of every object stored by a storage.LocalFS within remote, skipping
+// metadata files.
+func listRemoteKeys(t *testing.T, remote string) []string {
+	keys := make([]string, 0)
+	require.NoError(t, filepath.WalkDir(remote, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && !strings.HasPrefix(d.Name(), ".cloudsync-") {
+			rel, _ := filepath.Rel(remote, path)
+			keys = append(keys, filepath.ToSlash(rel))
+		}
+		return err
+	}))
+	sort.Strings(keys)
+	return keys
+}
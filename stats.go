@@ -9,32 +9,62 @@ type Stats struct {
 	currentUploadJobs uint64
 	totalUploadJobs   uint64
 	totalFailedJobs   uint64
+	totalUploadBytes  uint64
+	totalDeletedObjs  uint64
 }
 
-var DefaultStats = &Stats{}
+// add accumulates the totals of other into s.
+func (s *Stats) add(other *Stats) {
+	atomic.AddUint64(&s.totalUploadJobs, other.GetTotalUploadJobs())
+	atomic.AddUint64(&s.totalFailedJobs, other.GetTotalFailedJobs())
+	atomic.AddUint64(&s.totalUploadBytes, other.GetTotalUploadBytes())
+	atomic.AddUint64(&s.totalDeletedObjs, other.GetTotalDeletedObjects())
+}
 
 func (s *Stats) increaseUploadJobs() {
 	atomic.AddUint64(&s.currentUploadJobs, 1)
 	atomic.AddUint64(&s.totalUploadJobs, 1)
 }
 
+// increaseTotalUploadJobs increases the number of upload jobs without tracking them as current jobs.
+func (s *Stats) increaseTotalUploadJobs() {
+	atomic.AddUint64(&s.totalUploadJobs, 1)
+}
+
 func (s *Stats) decreaseUploadJobs() {
-	prev := atomic.LoadUint64(&s.currentUploadJobs)
-	atomic.StoreUint64(&s.currentUploadJobs, prev-1)
+	atomic.AddUint64(&s.currentUploadJobs, ^uint64(0))
 }
 
-func (s Stats) GetTotalUploadJobs() uint64 {
+func (s *Stats) GetTotalUploadJobs() uint64 {
 	return atomic.LoadUint64(&s.totalUploadJobs)
 }
 
-func (s Stats) GetCurrentUploadJobs() uint64 {
+func (s *Stats) GetCurrentUploadJobs() uint64 {
 	return atomic.LoadUint64(&s.currentUploadJobs)
 }
 
+func (s *Stats) addUploadBytes(n int64) {
+	atomic.AddUint64(&s.totalUploadBytes, uint64(n))
+}
+
+// GetTotalUploadBytes retrieves the sum of file sizes scheduled to be uploaded.
+func (s *Stats) GetTotalUploadBytes() uint64 {
+	return atomic.LoadUint64(&s.totalUploadBytes)
+}
+
+func (s *Stats) increaseDeletedObjects() {
+	atomic.AddUint64(&s.totalDeletedObjs, 1)
+}
+
+// GetTotalDeletedObjects retrieves the number of remote objects removed (or moved to trash) by mirror mode.
+func (s *Stats) GetTotalDeletedObjects() uint64 {
+	return atomic.LoadUint64(&s.totalDeletedObjs)
+}
+
 func (s *Stats) increaseFailedJobs() {
 	atomic.AddUint64(&s.totalFailedJobs, 1)
 }
 
-func (s Stats) GetTotalFailedJobs() uint64 {
+func (s *Stats) GetTotalFailedJobs() uint64 {
 	return atomic.LoadUint64(&s.totalFailedJobs)
 }
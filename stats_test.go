@@ -66,3 +66,19 @@ func TestStats_GetTotalFailedJobs(t *testing.T) {
 	wg.Wait()
 	assert.Equal(t, uint64(3), stats.GetTotalFailedJobs())
 }
+
+func TestStats_GetTotalUploadBytes(t *testing.T) {
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	stats := &Stats{}
+	go func() {
+		stats.addUploadBytes(3)
+		wg.Done()
+	}()
+	go func() {
+		stats.addUploadBytes(5)
+		wg.Done()
+	}()
+	wg.Wait()
+	assert.Equal(t, uint64(8), stats.GetTotalUploadBytes())
+}
@@ -3,6 +3,7 @@ package cloudsync
 import (
 	"context"
 	"io"
+	"strings"
 	"time"
 )
 
@@ -32,8 +33,39 @@ type Object struct {
 	Data ReadSeekerAt
 	// CleanupFunc frees resources like underlying buffers.
 	CleanupFunc func() error
+	// Metadata custom key-value pairs stored along the Object (if supported by the blob storage).
+	//
+	// Keys SHOULD use lowercase alphanumeric characters and underscores only, as some vendors restrict metadata key
+	// formats (e.g. Microsoft Azure requires C# identifiers).
+	Metadata map[string]string
+	// ContentType MIME type of Data (e.g. application/json), empty if unknown.
+	ContentType string
+	// CacheControl Cache-Control directives served along the Object (e.g. max-age=3600), if any.
+	CacheControl string
+	// ModTime modification time of the original file. Blob storages persisting it (see MetadataKeyModTime) report it
+	// as ObjectInfo.ModTime and compare against it in BlobStorage.CheckMod.
+	ModTime time.Time
 }
 
+// MetadataKeyChecksum Object.Metadata key holding the base64-encoded SHA-256 checksum of the whole file, calculated
+// before uploading it. Only stored if calculated by Scanner (e.g. checksum change detection or {sha256} keys).
+const MetadataKeyChecksum = "cloudsync_sha256"
+
+const (
+	// MetadataKeyCodec Object.Metadata key holding the algorithm an object was compressed with (e.g. zstd). Objects
+	// stored as they are have no codec.
+	MetadataKeyCodec = "cloudsync_codec"
+	// MetadataKeyOriginalSize Object.Metadata key holding the size in bytes of a compressed object before compression.
+	MetadataKeyOriginalSize = "cloudsync_size"
+)
+
+// Checksum algorithms reported by blob storages in ObjectInfo.ChecksumAlgorithm.
+const (
+	ChecksumSHA256 = "SHA256"
+	ChecksumCRC32C = "CRC32C"
+	ChecksumMD5    = "MD5"
+)
+
 // BlobStorage unit of non-volatile binary large objects (BLOB) persistence.
 type BlobStorage interface {
 	// Upload stores an Object in a remote blob storage.
@@ -47,13 +79,114 @@ type BlobStorage interface {
 	CheckMod(ctx context.Context, key string, modTime time.Time, size int64) (bool, error)
 }
 
+// ObjectInfo Object properties stored in a remote blob storage.
+type ObjectInfo struct {
+	// Key file's path + name or name.
+	Key string
+	// Size Object data length in bytes.
+	Size int64
+	// ModTime last time the Object was written into the remote storage, or the original file modification time if
+	// the blob storage persisted it (see Object.ModTime).
+	ModTime time.Time
+	// Checksum base64-encoded digest of Object data calculated by the remote storage (if available).
+	Checksum string
+	// ChecksumAlgorithm algorithm used to calculate Checksum (e.g. ChecksumSHA256, ChecksumCRC32C).
+	ChecksumAlgorithm string
+	// Metadata custom key-value pairs stored along the Object.
+	Metadata map[string]string
+}
+
+// ObjectIterator walks through a sequence of ObjectInfo fetched lazily from a remote blob storage.
+type ObjectIterator interface {
+	// Next retrieves the next ObjectInfo from the sequence. Returns ErrIteratorDone once no items are left.
+	Next() (ObjectInfo, error)
+}
+
+// BlobDownloader optional BlobStorage capability to read objects from a remote blob storage.
+type BlobDownloader interface {
+	// Download writes an Object's data (using its key) into w. As io.WriterAt is used, implementations might
+	// fetch several parts of the Object concurrently.
+	//
+	// Returns ErrObjectNotFound if no Object was found.
+	Download(ctx context.Context, key string, w io.WriterAt) error
+}
+
+// BlobLister optional BlobStorage capability to list objects from a remote blob storage.
+type BlobLister interface {
+	// List retrieves every Object whose key starts with the given prefix.
+	List(ctx context.Context, prefix string) ObjectIterator
+}
+
+// BlobKeyLister optional BlobStorage capability to list object keys only, implemented by BlobLister decorators
+// performing additional requests per object (e.g. retrieving metadata) to report their properties.
+type BlobKeyLister interface {
+	// ListKeys retrieves every Object whose key starts with the given prefix. Only ObjectInfo keys are reliable.
+	ListKeys(ctx context.Context, prefix string) ObjectIterator
+}
+
+// BlobStater optional BlobStorage capability to retrieve object properties from a remote blob storage.
+type BlobStater interface {
+	// Stat retrieves an Object's properties (using its key).
+	//
+	// Returns ErrObjectNotFound if no Object was found.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// BlobDeleter optional BlobStorage capability to remove objects from a remote blob storage.
+type BlobDeleter interface {
+	// Delete removes one or many objects (using their keys). Missing objects are ignored.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// BlobCopier optional BlobStorage capability to copy objects within a remote blob storage.
+type BlobCopier interface {
+	// Copy duplicates an Object (srcKey) into a new key (dstKey), replacing any Object stored using dstKey.
+	//
+	// Returns ErrObjectNotFound if no Object was found using srcKey.
+	Copy(ctx context.Context, srcKey, dstKey string) error
+}
+
+// SliceObjectIterator ObjectIterator implementation walking through an in-memory ObjectInfo slice.
+type SliceObjectIterator struct {
+	objs []ObjectInfo
+	pos  int
+}
+
+var _ ObjectIterator = &SliceObjectIterator{}
+
+// NewSliceObjectIterator allocates a SliceObjectIterator which will walk through the given ObjectInfo slice.
+func NewSliceObjectIterator(objs []ObjectInfo) *SliceObjectIterator {
+	return &SliceObjectIterator{objs: objs}
+}
+
+func (s *SliceObjectIterator) Next() (ObjectInfo, error) {
+	if s.pos >= len(s.objs) {
+		return ObjectInfo{}, ErrIteratorDone
+	}
+	s.pos++
+	return s.objs[s.pos-1], nil
+}
+
 type NoopBlobStorage struct {
 	UploadErr    error
 	CheckModBool bool
 	CheckModErr  error
+	DownloadErr  error
+	ListObjects  []ObjectInfo
+	StatInfo     ObjectInfo
+	StatErr      error
+	DeleteErr    error
+	CopyErr      error
 }
 
-var _ BlobStorage = NoopBlobStorage{}
+var (
+	_ BlobStorage    = NoopBlobStorage{}
+	_ BlobDownloader = NoopBlobStorage{}
+	_ BlobLister     = NoopBlobStorage{}
+	_ BlobStater     = NoopBlobStorage{}
+	_ BlobDeleter    = NoopBlobStorage{}
+	_ BlobCopier     = NoopBlobStorage{}
+)
 
 func (n NoopBlobStorage) Upload(_ context.Context, _ Object) error {
 	return n.UploadErr
@@ -62,3 +195,29 @@ func (n NoopBlobStorage) Upload(_ context.Context, _ Object) error {
 func (n NoopBlobStorage) CheckMod(_ context.Context, _ string, _ time.Time, _ int64) (bool, error) {
 	return n.CheckModBool, n.CheckModErr
 }
+
+func (n NoopBlobStorage) Download(_ context.Context, _ string, _ io.WriterAt) error {
+	return n.DownloadErr
+}
+
+func (n NoopBlobStorage) List(_ context.Context, prefix string) ObjectIterator {
+	objs := make([]ObjectInfo, 0, len(n.ListObjects))
+	for _, obj := range n.ListObjects {
+		if strings.HasPrefix(obj.Key, prefix) {
+			objs = append(objs, obj)
+		}
+	}
+	return NewSliceObjectIterator(objs)
+}
+
+func (n NoopBlobStorage) Stat(_ context.Context, _ string) (ObjectInfo, error) {
+	return n.StatInfo, n.StatErr
+}
+
+func (n NoopBlobStorage) Delete(_ context.Context, _ ...string) error {
+	return n.DeleteErr
+}
+
+func (n NoopBlobStorage) Copy(_ context.Context, _, _ string) error {
+	return n.CopyErr
+}
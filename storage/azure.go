@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/neutrinocorp/cloudsync"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// azureDefaultBlockSize size of each block staged by AzureBlobStorage if none was specified in
+	// cloudsync.CloudConfig.
+	azureDefaultBlockSize = 8 * 1024 * 1024 // 8 MiB
+	// azureUploadConcurrency number of blocks staged in parallel by a single upload.
+	azureUploadConcurrency = 10
+	// azureCopyPollInterval time to wait between blob copy status checks.
+	azureCopyPollInterval = time.Millisecond * 500
+	// azureMaxBlocks maximum number of committed blocks a single block blob may hold.
+	azureMaxBlocks = 50000
+	// azureMaxBlockSize maximum size of a single staged block.
+	azureMaxBlockSize = 4000 * 1024 * 1024 // 4000 MiB
+)
+
+// ErrAzureBlobTooLarge the object exceeds the maximum block blob size (azureMaxBlocks * azureMaxBlockSize).
+var ErrAzureBlobTooLarge = errors.New("cloudsync: Object exceeds Azure Blob Storage maximum block blob size")
+
+// AzureBlobStorage Microsoft Azure Blob Storage Service concrete implementation of cloudsync.BlobStorage.
+type AzureBlobStorage struct {
+	client    *container.Client
+	blockSize int64
+}
+
+// compile-time interface impl. validation.
+var (
+	_ cloudsync.BlobStorage    = &AzureBlobStorage{}
+	_ cloudsync.BlobDownloader = &AzureBlobStorage{}
+	_ cloudsync.BlobLister     = &AzureBlobStorage{}
+	_ cloudsync.BlobStater     = &AzureBlobStorage{}
+	_ cloudsync.BlobDeleter    = &AzureBlobStorage{}
+	_ cloudsync.BlobCopier     = &AzureBlobStorage{}
+)
+
+// NewAzureBlobStorage allocates a new AzureBlobStorage instance ready to perform underlying Azure Blob Storage API
+// actions using cloudsync.BlobStorage API.
+func NewAzureBlobStorage(c *container.Client, cfg cloudsync.Config) *AzureBlobStorage {
+	blockSize := cfg.Cloud.BlockSize
+	if blockSize <= 0 {
+		blockSize = azureDefaultBlockSize
+	}
+	return &AzureBlobStorage{client: c, blockSize: blockSize}
+}
+
+// newAzureContainerClient allocates an Azure Blob Storage container client using either a shared account key
+// or a shared access signature (SAS) token from cloudsync.CloudConfig.
+//
+// cloudsync.CloudConfig Endpoint may be used to point to a local emulator (e.g. Azurite).
+func newAzureContainerClient(cfg cloudsync.CloudConfig) (*container.Client, error) {
+	serviceURL := cfg.Endpoint
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.StorageAccount)
+	}
+	containerURL := strings.TrimSuffix(serviceURL, "/") + "/" + cfg.Container
+
+	if cfg.AccountKey != "" {
+		cred, err := container.NewSharedKeyCredential(cfg.StorageAccount, cfg.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		return container.NewClientWithSharedKeyCredential(containerURL, cred, nil)
+	}
+	if cfg.SASToken != "" {
+		containerURL += "?" + strings.TrimPrefix(cfg.SASToken, "?")
+	}
+	return container.NewClientWithNoCredential(containerURL, nil)
+}
+
+func (a *AzureBlobStorage) Upload(ctx context.Context, obj cloudsync.Object) error {
+	size, err := obj.Data.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = obj.Data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	blockSize, err := a.uploadBlockSize(size)
+	if err != nil {
+		return err
+	}
+	blockCount := int((size + blockSize - 1) / blockSize)
+	blockIDs := make([]string, blockCount)
+	blob := a.client.NewBlockBlobClient(obj.Key)
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(azureUploadConcurrency)
+	for i := 0; i < blockCount; i++ {
+		// every block id MUST have the same length within a blob
+		blockIDs[i] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", i)))
+		blockID := blockIDs[i]
+		offset := int64(i) * blockSize
+		length := blockSize
+		if offset+length > size {
+			length = size - offset
+		}
+		group.Go(func() error {
+			body := streaming.NopCloser(io.NewSectionReader(obj.Data, offset, length))
+			_, errStage := blob.StageBlock(groupCtx, blockID, body, nil)
+			return errStage
+		})
+	}
+	if err = group.Wait(); err != nil {
+		return newAzureError(err)
+	}
+	_, err = blob.CommitBlockList(ctx, blockIDs, &blockblob.CommitBlockListOptions{
+		HTTPHeaders: newAzureHTTPHeaders(obj),
+		Metadata:    newAzureBlobMetadata(obj.Metadata),
+	})
+	return newAzureError(err)
+}
+
+// newAzureHTTPHeaders converts the content type and Cache-Control directives of an object into Azure Blob Storage
+// HTTP headers.
+func newAzureHTTPHeaders(obj cloudsync.Object) *blob.HTTPHeaders {
+	headers := &blob.HTTPHeaders{}
+	if obj.ContentType != "" {
+		headers.BlobContentType = &obj.ContentType
+	}
+	if obj.CacheControl != "" {
+		headers.BlobCacheControl = &obj.CacheControl
+	}
+	return headers
+}
+
+// uploadBlockSize computes the block size used to stage an object of the given size. The configured block size is
+// grown when the object would otherwise require more than azureMaxBlocks blocks.
+func (a *AzureBlobStorage) uploadBlockSize(size int64) (int64, error) {
+	if size <= a.blockSize*azureMaxBlocks {
+		return a.blockSize, nil
+	}
+	blockSize := (size + azureMaxBlocks - 1) / azureMaxBlocks
+	if blockSize > azureMaxBlockSize {
+		return 0, fmt.Errorf("%w (%d bytes)", ErrAzureBlobTooLarge, size)
+	}
+	return blockSize, nil
+}
+
+func (a *AzureBlobStorage) CheckMod(ctx context.Context, key string, modTime time.Time, size int64) (bool, error) {
+	props, err := a.client.NewBlobClient(key).GetProperties(ctx, nil)
+	switch {
+	case err == nil:
+		return props.ContentLength == nil || *props.ContentLength != size ||
+			props.LastModified == nil || props.LastModified.Before(modTime), nil
+	case bloberror.HasCode(err, bloberror.BlobNotFound):
+		return true, nil // if not found, then allow object writing
+	default:
+		return false, newAzureError(err)
+	}
+}
+
+// isAzureFatalErr verifies if the given error returned by Azure Blob Storage API is non-recoverable
+// (e.g. insufficient permissions, container does not exist).
+func isAzureFatalErr(err error) bool {
+	if bloberror.HasCode(err, bloberror.ContainerNotFound, bloberror.AuthenticationFailed,
+		bloberror.AuthorizationFailure, bloberror.AuthorizationPermissionMismatch,
+		bloberror.InsufficientAccountPermissions) {
+		return true
+	}
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	switch respErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *AzureBlobStorage) Download(ctx context.Context, key string, w io.WriterAt) error {
+	res, err := a.client.NewBlobClient(key).DownloadStream(ctx, nil)
+	if err != nil {
+		return newAzureError(err)
+	}
+	body := res.NewRetryReader(ctx, nil)
+	defer body.Close()
+	return copyToWriterAt(ctx, w, body)
+}
+
+func (a *AzureBlobStorage) List(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	return &azureBlobIterator{
+		ctx: ctx,
+		pager: a.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{
+			Include: container.ListBlobsInclude{Metadata: true},
+			Prefix:  &prefix,
+		}),
+	}
+}
+
+func (a *AzureBlobStorage) Stat(ctx context.Context, key string) (cloudsync.ObjectInfo, error) {
+	props, err := a.client.NewBlobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		return cloudsync.ObjectInfo{}, newAzureError(err)
+	}
+	info := cloudsync.ObjectInfo{
+		Key:      key,
+		Metadata: newAzureMetadata(props.Metadata),
+	}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.LastModified != nil {
+		info.ModTime = *props.LastModified
+	}
+	if len(props.ContentMD5) > 0 {
+		info.Checksum = base64.StdEncoding.EncodeToString(props.ContentMD5)
+		info.ChecksumAlgorithm = cloudsync.ChecksumMD5
+	}
+	return info, nil
+}
+
+func (a *AzureBlobStorage) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		_, err := a.client.NewBlobClient(key).Delete(ctx, nil)
+		if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return newAzureError(err)
+		}
+	}
+	return nil
+}
+
+// Copy duplicates a blob using an asynchronous server-side copy, waiting until it gets completed.
+func (a *AzureBlobStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	dst := a.client.NewBlobClient(dstKey)
+	res, err := dst.StartCopyFromURL(ctx, a.client.NewBlobClient(srcKey).URL(), nil)
+	if err != nil {
+		return newAzureError(err)
+	}
+	status := res.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(azureCopyPollInterval):
+		}
+		props, errProps := dst.GetProperties(ctx, nil)
+		if errProps != nil {
+			return newAzureError(errProps)
+		}
+		status = props.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("cloudsync: Could not copy blob %s, copy status: %s", srcKey, *status)
+	}
+	return nil
+}
+
+// newAzureError converts errors returned by Azure Blob Storage API into cloudsync errors. Other API errors expose
+// their HTTP status code (see cloudsync.IsRetryableError).
+func newAzureError(err error) error {
+	var respErr *azcore.ResponseError
+	switch {
+	case err == nil:
+		return nil
+	case bloberror.HasCode(err, bloberror.BlobNotFound):
+		return cloudsync.ErrObjectNotFound
+	case isAzureFatalErr(err):
+		return cloudsync.ErrFatalStorage
+	case errors.As(err, &respErr):
+		return statusCodeError{code: respErr.StatusCode, err: err}
+	default:
+		return err
+	}
+}
+
+// newAzureMetadata converts Azure Blob Storage metadata into a plain map.
+//
+// Keys are converted to lowercase as Azure Blob Storage API might return them using a different case.
+func newAzureMetadata(metadata map[string]*string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		if v != nil {
+			m[strings.ToLower(k)] = *v
+		}
+	}
+	return m
+}
+
+// newAzureBlobMetadata converts a plain map into Azure Blob Storage metadata.
+func newAzureBlobMetadata(metadata map[string]string) map[string]*string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	m := make(map[string]*string, len(metadata))
+	for k, v := range metadata {
+		v := v
+		m[k] = &v
+	}
+	return m
+}
+
+// azureBlobIterator cloudsync.ObjectIterator implementation fetching Azure Blob Storage blob pages lazily.
+type azureBlobIterator struct {
+	ctx   context.Context
+	pager *runtime.Pager[container.ListBlobsFlatResponse]
+	page  []*container.BlobItem
+}
+
+var _ cloudsync.ObjectIterator = &azureBlobIterator{}
+
+func (i *azureBlobIterator) Next() (cloudsync.ObjectInfo, error) {
+	for len(i.page) == 0 {
+		if !i.pager.More() {
+			return cloudsync.ObjectInfo{}, cloudsync.ErrIteratorDone
+		}
+		out, err := i.pager.NextPage(i.ctx)
+		if err != nil {
+			return cloudsync.ObjectInfo{}, newAzureError(err)
+		}
+		if out.Segment != nil {
+			i.page = out.Segment.BlobItems
+		}
+	}
+
+	item := i.page[0]
+	i.page = i.page[1:]
+	info := cloudsync.ObjectInfo{Metadata: newAzureMetadata(item.Metadata)}
+	if item.Name != nil {
+		info.Key = *item.Name
+	}
+	if item.Properties == nil {
+		return info, nil
+	}
+	if item.Properties.ContentLength != nil {
+		info.Size = *item.Properties.ContentLength
+	}
+	if item.Properties.LastModified != nil {
+		info.ModTime = *item.Properties.LastModified
+	}
+	return info, nil
+}
@@ -0,0 +1,142 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Azurite well-known development account, see: https://github.com/Azure/Azurite#default-storage-account.
+const (
+	azuriteAccount = "devstoreaccount1"
+	azuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// newAzuriteBlobStorage allocates an AzureBlobStorage pointing to a local Azurite instance
+// (e.g. AZURITE_BLOB_ENDPOINT=http://127.0.0.1:10000/devstoreaccount1). Skips the test if no instance was specified.
+func newAzuriteBlobStorage(t *testing.T, blockSize int64) *storage.AzureBlobStorage {
+	endpoint := os.Getenv("AZURITE_BLOB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AZURITE_BLOB_ENDPOINT not set")
+	}
+
+	cfg := cloudsync.Config{
+		Cloud: cloudsync.CloudConfig{
+			Endpoint:       endpoint,
+			StorageAccount: azuriteAccount,
+			AccountKey:     azuriteKey,
+			Container:      strings.ToLower(strings.ReplaceAll(t.Name(), "_", "-")),
+			BlockSize:      blockSize,
+		},
+	}
+	cred, err := container.NewSharedKeyCredential(azuriteAccount, azuriteKey)
+	require.NoError(t, err)
+	client, err := container.NewClientWithSharedKeyCredential(strings.TrimSuffix(endpoint, "/")+"/"+
+		cfg.Cloud.Container, cred, nil)
+	require.NoError(t, err)
+	_, err = client.Create(context.TODO(), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = client.Delete(context.TODO(), nil)
+	})
+	return storage.NewAzureBlobStorage(client, cfg)
+}
+
+func TestAzureBlobStorage_Upload(t *testing.T) {
+	store := newAzuriteBlobStorage(t, 2)
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "123/foo/bar.txt",
+		Data: strings.NewReader("foobar"),
+	}))
+
+	wasMod, err := store.CheckMod(context.TODO(), "123/foo/bar.txt", time.Now().Add(-time.Hour), 6)
+	require.NoError(t, err)
+	assert.False(t, wasMod)
+}
+
+func TestAzureBlobStorage_CheckMod(t *testing.T) {
+	store := newAzuriteBlobStorage(t, 0)
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "foo.txt",
+		Data: strings.NewReader("foo"),
+	}))
+
+	tests := []struct {
+		name    string
+		key     string
+		modTime time.Time
+		size    int64
+		exp     bool
+	}{
+		{
+			name: "Not found",
+			key:  "bar.txt",
+			exp:  true,
+		},
+		{
+			name:    "Not modified",
+			key:     "foo.txt",
+			modTime: time.Now().Add(-time.Hour),
+			size:    3,
+			exp:     false,
+		},
+		{
+			name:    "Size changed",
+			key:     "foo.txt",
+			modTime: time.Now().Add(-time.Hour),
+			size:    2,
+			exp:     true,
+		},
+		{
+			name:    "Newer modification time",
+			key:     "foo.txt",
+			modTime: time.Now().Add(time.Hour),
+			size:    3,
+			exp:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := store.CheckMod(context.TODO(), tt.key, tt.modTime, tt.size)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.exp, out)
+		})
+	}
+}
+
+// sizedReader reports an arbitrary size without holding any data.
+type sizedReader struct {
+	size int64
+}
+
+func (r sizedReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+func (r sizedReader) ReadAt([]byte, int64) (int, error) { return 0, io.EOF }
+
+func (r sizedReader) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekEnd {
+		return r.size + offset, nil
+	}
+	return offset, nil
+}
+
+func TestAzureBlobStorage_UploadTooLarge(t *testing.T) {
+	client, err := container.NewClientWithNoCredential("http://127.0.0.1:0/devstoreaccount1/foo", nil)
+	require.NoError(t, err)
+	store := storage.NewAzureBlobStorage(client, cloudsync.Config{})
+	err = store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "foo.bin",
+		Data: sizedReader{size: 50000*4000*1024*1024 + 1},
+	})
+	assert.ErrorIs(t, err, storage.ErrAzureBlobTooLarge)
+}
@@ -0,0 +1,380 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/neutrinocorp/cloudsync"
+)
+
+// Compression codecs supported by CompressedStorage.
+const (
+	CompressionZstd = "zstd"
+	CompressionGzip = "gzip"
+)
+
+var (
+	// ErrInvalidCompressionCodec the given compression codec is not supported.
+	ErrInvalidCompressionCodec = errors.New("cloudsync: Invalid compression codec")
+	// ErrDecompression an object could not be decompressed (e.g. it was corrupted).
+	ErrDecompression = errors.New("cloudsync: Could not decompress object")
+)
+
+// compressedExtensions extensions of well-known formats which are already compressed.
+var compressedExtensions = []string{
+	".gz", ".tgz", ".zst", ".bz2", ".xz", ".lz4", ".lzma", ".br", ".7z", ".zip", ".rar",
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".avif",
+	".mp3", ".mp4", ".m4a", ".m4v", ".mkv", ".mov", ".webm", ".ogg", ".flac", ".aac",
+	".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp", ".epub", ".jar", ".apk",
+}
+
+// compressedSignatures magic bytes (and their offset) of well-known formats which are already compressed, used when
+// file extensions are not meaningful (e.g. content-addressed keys).
+var compressedSignatures = []struct {
+	offset int
+	magic  string
+}{
+	{magic: "\x1f\x8b"},                 // gzip
+	{magic: "\x28\xb5\x2f\xfd"},         // zstd
+	{magic: "PK\x03\x04"},               // zip (and Office documents, jar, apk...)
+	{magic: "BZh"},                      // bzip2
+	{magic: "\xfd7zXZ\x00"},             // xz
+	{magic: "7z\xbc\xaf\x27\x1c"},       // 7z
+	{magic: "Rar!\x1a\x07"},             // rar
+	{magic: "\x04\x22\x4d\x18"},         // lz4
+	{magic: "\x89PNG\r\n\x1a\n"},        // png
+	{magic: "\xff\xd8\xff"},             // jpeg
+	{magic: "GIF8"},                     // gif
+	{offset: 8, magic: "WEBP"},          // webp (RIFF container)
+	{offset: 4, magic: "ftyp"},          // mp4, mov, heic...
+	{magic: "OggS"},                     // ogg
+	{magic: "fLaC"},                     // flac
+	{magic: "ID3"},                      // mp3
+	{magic: "\x1a\x45\xdf\xa3"},         // matroska, webm
+	{magic: "%PDF"},                     // pdf (streams are usually deflated)
+	{magic: "\x00\x00\x00\x0cjP  \r\n"}, // jpeg 2000
+}
+
+// compressionSniffSize bytes read to detect already compressed data.
+const compressionSniffSize = 16
+
+// CompressedStorage cloudsync.BlobStorage decorator compressing objects data before uploading them, so text-heavy
+// data (e.g. logs) takes less space.
+//
+// Objects are stored as they are if they are empty, already compressed (detected by their key extension or magic
+// bytes) or compression would not make them smaller. Otherwise, the codec and the original size are recorded into
+// object metadata (cloudsync.MetadataKeyCodec and cloudsync.MetadataKeyOriginalSize), so objects are decompressed on
+// download and sizes keep matching local files during change detection. The content type of compressed objects is
+// replaced by the codec one (e.g. application/zstd).
+type CompressedStorage struct {
+	store          cloudsync.BlobStorage
+	codec          string
+	skipExtensions map[string]struct{}
+}
+
+// compile-time interface impl. validation.
+var (
+	_ cloudsync.BlobStorage    = &CompressedStorage{}
+	_ cloudsync.BlobDownloader = &CompressedStorage{}
+	_ cloudsync.BlobLister     = &CompressedStorage{}
+	_ cloudsync.BlobKeyLister  = &CompressedStorage{}
+	_ cloudsync.BlobStater     = &CompressedStorage{}
+	_ cloudsync.BlobDeleter    = &CompressedStorage{}
+	_ cloudsync.BlobCopier     = &CompressedStorage{}
+)
+
+// NewCompressedStorage allocates a new CompressedStorage instance wrapping the given cloudsync.BlobStorage, using
+// cloudsync.CompressionConfig settings. Capabilities not implemented by the wrapped storage return
+// cloudsync.ErrUnsupportedStorage.
+//
+// Returns ErrInvalidCompressionCodec if the codec is neither CompressionZstd nor CompressionGzip.
+func NewCompressedStorage(store cloudsync.BlobStorage, cfg cloudsync.Config) (*CompressedStorage, error) {
+	c := &CompressedStorage{
+		store:          store,
+		codec:          strings.ToLower(cfg.Compression.Codec),
+		skipExtensions: make(map[string]struct{}, len(compressedExtensions)+len(cfg.Compression.SkipExtensions)),
+	}
+	if c.codec == "" {
+		c.codec = CompressionZstd
+	} else if c.codec != CompressionZstd && c.codec != CompressionGzip {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCompressionCodec, cfg.Compression.Codec)
+	}
+	for _, ext := range append(compressedExtensions, cfg.Compression.SkipExtensions...) {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		c.skipExtensions[strings.ToLower(ext)] = struct{}{}
+	}
+	return c, nil
+}
+
+// Upload compresses an object into a temporary file before uploading it.
+func (c *CompressedStorage) Upload(ctx context.Context, obj cloudsync.Object) error {
+	size, err := obj.Data.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	} else if _, err = obj.Data.Seek(0, io.SeekStart); err != nil {
+		return err
+	} else if size == 0 || c.isCompressed(obj.Key, obj.Data) {
+		return c.store.Upload(ctx, obj)
+	}
+
+	tmp, err := os.CreateTemp("", tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if err = c.compress(ctx, tmp, obj.Data); err != nil {
+		return err
+	}
+	compressedSize, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	} else if compressedSize >= size {
+		if _, err = obj.Data.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return c.store.Upload(ctx, obj)
+	} else if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	metadata := make(map[string]string, len(obj.Metadata)+2)
+	for k, v := range obj.Metadata {
+		metadata[k] = v
+	}
+	metadata[cloudsync.MetadataKeyCodec] = c.codec
+	metadata[cloudsync.MetadataKeyOriginalSize] = strconv.FormatInt(size, 10)
+	obj.Data, obj.Metadata, obj.ContentType = tmp, metadata, "application/"+c.codec
+	return c.store.Upload(ctx, obj)
+}
+
+// isCompressed verifies if an object holds already compressed data, either by its key extension or magic bytes.
+func (c *CompressedStorage) isCompressed(key string, data io.ReaderAt) bool {
+	if _, ok := c.skipExtensions[strings.ToLower(path.Ext(key))]; ok {
+		return true
+	}
+	head := make([]byte, compressionSniffSize)
+	n, _ := data.ReadAt(head, 0)
+	head = head[:n]
+	for _, sig := range compressedSignatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.HasPrefix(head[sig.offset:], []byte(sig.magic)) {
+			return true
+		}
+	}
+	return false
+}
+
+// compress writes compressed data from src into w.
+func (c *CompressedStorage) compress(ctx context.Context, w io.Writer, src io.Reader) error {
+	var enc io.WriteCloser
+	var err error
+	if c.codec == CompressionGzip {
+		enc = gzip.NewWriter(w)
+	} else if enc, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1)); err != nil {
+		return err
+	}
+	if _, err = io.Copy(enc, readerWithContext{ctx: ctx, r: src}); err != nil {
+		_ = enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+// newDecompressor allocates a reader decompressing data from src using the given codec.
+func newDecompressor(codec string, src io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case CompressionZstd:
+		dec, err := zstd.NewReader(src, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case CompressionGzip:
+		return gzip.NewReader(src)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCompressionCodec, codec)
+	}
+}
+
+// CheckMod compares the given size against the original size of an object, as the underlying blob storage only
+// knows compressed sizes. Falls back to the underlying blob storage CheckMod if it cannot retrieve object metadata.
+func (c *CompressedStorage) CheckMod(ctx context.Context, key string, modTime time.Time, size int64) (bool, error) {
+	stater, ok := c.store.(cloudsync.BlobStater)
+	if !ok {
+		return c.store.CheckMod(ctx, key, modTime, size)
+	}
+	info, err := stater.Stat(ctx, key)
+	if errors.Is(err, cloudsync.ErrObjectNotFound) {
+		return true, nil // if not found, then allow object writing
+	} else if err != nil {
+		return false, err
+	}
+	info = originalInfo(info)
+	return info.Size != size || info.ModTime.Before(modTime), nil
+}
+
+// Download writes the decompressed data of an object into w. Compressed data is downloaded into a temporary file
+// first, as decompression is sequential.
+func (c *CompressedStorage) Download(ctx context.Context, key string, w io.WriterAt) error {
+	downloader, ok := c.store.(cloudsync.BlobDownloader)
+	if !ok {
+		return cloudsync.ErrUnsupportedStorage
+	}
+	info, err := c.stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	codec := info.Metadata[cloudsync.MetadataKeyCodec]
+	if codec == "" {
+		return downloader.Download(ctx, key, w)
+	}
+
+	tmp, err := os.CreateTemp("", tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if err = downloader.Download(ctx, key, tmp); err != nil {
+		return err
+	} else if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	dec, err := newDecompressor(codec, tmp)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+	dst := &offsetWriter{w: w}
+	if _, err = io.Copy(dst, readerWithContext{ctx: ctx, r: dec}); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("%w: %v", ErrDecompression, err)
+	} else if size, errSize := originalSize(info); errSize == nil && size != dst.offset {
+		return fmt.Errorf("%w: expected %d bytes, got %d", ErrDecompression, size, dst.offset)
+	}
+	return nil
+}
+
+// List retrieves every object whose key starts with the given prefix, with their original sizes. Objects listed
+// without metadata (e.g. by Amazon S3) are stated one by one to find out whether they were compressed; objects
+// removed meanwhile are skipped. Use ListKeys if only keys are needed.
+func (c *CompressedStorage) List(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	lister, ok := c.store.(cloudsync.BlobLister)
+	if !ok {
+		return errObjectIterator{err: cloudsync.ErrUnsupportedStorage}
+	}
+	return compressedObjectIterator{ctx: ctx, store: c, it: lister.List(ctx, prefix)}
+}
+
+// Stat retrieves an object properties with its original size. Checksums calculated by the underlying blob storage
+// are discarded for compressed objects as they digest compressed data.
+func (c *CompressedStorage) Stat(ctx context.Context, key string) (cloudsync.ObjectInfo, error) {
+	info, err := c.stat(ctx, key)
+	if err != nil {
+		return cloudsync.ObjectInfo{}, err
+	}
+	return originalInfo(info), nil
+}
+
+// ListKeys retrieves the key of every object whose key starts with the given prefix. Unlike List, objects are
+// never stated, so their sizes and metadata are reported as the underlying blob storage lists them.
+func (c *CompressedStorage) ListKeys(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	lister, ok := c.store.(cloudsync.BlobLister)
+	if !ok {
+		return errObjectIterator{err: cloudsync.ErrUnsupportedStorage}
+	}
+	return lister.List(ctx, prefix)
+}
+
+// stat retrieves an object properties as reported by the underlying blob storage.
+func (c *CompressedStorage) stat(ctx context.Context, key string) (cloudsync.ObjectInfo, error) {
+	stater, ok := c.store.(cloudsync.BlobStater)
+	if !ok {
+		return cloudsync.ObjectInfo{}, cloudsync.ErrUnsupportedStorage
+	}
+	return stater.Stat(ctx, key)
+}
+
+func (c *CompressedStorage) Delete(ctx context.Context, keys ...string) error {
+	deleter, ok := c.store.(cloudsync.BlobDeleter)
+	if !ok {
+		return cloudsync.ErrUnsupportedStorage
+	}
+	return deleter.Delete(ctx, keys...)
+}
+
+// Copy duplicates an object as it is (i.e. compressed), along its metadata.
+func (c *CompressedStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	copier, ok := c.store.(cloudsync.BlobCopier)
+	if !ok {
+		return cloudsync.ErrUnsupportedStorage
+	}
+	return copier.Copy(ctx, srcKey, dstKey)
+}
+
+// originalSize retrieves the size of a compressed object before compression from its metadata.
+func originalSize(info cloudsync.ObjectInfo) (int64, error) {
+	return strconv.ParseInt(info.Metadata[cloudsync.MetadataKeyOriginalSize], 10, 64)
+}
+
+// originalInfo converts properties of a compressed object into its original ones. Objects stored as they are remain
+// unchanged.
+func originalInfo(info cloudsync.ObjectInfo) cloudsync.ObjectInfo {
+	if info.Metadata[cloudsync.MetadataKeyCodec] == "" {
+		return info
+	}
+	if size, err := originalSize(info); err == nil {
+		info.Size = size
+	}
+	info.Checksum, info.ChecksumAlgorithm = "", ""
+	return info
+}
+
+// compressedObjectIterator cloudsync.ObjectIterator decorator converting properties of compressed objects.
+type compressedObjectIterator struct {
+	ctx   context.Context
+	store *CompressedStorage
+	it    cloudsync.ObjectIterator
+}
+
+var _ cloudsync.ObjectIterator = compressedObjectIterator{}
+
+func (i compressedObjectIterator) Next() (cloudsync.ObjectInfo, error) {
+	for {
+		info, err := i.it.Next()
+		if err != nil {
+			return cloudsync.ObjectInfo{}, err
+		} else if len(info.Metadata) > 0 {
+			return originalInfo(info), nil
+		}
+		stat, err := i.store.stat(i.ctx, info.Key)
+		switch {
+		case err == nil:
+			return originalInfo(stat), nil
+		case errors.Is(err, cloudsync.ErrObjectNotFound):
+			continue // removed after being listed
+		case errors.Is(err, cloudsync.ErrUnsupportedStorage):
+			return originalInfo(info), nil
+		default:
+			return cloudsync.ObjectInfo{}, err
+		}
+	}
+}
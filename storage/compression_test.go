@@ -0,0 +1,233 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCompressedLocalFS allocates an storage.CompressedStorage wrapping a storage.LocalFS stored under root.
+func newCompressedLocalFS(t *testing.T, root string,
+	compression cloudsync.CompressionConfig) *storage.CompressedStorage {
+	cfg := cloudsync.Config{
+		Cloud:       cloudsync.CloudConfig{LocalPath: root},
+		Compression: compression,
+	}
+	store, err := storage.NewCompressedStorage(storage.NewLocalFS(cfg), cfg)
+	require.NoError(t, err)
+	return store
+}
+
+func TestCompressedStorage(t *testing.T) {
+	data := []byte(strings.Repeat("2023-03-10T12:00:00Z INFO request completed\n", 100))
+	for _, codec := range []string{"", storage.CompressionZstd, storage.CompressionGzip} {
+		t.Run("Codec "+codec, func(t *testing.T) {
+			root := t.TempDir()
+			store := newCompressedLocalFS(t, root, cloudsync.CompressionConfig{Enabled: true, Codec: codec})
+			require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+				Key:      "123/app.log",
+				Data:     bytes.NewReader(data),
+				Metadata: map[string]string{cloudsync.MetadataKeyChecksum: "foo"},
+			}))
+
+			stored, err := os.Stat(filepath.Join(root, "123", "app.log"))
+			require.NoError(t, err)
+			assert.Less(t, stored.Size(), int64(len(data))/10)
+
+			info, err := store.Stat(context.TODO(), "123/app.log")
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(data)), info.Size)
+			assert.Empty(t, info.Checksum)
+			expCodec := codec
+			if expCodec == "" {
+				expCodec = storage.CompressionZstd
+			}
+			assert.Equal(t, map[string]string{
+				cloudsync.MetadataKeyChecksum:     "foo",
+				cloudsync.MetadataKeyCodec:        expCodec,
+				cloudsync.MetadataKeyOriginalSize: strconv.Itoa(len(data)),
+			}, info.Metadata)
+
+			wasMod, err := store.CheckMod(context.TODO(), "123/app.log", info.ModTime.Add(-time.Hour), int64(len(data)))
+			require.NoError(t, err)
+			assert.False(t, wasMod)
+			wasMod, err = store.CheckMod(context.TODO(), "123/app.log", info.ModTime.Add(-time.Hour), stored.Size())
+			require.NoError(t, err)
+			assert.True(t, wasMod)
+			wasMod, err = store.CheckMod(context.TODO(), "123/foo.log", time.Time{}, 0)
+			require.NoError(t, err)
+			assert.True(t, wasMod)
+
+			buf := &fileBuffer{}
+			require.NoError(t, store.Download(context.TODO(), "123/app.log", buf))
+			assert.Equal(t, data, buf.data)
+
+			it := store.List(context.TODO(), "123/")
+			listed, err := it.Next()
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(data)), listed.Size)
+		})
+	}
+}
+
+func TestCompressedStorage_Skip(t *testing.T) {
+	text := []byte(strings.Repeat("foo", 100))
+	tests := []struct {
+		name string
+		key  string
+		data []byte
+	}{
+		{name: "Empty", key: "empty.txt"},
+		{name: "Compressed extension", key: "archive.TGZ", data: text},
+		{name: "Configured extension", key: "table.parquet", data: text},
+		{name: "Gzip magic bytes", key: "3a7bd3e2", data: append([]byte{0x1f, 0x8b}, text...)},
+		{name: "MP4 magic bytes", key: "3a7bd3e2", data: append([]byte("\x00\x00\x00\x18ftypmp42"), text...)},
+		{name: "Not smaller", key: "random.txt", data: []byte("a")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			store := newCompressedLocalFS(t, root, cloudsync.CompressionConfig{
+				Enabled:        true,
+				SkipExtensions: []string{"parquet"},
+			})
+			require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+				Key:  tt.key,
+				Data: bytes.NewReader(tt.data),
+			}))
+			stored, err := os.ReadFile(filepath.Join(root, tt.key))
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.data), len(stored))
+
+			info, err := store.Stat(context.TODO(), tt.key)
+			require.NoError(t, err)
+			assert.Empty(t, info.Metadata)
+			assert.NotEmpty(t, info.Checksum)
+			buf := &fileBuffer{}
+			require.NoError(t, store.Download(context.TODO(), tt.key, buf))
+			assert.Equal(t, len(tt.data), len(buf.data))
+		})
+	}
+}
+
+func TestCompressedStorage_Invalid(t *testing.T) {
+	cfg := cloudsync.Config{Compression: cloudsync.CompressionConfig{Enabled: true, Codec: "brotli"}}
+	_, err := storage.NewCompressedStorage(cloudsync.NoopBlobStorage{}, cfg)
+	assert.ErrorIs(t, err, storage.ErrInvalidCompressionCodec)
+
+	root := t.TempDir()
+	store := newCompressedLocalFS(t, root, cloudsync.CompressionConfig{Enabled: true})
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "foo.txt",
+		Data: strings.NewReader(strings.Repeat("foo", 100)),
+	}))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo.txt"), []byte("foo"), 0644))
+	assert.ErrorIs(t, store.Download(context.TODO(), "foo.txt", &fileBuffer{}), storage.ErrDecompression)
+}
+
+func TestCompressedStorage_ScannerRestore(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		t.Run("Encrypt "+strconv.FormatBool(encrypt), func(t *testing.T) {
+			remote, destination := t.TempDir(), t.TempDir()
+			cfg := cloudsync.Config{
+				RootDirectory: "../testdata",
+				Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+				Scanner:       cloudsync.ScannerConfig{PartitionID: "123", DeepTraversing: true},
+				Compression:   cloudsync.CompressionConfig{Enabled: true},
+			}
+			if encrypt {
+				cfg.Encryption = cloudsync.EncryptionConfig{Passphrase: "foo"}
+			}
+			store, err := storage.NewBlobStorage(cfg, storage.LocalFSStr)
+			require.NoError(t, err)
+			require.IsType(t, &storage.CompressedStorage{}, store)
+
+			scan := func() uint64 {
+				scanner := cloudsync.NewScanner(cfg)
+				require.NoError(t, scanner.Start(store))
+				return scanner.Stats().GetTotalUploadJobs()
+			}
+			assert.Equal(t, uint64(5), scan())
+			assert.Equal(t, uint64(0), scan()) // original sizes are compared
+			info, err := store.(cloudsync.BlobStater).Stat(context.TODO(), "123/config.yaml")
+			require.NoError(t, err)
+			assert.Equal(t, storage.CompressionZstd, info.Metadata[cloudsync.MetadataKeyCodec])
+
+			res, err := cloudsync.RestoreObjects(context.TODO(), store, cloudsync.RestoreConfig{
+				PartitionID: "123",
+				Destination: destination,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, uint64(5), res.RestoredObjects)
+			for _, key := range []string{"config.yaml", "config.1.yaml", "foo/bar.yaml"} {
+				exp, errRead := os.ReadFile(filepath.Join("../testdata", key))
+				require.NoError(t, errRead)
+				out, errRead := os.ReadFile(filepath.Join(destination, key))
+				require.NoError(t, errRead)
+				assert.Equal(t, exp, out)
+			}
+		})
+	}
+}
+
+// metadataLessLocalFS storage.LocalFS listing objects without their metadata, as Amazon S3 does, and counting
+// Stat calls.
+type metadataLessLocalFS struct {
+	*storage.LocalFS
+	stats int
+}
+
+func (m *metadataLessLocalFS) List(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	infos := make([]cloudsync.ObjectInfo, 0)
+	it := m.LocalFS.List(ctx, prefix)
+	for info, err := it.Next(); err == nil; info, err = it.Next() {
+		info.Metadata = nil
+		infos = append(infos, info)
+	}
+	return cloudsync.NewSliceObjectIterator(infos)
+}
+
+func (m *metadataLessLocalFS) Stat(ctx context.Context, key string) (cloudsync.ObjectInfo, error) {
+	m.stats++
+	return m.LocalFS.Stat(ctx, key)
+}
+
+func TestCompressedStorage_ListWithoutMetadata(t *testing.T) {
+	cfg := cloudsync.Config{
+		Cloud:       cloudsync.CloudConfig{LocalPath: t.TempDir()},
+		Compression: cloudsync.CompressionConfig{Enabled: true},
+	}
+	lister := &metadataLessLocalFS{LocalFS: storage.NewLocalFS(cfg)}
+	store, err := storage.NewCompressedStorage(lister, cfg)
+	require.NoError(t, err)
+	data := []byte(strings.Repeat("2023-03-10T12:00:00Z INFO request completed\n", 100))
+	for _, key := range []string{"123/app.log", "123/old.log"} {
+		require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{Key: key, Data: bytes.NewReader(data)}))
+	}
+
+	it := store.List(context.TODO(), "123/")
+	require.NoError(t, store.Delete(context.TODO(), "123/old.log")) // objects removed after listing are skipped
+	listed, err := it.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "123/app.log", listed.Key)
+	assert.Equal(t, int64(len(data)), listed.Size)
+	assert.Equal(t, storage.CompressionZstd, listed.Metadata[cloudsync.MetadataKeyCodec])
+	assert.Empty(t, listed.Checksum)
+	_, err = it.Next()
+	assert.ErrorIs(t, err, cloudsync.ErrIteratorDone)
+	assert.Equal(t, 2, lister.stats)
+
+	// listing keys only never stats objects
+	assert.Equal(t, []string{"123/app.log"}, listKeys(t, store.ListKeys(context.TODO(), "123/")))
+	assert.Equal(t, 2, lister.stats)
+}
@@ -0,0 +1,680 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// DefaultEncryptionChunkSize size of plaintext chunks encrypted independently by EncryptedStorage if
+// cloudsync.EncryptionConfig ChunkSize was not set.
+const DefaultEncryptionChunkSize = 64 << 10
+
+var (
+	// ErrInvalidEncryptionKey no key encryption key was configured or the key file does not hold a 32-byte key.
+	ErrInvalidEncryptionKey = errors.New("cloudsync: Invalid encryption key")
+	// ErrDecryption an object could not be decrypted (e.g. it was not encrypted, was tampered with or a different key
+	// encryption key was used).
+	ErrDecryption = errors.New("cloudsync: Could not decrypt object")
+)
+
+const (
+	// encryptionMagic first bytes of every encrypted object, holding the format version.
+	encryptionMagic = "CSE\x01"
+	// key derivation functions used to get the key encryption key (KEK).
+	kdfKeyFile byte = 0
+	kdfScrypt  byte = 1
+	// scrypt parameters recommended for interactive logins (2017).
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	encryptionKeySize  = 32 // AES-256
+	encryptionSaltSize = 16
+	gcmNonceSize       = 12
+	gcmTagSize         = 16
+	// encryptionHeaderSize magic, KDF, salt, chunk size, data encryption key (DEK) nonce and wrapped DEK.
+	encryptionHeaderSize = 4 + 1 + encryptionSaltSize + 4 + gcmNonceSize + encryptionKeySize + gcmTagSize
+	// encryptedContentType content type of encrypted objects, replacing the one of plaintext data.
+	encryptedContentType = "application/octet-stream"
+	// metadataEncryptionInfo HKDF info used to derive the key sealing metadata values from a KEK.
+	metadataEncryptionInfo = "cloudsync metadata encryption"
+)
+
+// EncryptedStorage cloudsync.BlobStorage decorator encrypting objects data on the client-side, so the underlying blob
+// storage never gets plaintext data.
+//
+// Every object is encrypted using a random data encryption key (DEK) and AES-256-GCM, in chunks of a fixed size, each
+// one authenticated on its own (their index and whether they are the last one are part of their nonce, so chunks
+// cannot be reordered nor truncated). The DEK is stored in the object header, wrapped by a key encryption key (KEK)
+// read from a key file or derived from a passphrase using scrypt.
+//
+// As encrypted sizes are predictable, uploads keep satisfying the cloudsync.ReadSeekerAt contract (chunks are encrypted
+// on demand) and sizes are converted, so change detection keeps working. Object metadata values (e.g. checksums,
+// original sizes, file modes and modification times) are sealed as well (see EncryptedStorage.sealMetadata), while
+// object keys are encrypted only if cloudsync.EncryptionConfig EncryptKeys was set (see keyCipher).
+type EncryptedStorage struct {
+	store     cloudsync.BlobStorage
+	chunkSize int64
+	kdf       byte
+	salt      []byte
+	kek       []byte
+	// passphrase used to derive KEKs of objects encrypted using a different salt (e.g. by another host).
+	passphrase []byte
+	mu         sync.Mutex
+	keks       map[string][]byte
+	// keys encrypts object keys, nil if disabled.
+	keys *keyCipher
+}
+
+// compile-time interface impl. validation.
+var (
+	_ cloudsync.BlobStorage    = &EncryptedStorage{}
+	_ cloudsync.BlobDownloader = &EncryptedStorage{}
+	_ cloudsync.BlobLister     = &EncryptedStorage{}
+	_ cloudsync.BlobStater     = &EncryptedStorage{}
+	_ cloudsync.BlobDeleter    = &EncryptedStorage{}
+	_ cloudsync.BlobCopier     = &EncryptedStorage{}
+)
+
+// NewEncryptedStorage allocates a new EncryptedStorage instance wrapping the given cloudsync.BlobStorage, using
+// cloudsync.EncryptionConfig settings. Capabilities not implemented by the wrapped storage return
+// cloudsync.ErrUnsupportedStorage.
+//
+// Returns ErrInvalidEncryptionKey if neither a passphrase nor a valid key file were specified.
+func NewEncryptedStorage(store cloudsync.BlobStorage, cfg cloudsync.Config) (*EncryptedStorage, error) {
+	e := &EncryptedStorage{
+		store:     store,
+		chunkSize: int64(cfg.Encryption.ChunkSize),
+		salt:      make([]byte, encryptionSaltSize),
+		keks:      make(map[string][]byte),
+	}
+	if e.chunkSize <= 0 {
+		e.chunkSize = DefaultEncryptionChunkSize
+	} else if e.chunkSize > math.MaxUint32 {
+		return nil, errors.New("cloudsync: Encryption chunk size must not exceed 4 GiB")
+	}
+
+	var err error
+	switch {
+	case cfg.Encryption.KeyFile != "":
+		e.kdf = kdfKeyFile
+		e.kek, err = readEncryptionKeyFile(cfg.EncryptionKeyPath())
+	case cfg.Encryption.Passphrase != "":
+		e.kdf, e.passphrase = kdfScrypt, []byte(cfg.Encryption.Passphrase)
+		if _, err = rand.Read(e.salt); err != nil {
+			return nil, err
+		}
+		e.kek, err = e.deriveKey(e.salt)
+	default:
+		err = fmt.Errorf("%w: missing passphrase or key file", ErrInvalidEncryptionKey)
+	}
+	if err != nil {
+		return nil, err
+	} else if !cfg.Encryption.EncryptKeys {
+		return e, nil
+	}
+	if e.keys, err = newKeyCipher(e.kdf, e.kek, e.passphrase); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// objectKey retrieves the key an object is stored with in the underlying blob storage.
+func (e *EncryptedStorage) objectKey(key string) (string, error) {
+	if e.keys == nil {
+		return key, nil
+	}
+	return e.keys.encryptKey(key)
+}
+
+// readEncryptionKeyFile reads a 32-byte key, either raw, hex or base64-encoded.
+func readEncryptionKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	} else if len(data) == encryptionKeySize {
+		return data, nil
+	}
+	text := string(bytes.TrimSpace(data))
+	if key, errHex := hex.DecodeString(text); errHex == nil && len(key) == encryptionKeySize {
+		return key, nil
+	} else if key, errB64 := base64.StdEncoding.DecodeString(text); errB64 == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: key file %s must hold a 32-byte key", ErrInvalidEncryptionKey, path)
+}
+
+// deriveKey derives a KEK from the passphrase using the given salt. Keys are cached as deriving them is expensive
+// on purpose.
+func (e *EncryptedStorage) deriveKey(salt []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if kek, ok := e.keks[string(salt)]; ok {
+		return kek, nil
+	}
+	kek, err := scrypt.Key(e.passphrase, salt, scryptN, scryptR, scryptP, encryptionKeySize)
+	if err != nil {
+		return nil, err
+	}
+	e.keks[string(salt)] = kek
+	return kek, nil
+}
+
+// keyOf retrieves the KEK used to encrypt an object, based on its header KDF and salt.
+func (e *EncryptedStorage) keyOf(kdf byte, salt []byte) ([]byte, error) {
+	switch {
+	case kdf != e.kdf:
+		return nil, fmt.Errorf("%w: object was encrypted using a different key type", ErrDecryption)
+	case kdf == kdfKeyFile || bytes.Equal(salt, e.salt):
+		return e.kek, nil
+	default:
+		return e.deriveKey(salt)
+	}
+}
+
+func (e *EncryptedStorage) Upload(ctx context.Context, obj cloudsync.Object) error {
+	size, err := obj.Data.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	} else if _, err = obj.Data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	dek := make([]byte, encryptionKeySize)
+	if _, err = rand.Read(dek); err != nil {
+		return err
+	}
+	header, err := e.newHeader(dek)
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return err
+	}
+	obj.Data = &encryptedReader{
+		src:       obj.Data,
+		size:      size,
+		header:    header,
+		aead:      aead,
+		chunkSize: e.chunkSize,
+		chunkIdx:  -1,
+	}
+	if !obj.ModTime.IsZero() {
+		// sealed along other metadata instead of being persisted by the underlying blob storage in plaintext
+		obj.Metadata = copyMetadata(obj.Metadata)
+		obj.Metadata[cloudsync.MetadataKeyModTime] = cloudsync.FormatModTime(obj.ModTime)
+		obj.ModTime = time.Time{}
+	}
+	if obj.Metadata, err = e.sealMetadata(obj.Metadata); err != nil {
+		return err
+	} else if obj.Key, err = e.objectKey(obj.Key); err != nil {
+		return err
+	}
+	obj.ContentType = encryptedContentType
+	return e.store.Upload(ctx, obj)
+}
+
+// copyMetadata duplicates metadata, so it can be modified without changing the caller's map.
+func copyMetadata(metadata map[string]string) map[string]string {
+	out := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		out[k] = v
+	}
+	return out
+}
+
+// metadataCipher allocates the AEAD sealing metadata values, using a key derived from the given KEK.
+func metadataCipher(kek []byte) (cipher.AEAD, error) {
+	key := make([]byte, encryptionKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, kek, nil, []byte(metadataEncryptionInfo)), key); err != nil {
+		return nil, err
+	}
+	return newGCM(key)
+}
+
+// sealMetadata encrypts every metadata value using AES-256-GCM and a key derived from the KEK, so the underlying
+// blob storage never gets plaintext checksums, sizes nor file properties. Values are authenticated along their
+// metadata key and stored base64-encoded, preceded by the KEK salt and a random nonce.
+func (e *EncryptedStorage) sealMetadata(metadata map[string]string) (map[string]string, error) {
+	if len(metadata) == 0 {
+		return metadata, nil
+	}
+	aead, err := metadataCipher(e.kek)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		out := make([]byte, 0, encryptionSaltSize+gcmNonceSize+len(v)+gcmTagSize)
+		out = append(out, e.salt...)
+		nonce := make([]byte, gcmNonceSize)
+		if _, err = rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		out = append(out, nonce...)
+		sealed[k] = base64.RawStdEncoding.EncodeToString(aead.Seal(out, nonce, []byte(v), []byte(k)))
+	}
+	return sealed, nil
+}
+
+// openMetadata decrypts metadata values sealed by EncryptedStorage.sealMetadata. Values which could not be decrypted
+// (e.g. uploaded without encryption, tampered with or sealed using another key) are discarded.
+func (e *EncryptedStorage) openMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return metadata
+	}
+	opened := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		data, err := base64.RawStdEncoding.DecodeString(v)
+		if err != nil || len(data) < encryptionSaltSize+gcmNonceSize+gcmTagSize {
+			continue
+		}
+		kek, err := e.keyOf(e.kdf, data[:encryptionSaltSize])
+		if err != nil {
+			continue
+		}
+		aead, err := metadataCipher(kek)
+		if err != nil {
+			continue
+		}
+		nonce := data[encryptionSaltSize : encryptionSaltSize+gcmNonceSize]
+		if plain, errOpen := aead.Open(nil, nonce, data[encryptionSaltSize+gcmNonceSize:], []byte(k)); errOpen == nil {
+			opened[k] = string(plain)
+		}
+	}
+	return opened
+}
+
+// newHeader builds the header of an object, wrapping its DEK using the KEK.
+func (e *EncryptedStorage) newHeader(dek []byte) ([]byte, error) {
+	header := make([]byte, 0, encryptionHeaderSize)
+	header = append(header, encryptionMagic...)
+	header = append(header, e.kdf)
+	header = append(header, e.salt...)
+	header = append(header, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(header[len(header)-4:], uint32(e.chunkSize))
+	nonce := make([]byte, gcmNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, nonce...)
+	kek, err := newGCM(e.kek)
+	if err != nil {
+		return nil, err
+	}
+	// header fields are authenticated along the DEK
+	return kek.Seal(header, nonce, dek, header), nil
+}
+
+// openHeader parses the header of an object, unwrapping its DEK.
+func (e *EncryptedStorage) openHeader(header []byte) (dek []byte, chunkSize int64, err error) {
+	if len(header) < encryptionHeaderSize || string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return nil, 0, fmt.Errorf("%w: unknown format", ErrDecryption)
+	}
+	pos := len(encryptionMagic)
+	kdf, salt := header[pos], header[pos+1:pos+1+encryptionSaltSize]
+	pos += 1 + encryptionSaltSize
+	chunkSize = int64(binary.BigEndian.Uint32(header[pos:]))
+	pos += 4
+	nonce := header[pos : pos+gcmNonceSize]
+	pos += gcmNonceSize
+
+	kek, err := e.keyOf(kdf, salt)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, 0, err
+	}
+	dek, err = aead.Open(nil, nonce, header[pos:encryptionHeaderSize], header[:pos])
+	if err != nil || chunkSize <= 0 {
+		return nil, 0, fmt.Errorf("%w: invalid key encryption key", ErrDecryption)
+	}
+	return dek, chunkSize, nil
+}
+
+func (e *EncryptedStorage) CheckMod(ctx context.Context, key string, modTime time.Time, size int64) (bool, error) {
+	objectKey, err := e.objectKey(key)
+	if err != nil {
+		return false, err
+	}
+	return e.store.CheckMod(ctx, objectKey, modTime, encryptedSize(size, e.chunkSize))
+}
+
+// Download writes the decrypted data of an object into w. Encrypted data is downloaded into a temporary file first,
+// so it gets verified before writing plaintext chunks into w.
+func (e *EncryptedStorage) Download(ctx context.Context, key string, w io.WriterAt) error {
+	downloader, ok := e.store.(cloudsync.BlobDownloader)
+	if !ok {
+		return cloudsync.ErrUnsupportedStorage
+	}
+	objectKey, err := e.objectKey(key)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	if err = downloader.Download(ctx, objectKey, tmp); err != nil {
+		return err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+	return e.decrypt(ctx, tmp, info.Size(), w)
+}
+
+// decrypt verifies and decrypts every chunk of an encrypted object (src) holding size bytes, writing plaintext into w.
+func (e *EncryptedStorage) decrypt(ctx context.Context, src io.ReaderAt, size int64, w io.WriterAt) error {
+	header := make([]byte, encryptionHeaderSize)
+	if _, err := src.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("%w: %v", ErrDecryption, err)
+	}
+	dek, chunkSize, err := e.openHeader(header)
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return err
+	}
+
+	sealedSize := chunkSize + gcmTagSize
+	totalChunks := (size - encryptionHeaderSize + sealedSize - 1) / sealedSize
+	if totalChunks == 0 {
+		return fmt.Errorf("%w: missing data", ErrDecryption)
+	}
+	sealed := make([]byte, sealedSize)
+	for i := int64(0); i < totalChunks; i++ {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		offset := encryptionHeaderSize + i*sealedSize
+		n, errRead := src.ReadAt(sealed, offset)
+		if errRead != nil && !(errors.Is(errRead, io.EOF) && offset+int64(n) == size) {
+			return errRead
+		}
+		plain, errOpen := aead.Open(sealed[:0], chunkNonce(i, i == totalChunks-1), sealed[:n], header)
+		if errOpen != nil {
+			return fmt.Errorf("%w: chunk %d was tampered with", ErrDecryption, i)
+		} else if _, err = w.WriteAt(plain, i*chunkSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List retrieves every object whose key starts with the given prefix. If object keys are encrypted, objects within
+// the deepest directory of the prefix are listed and filtered once their keys are decrypted; objects whose keys could
+// not be decrypted (e.g. not uploaded by EncryptedStorage) are skipped.
+func (e *EncryptedStorage) List(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	lister, ok := e.store.(cloudsync.BlobLister)
+	if !ok {
+		return errObjectIterator{err: cloudsync.ErrUnsupportedStorage}
+	} else if e.keys == nil {
+		return encryptedObjectIterator{it: lister.List(ctx, prefix), store: e}
+	}
+	objectPrefix, err := e.keys.encryptPrefix(prefix)
+	if err != nil {
+		return errObjectIterator{err: err}
+	}
+	return encryptedObjectIterator{it: lister.List(ctx, objectPrefix), store: e, prefix: prefix}
+}
+
+// Stat retrieves an object properties with its plaintext size. Checksums calculated by the underlying blob storage
+// are discarded as they digest encrypted data.
+func (e *EncryptedStorage) Stat(ctx context.Context, key string) (cloudsync.ObjectInfo, error) {
+	stater, ok := e.store.(cloudsync.BlobStater)
+	if !ok {
+		return cloudsync.ObjectInfo{}, cloudsync.ErrUnsupportedStorage
+	}
+	objectKey, err := e.objectKey(key)
+	if err != nil {
+		return cloudsync.ObjectInfo{}, err
+	}
+	info, err := stater.Stat(ctx, objectKey)
+	if err != nil {
+		return cloudsync.ObjectInfo{}, err
+	}
+	info.Key = key
+	return e.decryptedInfo(info), nil
+}
+
+func (e *EncryptedStorage) Delete(ctx context.Context, keys ...string) error {
+	deleter, ok := e.store.(cloudsync.BlobDeleter)
+	if !ok {
+		return cloudsync.ErrUnsupportedStorage
+	}
+	objectKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		objectKey, err := e.objectKey(key)
+		if err != nil {
+			return err
+		}
+		objectKeys = append(objectKeys, objectKey)
+	}
+	return deleter.Delete(ctx, objectKeys...)
+}
+
+// Copy duplicates an object as it is (i.e. encrypted using the same DEK).
+func (e *EncryptedStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	copier, ok := e.store.(cloudsync.BlobCopier)
+	if !ok {
+		return cloudsync.ErrUnsupportedStorage
+	}
+	srcObjectKey, err := e.objectKey(srcKey)
+	if err != nil {
+		return err
+	}
+	dstObjectKey, err := e.objectKey(dstKey)
+	if err != nil {
+		return err
+	}
+	return copier.Copy(ctx, srcObjectKey, dstObjectKey)
+}
+
+// decryptedInfo converts properties of an encrypted object into its plaintext ones, opening its metadata. The
+// modification time of the original file is reported if it was sealed along the metadata.
+func (e *EncryptedStorage) decryptedInfo(info cloudsync.ObjectInfo) cloudsync.ObjectInfo {
+	info.Size = decryptedSize(info.Size, e.chunkSize)
+	info.Checksum, info.ChecksumAlgorithm = "", ""
+	info.Metadata = e.openMetadata(info.Metadata)
+	if modTime, err := cloudsync.ParseModTime(info.Metadata[cloudsync.MetadataKeyModTime]); err == nil {
+		info.ModTime = modTime
+	}
+	return info
+}
+
+// encryptedSize calculates the size of an object holding size plaintext bytes once encrypted.
+func encryptedSize(size, chunkSize int64) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		chunks = 1 // empty objects hold a single empty chunk
+	}
+	return encryptionHeaderSize + size + chunks*gcmTagSize
+}
+
+// decryptedSize calculates the plaintext size of an encrypted object holding size bytes. Returns size if the object
+// is too small to be encrypted.
+func decryptedSize(size, chunkSize int64) int64 {
+	body := size - encryptionHeaderSize
+	if body < gcmTagSize {
+		return size
+	}
+	sealedSize := chunkSize + gcmTagSize
+	return body - (body+sealedSize-1)/sealedSize*gcmTagSize
+}
+
+// chunkNonce builds the nonce of a chunk from its index, flagging the last chunk of an object.
+func chunkNonce(index int64, isLast bool) []byte {
+	nonce := make([]byte, gcmNonceSize)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if isLast {
+		nonce[gcmNonceSize-1] = 1
+	}
+	return nonce
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedReader cloudsync.ReadSeekerAt implementation encrypting plaintext data (src) on demand. Chunks are
+// encrypted as they are read, so any part of the encrypted object might be read at any time (e.g. by multipart
+// uploads).
+type encryptedReader struct {
+	src       io.ReaderAt
+	size      int64
+	header    []byte
+	aead      cipher.AEAD
+	chunkSize int64
+	offset    int64
+
+	// mu guards the latest encrypted chunk, reused by consecutive reads.
+	mu       sync.Mutex
+	chunkIdx int64
+	chunk    []byte
+}
+
+var _ cloudsync.ReadSeekerAt = &encryptedReader{}
+
+func (r *encryptedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *encryptedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += encryptedSize(r.size, r.chunkSize)
+	default:
+		return 0, errors.New("cloudsync: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("cloudsync: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *encryptedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("cloudsync: negative offset")
+	}
+	total := encryptedSize(r.size, r.chunkSize)
+	n := 0
+	for n < len(p) && off < total {
+		var copied int
+		if off < encryptionHeaderSize {
+			copied = copy(p[n:], r.header[off:])
+		} else {
+			var err error
+			if copied, err = r.readChunk(p[n:], off-encryptionHeaderSize); err != nil {
+				return n, err
+			}
+		}
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readChunk copies encrypted data into p, starting from the given offset within encrypted chunks (i.e. without the
+// header).
+func (r *encryptedReader) readChunk(p []byte, off int64) (int, error) {
+	sealedSize := r.chunkSize + gcmTagSize
+	idx := off / sealedSize
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if idx != r.chunkIdx {
+		start := idx * r.chunkSize
+		length := r.size - start
+		if length > r.chunkSize {
+			length = r.chunkSize
+		}
+		plain := make([]byte, length, length+gcmTagSize)
+		if n, err := r.src.ReadAt(plain, start); n < len(plain) {
+			if err == nil || errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF // file was truncated during upload
+			}
+			return 0, err
+		}
+		isLast := start+length >= r.size
+		r.chunk, r.chunkIdx = r.aead.Seal(plain[:0], chunkNonce(idx, isLast), plain, r.header), idx
+	}
+	return copy(p, r.chunk[off-idx*sealedSize:]), nil
+}
+
+// encryptedObjectIterator cloudsync.ObjectIterator decorator converting properties of encrypted objects. If object
+// keys are encrypted, they are decrypted and filtered using the plaintext prefix.
+type encryptedObjectIterator struct {
+	it     cloudsync.ObjectIterator
+	store  *EncryptedStorage
+	prefix string
+}
+
+var _ cloudsync.ObjectIterator = encryptedObjectIterator{}
+
+func (i encryptedObjectIterator) Next() (cloudsync.ObjectInfo, error) {
+	for {
+		info, err := i.it.Next()
+		if err != nil {
+			return cloudsync.ObjectInfo{}, err
+		} else if i.store.keys == nil {
+			return i.store.decryptedInfo(info), nil
+		}
+		key, err := i.store.keys.decryptKey(info.Key)
+		if err != nil || !strings.HasPrefix(key, i.prefix) {
+			continue
+		}
+		info.Key = key
+		return i.store.decryptedInfo(info), nil
+	}
+}
+
+// errObjectIterator cloudsync.ObjectIterator failing with the given error.
+type errObjectIterator struct {
+	err error
+}
+
+func (i errObjectIterator) Next() (cloudsync.ObjectInfo, error) {
+	return cloudsync.ObjectInfo{}, i.err
+}
@@ -0,0 +1,382 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plaintextMarker high-entropy value which must never be found within encrypted objects.
+const plaintextMarker = "cloudsync-marker:9f3b61c07e2ad4586b1fe0c93a7d2e4815c6b0f9"
+
+// newEncryptedLocalFS allocates an storage.EncryptedStorage wrapping a storage.LocalFS stored under root.
+func newEncryptedLocalFS(t *testing.T, root string, encryption cloudsync.EncryptionConfig) *storage.EncryptedStorage {
+	cfg := cloudsync.Config{
+		Cloud:      cloudsync.CloudConfig{LocalPath: root},
+		Encryption: encryption,
+	}
+	store, err := storage.NewEncryptedStorage(storage.NewLocalFS(cfg), cfg)
+	require.NoError(t, err)
+	return store
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	root := t.TempDir()
+	store := newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{Passphrase: "foo", ChunkSize: 16})
+	for _, size := range []int{0, 1, 15, 16, 17, 53} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			data := bytes.Repeat([]byte("a"), size)
+			key := "123/" + strconv.Itoa(size) + ".txt"
+			require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+				Key:  key,
+				Data: bytes.NewReader(data),
+			}))
+
+			info, err := store.Stat(context.TODO(), key)
+			require.NoError(t, err)
+			assert.Equal(t, int64(size), info.Size)
+			assert.Empty(t, info.Checksum)
+			wasMod, err := store.CheckMod(context.TODO(), key, info.ModTime.Add(-time.Hour), int64(size))
+			require.NoError(t, err)
+			assert.False(t, wasMod)
+
+			buf := &fileBuffer{}
+			require.NoError(t, store.Download(context.TODO(), key, buf))
+			assert.Equal(t, data, append([]byte{}, buf.data...))
+		})
+	}
+
+	it := store.List(context.TODO(), "123/")
+	for {
+		info, err := it.Next()
+		if err != nil {
+			assert.ErrorIs(t, err, cloudsync.ErrIteratorDone)
+			break
+		}
+		assert.Equal(t, filepath.Base(info.Key), strconv.FormatInt(info.Size, 10)+".txt")
+	}
+
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "456/marker.txt",
+		Data: strings.NewReader(strings.Repeat(plaintextMarker, 3)),
+	}))
+	encrypted, err := os.ReadFile(filepath.Join(root, "456", "marker.txt"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), plaintextMarker)
+}
+
+func TestEncryptedStorage_ReadAt(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	rec := &recorderStorage{}
+	store, err := storage.NewEncryptedStorage(rec, cloudsync.Config{
+		Encryption: cloudsync.EncryptionConfig{Passphrase: "foo", ChunkSize: 8},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{Key: "foo.txt", Data: bytes.NewReader(data)}))
+
+	// parts read in any order (e.g. multipart uploads) match sequential reads
+	assert.Equal(t, rec.sequential, rec.parts)
+
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo.txt"), rec.sequential, 0644))
+	buf := &fileBuffer{}
+	store = newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{Passphrase: "foo", ChunkSize: 8})
+	require.NoError(t, store.Download(context.TODO(), "foo.txt", buf))
+	assert.Equal(t, data, buf.data)
+}
+
+func TestEncryptedStorage_Metadata(t *testing.T) {
+	checksum := "LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564="
+	modTime := time.Date(2023, 3, 10, 12, 0, 0, 123, time.UTC)
+	metadata := map[string]string{
+		cloudsync.MetadataKeyChecksum:     checksum,
+		cloudsync.MetadataKeyOriginalSize: "987654321",
+		cloudsync.MetadataKeyMode:         "0640",
+	}
+	rec := &recorderStorage{}
+	store, err := storage.NewEncryptedStorage(rec, cloudsync.Config{
+		Encryption: cloudsync.EncryptionConfig{Passphrase: "foo"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:      "foo.txt",
+		Data:     strings.NewReader("foo"),
+		Metadata: metadata,
+		ModTime:  modTime,
+	}))
+
+	// the underlying blob storage never gets plaintext metadata values
+	assert.True(t, rec.obj.ModTime.IsZero())
+	require.Len(t, rec.obj.Metadata, 4)
+	for k, v := range rec.obj.Metadata {
+		assert.NotContains(t, v, checksum, k)
+		assert.NotContains(t, v, "987654321", k)
+		assert.NotContains(t, v, "0640", k)
+		assert.NotContains(t, v, "2023-03-10", k)
+	}
+
+	root := t.TempDir()
+	store = newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{Passphrase: "foo"})
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:      "foo.txt",
+		Data:     strings.NewReader("foo"),
+		Metadata: metadata,
+		ModTime:  modTime,
+	}))
+	raw, err := os.ReadFile(filepath.Join(root, ".cloudsync-meta-foo.txt.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), checksum)
+	assert.NotContains(t, string(raw), "987654321")
+
+	// another host (i.e. using another salt) opens metadata values
+	store = newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{Passphrase: "foo"})
+	info, err := store.Stat(context.TODO(), "foo.txt")
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime))
+	delete(info.Metadata, cloudsync.MetadataKeyModTime)
+	assert.Equal(t, metadata, info.Metadata)
+
+	// values which could not be opened are discarded
+	store = newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{Passphrase: "bar"})
+	info, err = store.Stat(context.TODO(), "foo.txt")
+	require.NoError(t, err)
+	assert.Empty(t, info.Metadata)
+}
+
+func TestEncryptedStorage_Keys(t *testing.T) {
+	root := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(hex.EncodeToString(bytes.Repeat([]byte{1}, 32))+"\n"), 0600))
+
+	store := newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{KeyFile: keyFile})
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "key.txt",
+		Data: bytes.NewReader([]byte("foo")),
+	}))
+	store = newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{Passphrase: "foo"})
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "passphrase.txt",
+		Data: bytes.NewReader([]byte("foo")),
+	}))
+
+	tests := []struct {
+		name       string
+		encryption cloudsync.EncryptionConfig
+		key        string
+		err        error
+	}{
+		{name: "Key file", encryption: cloudsync.EncryptionConfig{KeyFile: keyFile}, key: "key.txt"},
+		{name: "Passphrase", encryption: cloudsync.EncryptionConfig{Passphrase: "foo"}, key: "passphrase.txt"},
+		{
+			name:       "Wrong passphrase",
+			encryption: cloudsync.EncryptionConfig{Passphrase: "bar"},
+			key:        "passphrase.txt",
+			err:        storage.ErrDecryption,
+		},
+		{
+			name:       "Different key type",
+			encryption: cloudsync.EncryptionConfig{Passphrase: "foo"},
+			key:        "key.txt",
+			err:        storage.ErrDecryption,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &fileBuffer{}
+			err := newEncryptedLocalFS(t, root, tt.encryption).Download(context.TODO(), tt.key, buf)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				assert.Equal(t, "foo", string(buf.data))
+			}
+		})
+	}
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("short"), 0600))
+	_, err := storage.NewEncryptedStorage(cloudsync.NoopBlobStorage{}, cloudsync.Config{
+		Encryption: cloudsync.EncryptionConfig{KeyFile: keyFile},
+	})
+	assert.ErrorIs(t, err, storage.ErrInvalidEncryptionKey)
+	_, err = storage.NewEncryptedStorage(cloudsync.NoopBlobStorage{}, cloudsync.Config{})
+	assert.ErrorIs(t, err, storage.ErrInvalidEncryptionKey)
+}
+
+func TestEncryptedStorage_Tampered(t *testing.T) {
+	root := t.TempDir()
+	store := newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{Passphrase: "foo", ChunkSize: 16})
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "foo.txt",
+		Data: bytes.NewReader(bytes.Repeat([]byte("a"), 40)),
+	}))
+	path := filepath.Join(root, "foo.txt")
+	encrypted, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Flipped bit", data: append(append([]byte{}, encrypted[:100]...), append([]byte{encrypted[100] ^ 1},
+			encrypted[101:]...)...)},
+		{name: "Truncated", data: encrypted[:len(encrypted)-24]},
+		{name: "Not encrypted", data: []byte("foo")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(path, tt.data, 0644))
+			assert.ErrorIs(t, store.Download(context.TODO(), "foo.txt", &fileBuffer{}), storage.ErrDecryption)
+		})
+	}
+}
+
+func TestEncryptedStorage_ScannerRestore(t *testing.T) {
+	for _, encryptKeys := range []bool{false, true} {
+		t.Run("Encrypt keys "+strconv.FormatBool(encryptKeys), func(t *testing.T) {
+			remote, destination := t.TempDir(), t.TempDir()
+			cfg := cloudsync.Config{
+				RootDirectory: "../testdata",
+				Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+				Scanner:       cloudsync.ScannerConfig{PartitionID: "123", DeepTraversing: true},
+				Encryption:    cloudsync.EncryptionConfig{Passphrase: "foo", EncryptKeys: encryptKeys},
+			}
+			store, err := storage.NewBlobStorage(cfg, storage.LocalFSStr)
+			require.NoError(t, err)
+			require.IsType(t, &storage.EncryptedStorage{}, store)
+
+			scan := func() uint64 {
+				scanner := cloudsync.NewScanner(cfg)
+				require.NoError(t, scanner.Start(store))
+				return scanner.Stats().GetTotalUploadJobs()
+			}
+			assert.Equal(t, uint64(5), scan())
+			assert.Equal(t, uint64(0), scan()) // encrypted sizes are converted
+			_, err = os.Stat(filepath.Join(remote, "123", "foo"))
+			assert.Equal(t, encryptKeys, os.IsNotExist(err))
+
+			res, err := cloudsync.RestoreObjects(context.TODO(), store, cloudsync.RestoreConfig{
+				PartitionID: "123",
+				Destination: destination,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, uint64(5), res.RestoredObjects)
+			for _, key := range []string{"config.yaml", "foo/bar.yaml"} {
+				exp, errRead := os.ReadFile(filepath.Join("../testdata", key))
+				require.NoError(t, errRead)
+				out, errRead := os.ReadFile(filepath.Join(destination, key))
+				require.NoError(t, errRead)
+				assert.Equal(t, exp, out)
+			}
+		})
+	}
+}
+
+func TestEncryptedStorage_EncryptKeys(t *testing.T) {
+	root := t.TempDir()
+	encryption := cloudsync.EncryptionConfig{Passphrase: "foo", EncryptKeys: true}
+	store := newEncryptedLocalFS(t, root, encryption)
+	for _, key := range []string{"123/clients/acme/contract.pdf", "123/clients/acme.txt", "123/other/contract.pdf"} {
+		require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+			Key:  key,
+			Data: bytes.NewReader([]byte(key)),
+		}))
+	}
+	// symbolic link targets are encrypted along other metadata values
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:      "123/link.pdf",
+		Data:     strings.NewReader("clients/acme/contract.pdf"),
+		Metadata: map[string]string{cloudsync.MetadataKeySymlink: "clients/acme/contract.pdf"},
+	}))
+	require.NoError(t, filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		for _, name := range []string{"123", "clients", "acme", "contract", "other", "link"} {
+			assert.NotContains(t, path[len(root):], name)
+		}
+		if err == nil && !d.IsDir() {
+			data, errRead := os.ReadFile(path)
+			require.NoError(t, errRead)
+			assert.NotContains(t, string(data), "acme")
+		}
+		return err
+	}))
+	info, err := store.Stat(context.TODO(), "123/link.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "clients/acme/contract.pdf", info.Metadata[cloudsync.MetadataKeySymlink])
+	require.NoError(t, store.Delete(context.TODO(), "123/link.pdf"))
+
+	// names whose encrypted segments would exceed 255 bytes are rejected
+	err = store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "123/" + strings.Repeat("a", storage.MaxEncryptedKeySegmentSize+1),
+		Data: strings.NewReader("foo"),
+	})
+	assert.ErrorIs(t, err, storage.ErrKeySegmentTooLong)
+
+	// keys are encrypted the same way by other instances
+	store = newEncryptedLocalFS(t, root, encryption)
+	assert.ElementsMatch(t, []string{"123/clients/acme/contract.pdf", "123/clients/acme.txt"},
+		listKeys(t, store.List(context.TODO(), "123/clients/")))
+	assert.ElementsMatch(t, []string{"123/clients/acme/contract.pdf", "123/clients/acme.txt"},
+		listKeys(t, store.List(context.TODO(), "123/clients/ac")))
+	assert.ElementsMatch(t, []string{"123/other/contract.pdf"}, listKeys(t, store.List(context.TODO(), "123/o")))
+	assert.Len(t, listKeys(t, store.List(context.TODO(), "")), 3)
+
+	info, err = store.Stat(context.TODO(), "123/clients/acme.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "123/clients/acme.txt", info.Key)
+	assert.Equal(t, int64(len("123/clients/acme.txt")), info.Size)
+	require.NoError(t, store.Copy(context.TODO(), "123/clients/acme.txt", "123/.trash/acme.txt"))
+	require.NoError(t, store.Delete(context.TODO(), "123/clients/acme.txt"))
+	buf := &fileBuffer{}
+	require.NoError(t, store.Download(context.TODO(), "123/.trash/acme.txt", buf))
+	assert.Equal(t, "123/clients/acme.txt", string(buf.data))
+	_, err = store.Stat(context.TODO(), "123/clients/acme.txt")
+	assert.ErrorIs(t, err, cloudsync.ErrObjectNotFound)
+
+	// keys encrypted using another passphrase are skipped
+	store = newEncryptedLocalFS(t, root, cloudsync.EncryptionConfig{Passphrase: "bar", EncryptKeys: true})
+	assert.Empty(t, listKeys(t, store.List(context.TODO(), "")))
+}
+
+// recorderStorage cloudsync.BlobStorage recording uploaded data, both read sequentially and in reverse order parts.
+type recorderStorage struct {
+	cloudsync.NoopBlobStorage
+	sequential []byte
+	parts      []byte
+	obj        cloudsync.Object
+}
+
+func (r *recorderStorage) Upload(_ context.Context, obj cloudsync.Object) error {
+	r.obj = obj
+	size, err := obj.Data.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	r.parts = make([]byte, size)
+	const partSize = 7
+	for off := (size - 1) / partSize * partSize; off >= 0; off -= partSize {
+		if _, err = obj.Data.ReadAt(r.parts[off:min64(off+partSize, size)], off); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	if _, err = obj.Data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r.sequential, err = io.ReadAll(obj.Data)
+	return err
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,23 @@
+package storage
+
+// statusCodeError error decorator exposing the HTTP status code of a failed API request, so
+// cloudsync.IsRetryableError classifies errors from every driver the same way as the ones from AWS SDK.
+type statusCodeError struct {
+	code int
+	err  error
+}
+
+var _ error = statusCodeError{}
+
+func (e statusCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e statusCodeError) Unwrap() error {
+	return e.err
+}
+
+// HTTPStatusCode retrieves the HTTP status code of the failed request.
+func (e statusCodeError) HTTPStatusCode() int {
+	return e.code
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	apiErr := errors.New("api error")
+	tests := []struct {
+		err error
+		exp bool
+	}{
+		{err: ErrKeySegmentTooLong, exp: false},
+		{err: fmt.Errorf("%w: foo", ErrDecryption), exp: false},
+		{err: fmt.Errorf("%w (%d bytes)", ErrAzureBlobTooLarge, 1), exp: false},
+		{err: ErrInvalidCompressionCodec, exp: false},
+		{err: statusCodeError{code: http.StatusBadRequest, err: apiErr}, exp: false},
+		{err: statusCodeError{code: http.StatusConflict, err: apiErr}, exp: false},
+		{err: statusCodeError{code: http.StatusTooManyRequests, err: apiErr}, exp: true},
+		{err: statusCodeError{code: http.StatusBadGateway, err: apiErr}, exp: true},
+		{err: statusCodeError{code: http.StatusServiceUnavailable, err: apiErr}, exp: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.err), func(t *testing.T) {
+			assert.Equal(t, tt.exp, cloudsync.IsRetryableError(tt.err))
+		})
+	}
+}
@@ -4,17 +4,20 @@ import (
 	"context"
 	"errors"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
+	gcs "cloud.google.com/go/storage"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/neutrinocorp/cloudsync"
+	"google.golang.org/api/option"
 )
 
 // ErrInvalidBlobStorage the given blob storage type is invalid.
 var ErrInvalidBlobStorage = errors.New("cloudsync: Invalid blob storage")
 
-// BlobStoreType a kind of blob storage (Amazon S3, Google Drive, Google Cloud Storage and/or Microsoft Azure Blob
-// Storage).
+// ErrInvalidCACert the given certificate authority (CA) file contains no valid PEM certificates.
+var ErrInvalidCACert = errors.New("cloudsync: Invalid CA certificate file")
+
+// BlobStoreType a kind of blob storage (Amazon S3, Google Drive, Google Cloud Storage, Microsoft Azure Blob
+// Storage and/or local file system).
 type BlobStoreType uint8
 
 const (
@@ -27,11 +30,14 @@ const (
 	GoogleCloudStore
 	// AzureBlobStore blob storage for Microsoft Azure Blob Storage Service.
 	AzureBlobStore
+	// LocalFSStore blob storage for host's local file system (e.g. a mounted network share).
+	LocalFSStore
 
 	AmazonS3Str    = "AMAZON_S3"
 	GoogleDriveStr = "GOOGLE_DRIVE"
 	GoogleCloudStr = "GCP_STORAGE"
 	AzureBlobStr   = "MS_AZURE_BLOB"
+	LocalFSStr     = "LOCAL_FS"
 )
 
 // BlobStoreMap readable name mapping to BlobStoreType.
@@ -40,32 +46,64 @@ var BlobStoreMap = map[string]BlobStoreType{
 	GoogleDriveStr: GoogleDriveStore,
 	GoogleCloudStr: GoogleCloudStore,
 	AzureBlobStr:   AzureBlobStore,
+	LocalFSStr:     LocalFSStore,
 }
 
-// NewBlobStorage allocates a new cloudsync.BlobStorage concrete implementation based on given BlobStoreType.
+// NewBlobStorage allocates a new cloudsync.BlobStorage concrete implementation based on given BlobStoreType. The
+// implementation is wrapped by EncryptedStorage if client-side encryption was configured (see
+// cloudsync.EncryptionConfig) and then by CompressedStorage if compression was enabled (see
+// cloudsync.CompressionConfig), so data gets compressed before being encrypted.
 func NewBlobStorage(cfg cloudsync.Config, storageType string) (cloudsync.BlobStorage, error) {
+	store, err := newBlobStorageDriver(cfg, storageType)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.IsEnabled() {
+		if store, err = NewEncryptedStorage(store, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if !cfg.Compression.Enabled {
+		return store, nil
+	}
+	return NewCompressedStorage(store, cfg)
+}
+
+// newBlobStorageDriver allocates the cloudsync.BlobStorage driver of the given BlobStoreType.
+func newBlobStorageDriver(cfg cloudsync.Config, storageType string) (cloudsync.BlobStorage, error) {
 	switch BlobStoreMap[storageType] {
 	case AmazonS3Store:
-		var credOpts config.LoadOptionsFunc
-		if cfg.Cloud.AccessKey != "" && cfg.Cloud.SecretKey != "" {
-			credOpts = config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.Cloud.AccessKey,
-				cfg.Cloud.SecretKey, ""))
-		}
-		awsCfg, err := config.LoadDefaultConfig(context.Background(),
-			config.WithRegion(cfg.Cloud.Region), credOpts)
+		awsCfg, err := newAmazonS3Config(context.Background(), cfg.Cloud)
 		if err != nil {
 			return nil, err
 		}
-		return NewAmazonS3(s3.NewFromConfig(awsCfg), cfg), nil
+		return NewAmazonS3(s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			o.UsePathStyle = cfg.Cloud.UsePathStyle
+		}), cfg), nil
 	case GoogleDriveStore:
 		// TODO: Add G Drive implementation
 		return nil, ErrInvalidBlobStorage
 	case GoogleCloudStore:
-		// TODO: Add GCP Storage implementation
-		return nil, ErrInvalidBlobStorage
+		opts := make([]option.ClientOption, 0, 2)
+		if cfg.Cloud.CredentialsFile != "" {
+			opts = append(opts, option.WithCredentialsFile(cfg.Cloud.CredentialsFile))
+		}
+		if cfg.Cloud.Endpoint != "" {
+			opts = append(opts, option.WithEndpoint(cfg.Cloud.Endpoint))
+		}
+		client, err := gcs.NewClient(context.Background(), opts...)
+		if err != nil {
+			return nil, err
+		}
+		return NewGoogleCloudStorage(client, cfg), nil
 	case AzureBlobStore:
-		// TODO: Add MS Azure Blob implementation
-		return nil, ErrInvalidBlobStorage
+		client, err := newAzureContainerClient(cfg.Cloud)
+		if err != nil {
+			return nil, err
+		}
+		return NewAzureBlobStorage(client, cfg), nil
+	case LocalFSStore:
+		return NewLocalFS(cfg), nil
 	default:
 		return nil, ErrInvalidBlobStorage
 	}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/neutrinocorp/cloudsync"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// GoogleCloudStorage Google Cloud (GCP) Storage Service concrete implementation of cloudsync.BlobStorage.
+type GoogleCloudStorage struct {
+	client *gcs.Client
+	bucket *gcs.BucketHandle
+
+	bucketCheck    sync.Once
+	bucketNotFound bool
+}
+
+// compile-time interface impl. validation.
+var (
+	_ cloudsync.BlobStorage    = &GoogleCloudStorage{}
+	_ cloudsync.BlobDownloader = &GoogleCloudStorage{}
+	_ cloudsync.BlobLister     = &GoogleCloudStorage{}
+	_ cloudsync.BlobStater     = &GoogleCloudStorage{}
+	_ cloudsync.BlobDeleter    = &GoogleCloudStorage{}
+	_ cloudsync.BlobCopier     = &GoogleCloudStorage{}
+)
+
+// gcsChunkSize size of each chunk sent by a resumable upload session.
+const gcsChunkSize = 16 * 1024 * 1024 // 16 MiB
+
+// NewGoogleCloudStorage allocates a new GoogleCloudStorage instance ready to perform underlying GCP Storage API
+// actions using cloudsync.BlobStorage API.
+func NewGoogleCloudStorage(c *gcs.Client, cfg cloudsync.Config) *GoogleCloudStorage {
+	return &GoogleCloudStorage{client: c, bucket: c.Bucket(cfg.Cloud.Bucket)}
+}
+
+func (g *GoogleCloudStorage) Upload(ctx context.Context, obj cloudsync.Object) error {
+	// compute object's checksum beforehand so remote storage rejects the object if it got corrupted in transit
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(crc, obj.Data); err != nil {
+		return err
+	}
+	if _, err := obj.Data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// cancelling the writer context aborts the upload, whereas closing the writer would commit a truncated object. The
+	// writer MUST NOT be closed after cancelling it, as it could still commit the object before noticing.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := g.bucket.Object(obj.Key).NewWriter(ctx)
+	w.ChunkSize = gcsChunkSize // enables resumable uploads
+	w.CRC32C = crc.Sum32()
+	w.SendCRC32C = true
+	w.Metadata = obj.Metadata
+	w.ContentType = obj.ContentType
+	w.CacheControl = obj.CacheControl
+	if _, err := io.Copy(w, obj.Data); err != nil {
+		return newGoogleCloudError(err) // aborted by the deferred cancel
+	}
+	return newGoogleCloudError(w.Close())
+}
+
+func (g *GoogleCloudStorage) CheckMod(ctx context.Context, key string, modTime time.Time, size int64) (bool, error) {
+	attrs, err := g.bucket.Object(key).Attrs(ctx)
+	switch {
+	case err == nil:
+		return attrs.Size != size || attrs.Updated.Before(modTime), nil
+	case errors.Is(err, gcs.ErrObjectNotExist) && g.bucketExists(ctx):
+		return true, nil // if not found, then allow object writing
+	case errors.Is(err, gcs.ErrObjectNotExist):
+		return false, cloudsync.ErrFatalStorage
+	default:
+		return false, newGoogleCloudError(err)
+	}
+}
+
+// bucketExists verifies (only once) the existence of the underlying bucket as GCP Storage API returns the same
+// error for missing objects and missing buckets.
+//
+// Bucket is assumed to exist if the verification fails for any other reason (e.g. caller is only allowed to
+// read objects).
+func (g *GoogleCloudStorage) bucketExists(ctx context.Context) bool {
+	g.bucketCheck.Do(func() {
+		_, err := g.bucket.Attrs(ctx)
+		g.bucketNotFound = errors.Is(err, gcs.ErrBucketNotExist)
+	})
+	return !g.bucketNotFound
+}
+
+// isGoogleCloudFatalErr verifies if the given error returned by GCP Storage API is non-recoverable
+// (e.g. insufficient permissions, bucket does not exist).
+func isGoogleCloudFatalErr(err error) bool {
+	if errors.Is(err, gcs.ErrBucketNotExist) {
+		return true
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *GoogleCloudStorage) Download(ctx context.Context, key string, w io.WriterAt) error {
+	r, err := g.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		return newGoogleCloudError(err)
+	}
+	defer r.Close()
+	return copyToWriterAt(ctx, w, r)
+}
+
+func (g *GoogleCloudStorage) List(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	return googleCloudIterator{it: g.bucket.Objects(ctx, &gcs.Query{Prefix: prefix})}
+}
+
+func (g *GoogleCloudStorage) Stat(ctx context.Context, key string) (cloudsync.ObjectInfo, error) {
+	attrs, err := g.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		return cloudsync.ObjectInfo{}, newGoogleCloudError(err)
+	}
+	return newGoogleCloudObjectInfo(attrs), nil
+}
+
+func (g *GoogleCloudStorage) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		err := g.bucket.Object(key).Delete(ctx)
+		if err != nil && !errors.Is(err, gcs.ErrObjectNotExist) {
+			return newGoogleCloudError(err)
+		}
+	}
+	return nil
+}
+
+func (g *GoogleCloudStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	_, err := g.bucket.Object(dstKey).CopierFrom(g.bucket.Object(srcKey)).Run(ctx)
+	if err != nil {
+		return newGoogleCloudError(err)
+	}
+	return nil
+}
+
+// newGoogleCloudError converts errors returned by GCP Storage API into cloudsync errors. Other API errors expose
+// their HTTP status code (see cloudsync.IsRetryableError).
+func newGoogleCloudError(err error) error {
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gcs.ErrObjectNotExist):
+		return cloudsync.ErrObjectNotFound
+	case isGoogleCloudFatalErr(err):
+		return cloudsync.ErrFatalStorage
+	case errors.As(err, &apiErr):
+		return statusCodeError{code: apiErr.Code, err: err}
+	default:
+		return err
+	}
+}
+
+// newGoogleCloudObjectInfo converts GCP Storage object attributes into a cloudsync.ObjectInfo.
+func newGoogleCloudObjectInfo(attrs *gcs.ObjectAttrs) cloudsync.ObjectInfo {
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, attrs.CRC32C)
+	return cloudsync.ObjectInfo{
+		Key:               attrs.Name,
+		Size:              attrs.Size,
+		ModTime:           attrs.Updated,
+		Checksum:          base64.StdEncoding.EncodeToString(checksum),
+		ChecksumAlgorithm: cloudsync.ChecksumCRC32C,
+		Metadata:          attrs.Metadata,
+	}
+}
+
+// googleCloudIterator cloudsync.ObjectIterator implementation wrapping GCP Storage object iterator.
+type googleCloudIterator struct {
+	it *gcs.ObjectIterator
+}
+
+var _ cloudsync.ObjectIterator = googleCloudIterator{}
+
+func (g googleCloudIterator) Next() (cloudsync.ObjectInfo, error) {
+	attrs, err := g.it.Next()
+	if errors.Is(err, iterator.Done) {
+		return cloudsync.ObjectInfo{}, cloudsync.ErrIteratorDone
+	} else if err != nil {
+		return cloudsync.ObjectInfo{}, newGoogleCloudError(err)
+	}
+	return newGoogleCloudObjectInfo(attrs), nil
+}
@@ -0,0 +1,186 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeGoogleCloudStorage(t *testing.T, bucket string) (*fakestorage.Server, *storage.GoogleCloudStorage) {
+	server := fakestorage.NewServer(nil)
+	t.Cleanup(server.Stop)
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: "ncorp-dev-cloudsync"})
+	return server, storage.NewGoogleCloudStorage(server.Client(), cloudsync.Config{
+		Cloud: cloudsync.CloudConfig{Bucket: bucket},
+	})
+}
+
+func TestGoogleCloudStorage_Upload(t *testing.T) {
+	server, store := newFakeGoogleCloudStorage(t, "ncorp-dev-cloudsync")
+	err := store.Upload(context.TODO(), cloudsync.Object{
+		Key:         "123/foo/bar.txt",
+		Data:        strings.NewReader("foo"),
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+
+	obj, err := server.GetObject("ncorp-dev-cloudsync", "123/foo/bar.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(obj.Content))
+	assert.Equal(t, "text/plain", obj.ContentType)
+
+	r, err := server.Client().Bucket("ncorp-dev-cloudsync").Object("123/foo/bar.txt").NewReader(context.TODO())
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(data))
+}
+
+// rereadFailingData cloudsync.ReadSeekerAt failing after the first byte once it was read entirely and rewound (e.g.
+// a file truncated between checksum calculation and upload).
+type rereadFailingData struct {
+	r       *strings.Reader
+	rewound bool
+}
+
+func (d *rereadFailingData) Seek(offset int64, whence int) (int64, error) {
+	d.rewound = true
+	return d.r.Seek(offset, whence)
+}
+
+func (d *rereadFailingData) ReadAt(p []byte, off int64) (int, error) {
+	return d.r.ReadAt(p, off)
+}
+
+func (d *rereadFailingData) Read(p []byte) (int, error) {
+	if d.rewound && d.r.Size()-int64(d.r.Len()) > 0 {
+		return 0, errors.New("foo error")
+	} else if d.rewound && len(p) > 1 {
+		p = p[:1]
+	}
+	return d.r.Read(p)
+}
+
+func TestGoogleCloudStorage_UploadAborted(t *testing.T) {
+	server, store := newFakeGoogleCloudStorage(t, "ncorp-dev-cloudsync")
+	err := store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "123/foo/bar.txt",
+		Data: &rereadFailingData{r: strings.NewReader("foo")},
+	})
+	assert.EqualError(t, err, "foo error")
+
+	// truncated objects are never committed
+	_, err = server.GetObject("ncorp-dev-cloudsync", "123/foo/bar.txt")
+	assert.Error(t, err)
+}
+
+func TestGoogleCloudStorage_CheckMod(t *testing.T) {
+	_, store := newFakeGoogleCloudStorage(t, "ncorp-dev-cloudsync")
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "foo.txt",
+		Data: strings.NewReader("foo"),
+	}))
+	_, missingBucketStore := newFakeGoogleCloudStorage(t, "baz")
+
+	tests := []struct {
+		name    string
+		store   cloudsync.BlobStorage
+		key     string
+		modTime time.Time
+		size    int64
+		exp     bool
+		err     error
+	}{
+		{
+			name:  "Missing bucket",
+			store: missingBucketStore,
+			key:   "foo.txt",
+			exp:   false,
+			err:   cloudsync.ErrFatalStorage,
+		},
+		{
+			name:  "Not found",
+			store: store,
+			key:   "bar.txt",
+			exp:   true,
+		},
+		{
+			name:    "Not modified",
+			store:   store,
+			key:     "foo.txt",
+			modTime: time.Now().Add(-time.Hour),
+			size:    3,
+			exp:     false,
+		},
+		{
+			name:    "Size changed",
+			store:   store,
+			key:     "foo.txt",
+			modTime: time.Now().Add(-time.Hour),
+			size:    2,
+			exp:     true,
+		},
+		{
+			name:    "Newer modification time",
+			store:   store,
+			key:     "foo.txt",
+			modTime: time.Now().Add(time.Hour),
+			size:    3,
+			exp:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.store.CheckMod(context.TODO(), tt.key, tt.modTime, tt.size)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.exp, out)
+		})
+	}
+}
+
+func TestGoogleCloudStorage_Capabilities(t *testing.T) {
+	_, store := newFakeGoogleCloudStorage(t, "ncorp-dev-cloudsync")
+	for _, key := range []string{"123/foo.txt", "123/bar/baz.txt", "456/foo.txt"} {
+		require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+			Key:      key,
+			Data:     strings.NewReader(key),
+			Metadata: map[string]string{cloudsync.MetadataKeyChecksum: "foo"},
+		}))
+	}
+
+	assert.ElementsMatch(t, []string{"123/foo.txt", "123/bar/baz.txt"}, listKeys(t, store.List(context.TODO(), "123/")))
+
+	info, err := store.Stat(context.TODO(), "123/bar/baz.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "123/bar/baz.txt", info.Key)
+	assert.Equal(t, int64(15), info.Size)
+	assert.Equal(t, cloudsync.ChecksumCRC32C, info.ChecksumAlgorithm)
+	assert.NotEmpty(t, info.Checksum)
+	assert.Equal(t, "foo", info.Metadata[cloudsync.MetadataKeyChecksum])
+	_, err = store.Stat(context.TODO(), "123/baz.txt")
+	assert.ErrorIs(t, err, cloudsync.ErrObjectNotFound)
+
+	buf := &fileBuffer{}
+	require.NoError(t, store.Download(context.TODO(), "123/bar/baz.txt", buf))
+	assert.Equal(t, "123/bar/baz.txt", string(buf.data))
+	assert.ErrorIs(t, store.Download(context.TODO(), "123/baz.txt", buf), cloudsync.ErrObjectNotFound)
+
+	require.NoError(t, store.Copy(context.TODO(), "123/bar/baz.txt", "123/.trash/bar/baz.txt"))
+	require.NoError(t, store.Download(context.TODO(), "123/.trash/bar/baz.txt", buf))
+	assert.Equal(t, "123/bar/baz.txt", string(buf.data))
+
+	require.NoError(t, store.Delete(context.TODO(), "123/foo.txt", "123/bar/baz.txt", "123/baz.txt",
+		"123/.trash/bar/baz.txt"))
+	assert.Empty(t, listKeys(t, store.List(context.TODO(), "123/")))
+}
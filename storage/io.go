@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// readerWithContext stops reading from the underlying io.Reader once the given context was cancelled.
+type readerWithContext struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r readerWithContext) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// offsetWriter io.Writer implementation writing sequentially into an io.WriterAt, starting from a given offset.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return n, err
+}
+
+// copyToWriterAt copies all data from r into w, starting from w's first byte.
+func copyToWriterAt(ctx context.Context, w io.WriterAt, r io.Reader) error {
+	_, err := io.Copy(&offsetWriter{w: w}, readerWithContext{ctx: ctx, r: r})
+	return err
+}
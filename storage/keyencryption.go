@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// keyEncryptionInfo context used to derive the key encrypting object keys, so it differs from the KEK.
+	keyEncryptionInfo = "cloudsync key encryption"
+	// sivKeySize AES-SIV key size (two AES-256 keys: one for S2V and one for CTR).
+	sivKeySize = 64
+	sivTagSize = aes.BlockSize
+	// maxKeySegmentSize maximum size of an encrypted key segment, as most file systems and blob storages (when
+	// mounted) limit names to 255 bytes.
+	maxKeySegmentSize = 255
+	// MaxEncryptedKeySegmentSize maximum size in bytes of a plaintext key segment (e.g. a file name) which may be
+	// encrypted, as encrypted segments (synthetic IV and ciphertext, base32-encoded) must not exceed 255 bytes.
+	MaxEncryptedKeySegmentSize = maxKeySegmentSize*5/8 - sivTagSize
+)
+
+// ErrKeySegmentTooLong a key segment (e.g. a file name) exceeds MaxEncryptedKeySegmentSize, so it cannot be
+// encrypted.
+var ErrKeySegmentTooLong = errors.New("cloudsync: Key segment is too long to be encrypted")
+
+// keySegmentEncoding encoding of encrypted key segments. Lowercase base32 is used as it is safe for every blob storage
+// and case-insensitive file systems.
+var keySegmentEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// keyCipher encrypts object keys deterministically (i.e. a key is always encrypted into the same value), segment by
+// segment using AES-SIV (RFC 5297), so directory structure is preserved and prefix listing keeps working.
+//
+// Segments are authenticated along their plaintext parent path, so identical names within different directories get
+// different values.
+type keyCipher struct {
+	mac cipher.Block // S2V
+	ctr cipher.Block
+}
+
+// newKeyCipher allocates a keyCipher whose key is derived from a key file KEK (HKDF) or a passphrase (scrypt). A
+// fixed salt is used for passphrases as keys must be encrypted the same way by every host.
+func newKeyCipher(kdf byte, kek, passphrase []byte) (*keyCipher, error) {
+	key := make([]byte, sivKeySize)
+	var err error
+	if kdf == kdfScrypt {
+		key, err = scrypt.Key(passphrase, []byte(keyEncryptionInfo), scryptN, scryptR, scryptP, sivKeySize)
+	} else {
+		_, err = io.ReadFull(hkdf.New(sha256.New, kek, nil, []byte(keyEncryptionInfo)), key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newSIV(key)
+}
+
+// newSIV allocates a keyCipher using an AES-SIV key (S2V key followed by CTR key).
+func newSIV(key []byte) (*keyCipher, error) {
+	mac, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, err
+	}
+	return &keyCipher{mac: mac, ctr: ctr}, nil
+}
+
+// encryptKey encrypts every segment of an object key. Empty segments (e.g. a trailing slash) are kept as they are.
+// Returns ErrKeySegmentTooLong if any segment exceeds MaxEncryptedKeySegmentSize.
+func (c *keyCipher) encryptKey(key string) (string, error) {
+	plain := strings.Split(key, "/")
+	segments := make([]string, len(plain))
+	for i, segment := range plain {
+		if segment == "" {
+			continue
+		} else if len(segment) > MaxEncryptedKeySegmentSize {
+			return "", fmt.Errorf("%w: %q holds %d bytes (limit: %d)", ErrKeySegmentTooLong, segment, len(segment),
+				MaxEncryptedKeySegmentSize)
+		}
+		sealed := c.seal([]byte(segment), []byte(strings.Join(plain[:i], "/")))
+		segments[i] = strings.ToLower(keySegmentEncoding.EncodeToString(sealed))
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// decryptKey decrypts every segment of an object key encrypted by keyCipher.encryptKey. Returns ErrDecryption if
+// any segment was not encrypted using the same key.
+func (c *keyCipher) decryptKey(key string) (string, error) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		sealed, err := keySegmentEncoding.DecodeString(strings.ToUpper(segment))
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid key %s", ErrDecryption, key)
+		}
+		plain, err := c.open(sealed, []byte(strings.Join(segments[:i], "/")))
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid key %s", ErrDecryption, key)
+		}
+		segments[i] = string(plain)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// encryptPrefix encrypts the complete segments of a key prefix (i.e. its deepest directory), as partial segments
+// cannot be encrypted. Keys listed using the encrypted prefix must be filtered using the plaintext one.
+func (c *keyCipher) encryptPrefix(prefix string) (string, error) {
+	idx := strings.LastIndexByte(prefix, '/')
+	if idx < 0 {
+		return "", nil
+	}
+	key, err := c.encryptKey(prefix[:idx])
+	if err != nil {
+		return "", err
+	}
+	return key + "/", nil
+}
+
+// seal encrypts plaintext using AES-SIV and the given associated data, returning the synthetic IV followed by the
+// ciphertext.
+func (c *keyCipher) seal(plaintext []byte, ad ...[]byte) []byte {
+	iv := c.s2v(append(ad, plaintext)...)
+	out := make([]byte, sivTagSize+len(plaintext))
+	copy(out, iv)
+	c.xorCTR(out[sivTagSize:], plaintext, iv)
+	return out
+}
+
+// open decrypts a value sealed by keyCipher.seal, verifying its synthetic IV.
+func (c *keyCipher) open(sealed []byte, ad ...[]byte) ([]byte, error) {
+	if len(sealed) < sivTagSize {
+		return nil, errors.New("cloudsync: sealed value is too short")
+	}
+	iv := sealed[:sivTagSize]
+	plaintext := make([]byte, len(sealed)-sivTagSize)
+	c.xorCTR(plaintext, sealed[sivTagSize:], iv)
+	if subtle.ConstantTimeCompare(iv, c.s2v(append(ad, plaintext)...)) != 1 {
+		return nil, errors.New("cloudsync: message authentication failed")
+	}
+	return plaintext, nil
+}
+
+// xorCTR applies AES-CTR to src using the synthetic IV as counter (with bits 31 and 63 cleared, see RFC 5297).
+func (c *keyCipher) xorCTR(dst, src, iv []byte) {
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, iv)
+	counter[8] &= 0x7f
+	counter[12] &= 0x7f
+	cipher.NewCTR(c.ctr, counter).XORKeyStream(dst, src)
+}
+
+// s2v derives a synthetic IV from a vector of strings (RFC 5297, section 2.4).
+func (c *keyCipher) s2v(strs ...[]byte) []byte {
+	d := c.cmac(make([]byte, aes.BlockSize))
+	for _, s := range strs[:len(strs)-1] {
+		d = dbl(d)
+		xorBytes(d, c.cmac(s))
+	}
+	last := strs[len(strs)-1]
+	var t []byte
+	if len(last) >= aes.BlockSize {
+		t = append([]byte{}, last...)
+		xorBytes(t[len(t)-aes.BlockSize:], d)
+	} else {
+		t = dbl(d)
+		xorBytes(t, pad(last))
+	}
+	return c.cmac(t)
+}
+
+// cmac calculates the AES-CMAC (RFC 4493) of a message using the S2V key.
+func (c *keyCipher) cmac(msg []byte) []byte {
+	k1 := make([]byte, aes.BlockSize)
+	c.mac.Encrypt(k1, k1)
+	k1 = dbl(k1)
+	k2 := dbl(k1)
+
+	blocks := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	var last []byte
+	if blocks > 0 && len(msg)%aes.BlockSize == 0 {
+		last = append([]byte{}, msg[(blocks-1)*aes.BlockSize:]...)
+		xorBytes(last, k1)
+	} else {
+		if blocks == 0 {
+			blocks = 1
+		}
+		last = pad(msg[(blocks-1)*aes.BlockSize:])
+		xorBytes(last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < blocks-1; i++ {
+		xorBytes(x, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		c.mac.Encrypt(x, x)
+	}
+	xorBytes(x, last)
+	c.mac.Encrypt(x, x)
+	return x
+}
+
+// dbl multiplies a block by x in GF(2^128), retrieving a new block.
+func dbl(block []byte) []byte {
+	out := make([]byte, aes.BlockSize)
+	carry := byte(0)
+	for i := aes.BlockSize - 1; i >= 0; i-- {
+		out[i] = block[i]<<1 | carry
+		carry = block[i] >> 7
+	}
+	if carry != 0 {
+		out[aes.BlockSize-1] ^= 0x87
+	}
+	return out
+}
+
+// pad appends a single one bit and zeros to a partial block (i.e. 10* padding).
+func pad(partial []byte) []byte {
+	out := make([]byte, aes.BlockSize)
+	copy(out, partial)
+	out[len(partial)] = 0x80
+	return out
+}
+
+// xorBytes sets dst to dst XOR src (up to the length of dst).
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
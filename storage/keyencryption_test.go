@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyCipher_SIV(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		ad        []string
+		plaintext string
+		exp       string
+	}{
+		{
+			name:      "RFC 5297 A.1 deterministic",
+			key:       "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+			ad:        []string{"101112131415161718191a1b1c1d1e1f2021222324252627"},
+			plaintext: "112233445566778899aabbccddee",
+			exp:       "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c",
+		},
+		{
+			name: "RFC 5297 A.2 nonce-based",
+			key:  "7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f",
+			ad: []string{
+				"00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100",
+				"102030405060708090a0",
+				"09f911029d74e35bd84156c5635688c0", // nonce
+			},
+			plaintext: "7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553",
+			exp: "7bdb6e3b432667eb06f4d14bff2fbd0fcb900f2fddbe404326601965c889bf17dba77ceb094fa663b7a3f748ba8af829" +
+				"ea64ad544a272e9c485b62a3fd5c0d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, _ := hex.DecodeString(tt.key)
+			plaintext, _ := hex.DecodeString(tt.plaintext)
+			ad := make([][]byte, 0, len(tt.ad))
+			for _, s := range tt.ad {
+				b, _ := hex.DecodeString(s)
+				ad = append(ad, b)
+			}
+			c, err := newSIV(key)
+			require.NoError(t, err)
+
+			sealed := c.seal(plaintext, ad...)
+			assert.Equal(t, tt.exp, hex.EncodeToString(sealed))
+			out, err := c.open(sealed, ad...)
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, out)
+		})
+	}
+}
+
+func TestKeyCipher_Tampered(t *testing.T) {
+	c, err := newSIV(make([]byte, sivKeySize))
+	require.NoError(t, err)
+	ad := []byte("123/clients")
+	sealed := c.seal([]byte("contract.pdf"), ad)
+
+	tests := []struct {
+		name   string
+		sealed func() []byte
+		ad     []byte
+	}{
+		{name: "Ciphertext", sealed: func() []byte { return flipBit(sealed, len(sealed)-1) }, ad: ad},
+		{name: "Synthetic IV", sealed: func() []byte { return flipBit(sealed, 0) }, ad: ad},
+		{name: "Associated data", sealed: func() []byte { return sealed }, ad: []byte("123/clientz")},
+		{name: "Missing associated data", sealed: func() []byte { return sealed }},
+		{name: "Truncated", sealed: func() []byte { return sealed[:sivTagSize-1] }, ad: ad},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errOpen error
+			if tt.ad == nil {
+				_, errOpen = c.open(tt.sealed())
+			} else {
+				_, errOpen = c.open(tt.sealed(), tt.ad)
+			}
+			assert.Error(t, errOpen)
+		})
+	}
+}
+
+// flipBit copies b, flipping the lowest bit of its i-th byte.
+func flipBit(b []byte, i int) []byte {
+	out := append([]byte{}, b...)
+	out[i] ^= 1
+	return out
+}
+
+// mustEncryptKey encrypts a key, failing the test on error.
+func mustEncryptKey(t *testing.T, c *keyCipher, key string) string {
+	out, err := c.encryptKey(key)
+	require.NoError(t, err)
+	return out
+}
+
+func TestKeyCipher_Keys(t *testing.T) {
+	c, err := newKeyCipher(kdfKeyFile, make([]byte, encryptionKeySize), nil)
+	require.NoError(t, err)
+
+	key := mustEncryptKey(t, c, "123/clients/acme/contract.pdf")
+	assert.Equal(t, mustEncryptKey(t, c, "123/clients/acme/contract.pdf"), key) // deterministic
+	assert.NotContains(t, key, "acme")
+	prefix, err := c.encryptPrefix("123/clients/ac")
+	require.NoError(t, err)
+	assert.Equal(t, mustEncryptKey(t, c, "123/clients")+"/", prefix)
+	prefix, err = c.encryptPrefix("12")
+	require.NoError(t, err)
+	assert.Equal(t, "", prefix)
+	// same names within different directories differ
+	assert.NotEqual(t, mustEncryptKey(t, c, "a/contract.pdf")[len(mustEncryptKey(t, c, "a"))+1:],
+		mustEncryptKey(t, c, "b/contract.pdf")[len(mustEncryptKey(t, c, "b"))+1:])
+
+	out, err := c.decryptKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, "123/clients/acme/contract.pdf", out)
+	_, err = c.decryptKey("123/clients")
+	assert.ErrorIs(t, err, ErrDecryption)
+}
+
+func TestKeyCipher_SegmentSize(t *testing.T) {
+	c, err := newKeyCipher(kdfKeyFile, make([]byte, encryptionKeySize), nil)
+	require.NoError(t, err)
+
+	longest := strings.Repeat("a", MaxEncryptedKeySegmentSize)
+	key := mustEncryptKey(t, c, "123/"+longest)
+	assert.Len(t, key[strings.IndexByte(key, '/')+1:], maxKeySegmentSize)
+
+	_, err = c.encryptKey("123/" + longest + "a")
+	assert.ErrorIs(t, err, ErrKeySegmentTooLong)
+	_, err = c.encryptPrefix(longest + "a/foo")
+	assert.ErrorIs(t, err, ErrKeySegmentTooLong)
+}
@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+)
+
+// tempFilePrefix prefix used by LocalFS to name partially written objects.
+const tempFilePrefix = ".cloudsync-"
+
+// metadataFilePrefix prefix used by LocalFS to name files holding object metadata, written next to objects. As it
+// starts with tempFilePrefix, metadata files are never listed.
+const metadataFilePrefix = tempFilePrefix + "meta-"
+
+// metadataKeySHA256 reserved metadata file entry holding the SHA-256 checksum of an object, calculated on upload. The
+// leading dot keeps it apart from object metadata keys, which cannot start with one on cloud storages.
+const metadataKeySHA256 = ".sha256"
+
+// ErrKeyEscapesRoot the object key resolves to a path outside the LocalFS target directory (e.g. "../file").
+var ErrKeyEscapesRoot = errors.New("cloudsync: Object key escapes local storage root")
+
+// LocalFS local file system concrete implementation of cloudsync.BlobStorage.
+//
+// Objects are written under a target directory (e.g. a NAS mount or an external drive) using their keys as
+// relative paths. Object metadata and checksum are written next to each object as a hidden JSON file.
+type LocalFS struct {
+	root string
+}
+
+// compile-time interface impl. validation.
+var (
+	_ cloudsync.BlobStorage    = &LocalFS{}
+	_ cloudsync.BlobDownloader = &LocalFS{}
+	_ cloudsync.BlobLister     = &LocalFS{}
+	_ cloudsync.BlobStater     = &LocalFS{}
+	_ cloudsync.BlobDeleter    = &LocalFS{}
+	_ cloudsync.BlobCopier     = &LocalFS{}
+)
+
+// NewLocalFS allocates a new LocalFS instance which will store objects under cloudsync.CloudConfig LocalPath
+// directory.
+func NewLocalFS(cfg cloudsync.Config) *LocalFS {
+	return &LocalFS{root: cfg.Cloud.LocalPath}
+}
+
+// path converts an object key into a path from the host's file system. Returns ErrKeyEscapesRoot if the key
+// resolves to a path outside the target directory.
+func (l *LocalFS) path(key string) (string, error) {
+	filePath := filepath.Join(l.root, filepath.FromSlash(key))
+	rel, err := filepath.Rel(l.root, filePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrKeyEscapesRoot
+	}
+	return filePath, nil
+}
+
+// metadataPath converts an object key into the path of its metadata file.
+func (l *LocalFS) metadataPath(key string) (string, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(filePath), metadataFilePrefix+filepath.Base(filePath)+".json"), nil
+}
+
+// writeMetadata stores the metadata and checksum of an object, removing any previous metadata file if both are empty.
+func (l *LocalFS) writeMetadata(key string, metadata map[string]string, checksum string) error {
+	metadataPath, err := l.metadataPath(key)
+	if err != nil {
+		return err
+	}
+	if len(metadata) == 0 && checksum == "" {
+		if err := os.Remove(metadataPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	entries := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		entries[k] = v
+	}
+	if checksum != "" {
+		entries[metadataKeySHA256] = checksum
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metadataPath, data, 0644)
+}
+
+// readMetadata reads the metadata and checksum of an object. Returns nil metadata if the object has none and an
+// empty checksum if it was not calculated on upload (e.g. objects written by older versions).
+func (l *LocalFS) readMetadata(key string) (map[string]string, string, error) {
+	metadataPath, err := l.metadataPath(key)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(metadataPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	}
+	metadata := make(map[string]string)
+	if err = json.Unmarshal(data, &metadata); err != nil {
+		return nil, "", err
+	}
+	checksum := metadata[metadataKeySHA256]
+	delete(metadata, metadataKeySHA256)
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	return metadata, checksum, nil
+}
+
+func (l *LocalFS) Upload(ctx context.Context, obj cloudsync.Object) error {
+	filePath, err := l.path(obj.Key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+
+	// write into a temporary file first so partially written objects are never exposed using their actual key
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, hash), readerWithContext{ctx: ctx, r: obj.Data}); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	checksum := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+	if err = tmp.Close(); err != nil {
+		return err
+	} else if err = l.writeMetadata(obj.Key, obj.Metadata, checksum); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (l *LocalFS) CheckMod(_ context.Context, key string, modTime time.Time, size int64) (bool, error) {
+	if _, err := os.Stat(l.root); err != nil {
+		return false, cloudsync.ErrFatalStorage // target directory is not mounted or does not exist
+	}
+
+	filePath, err := l.path(key)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(filePath)
+	switch {
+	case err == nil:
+		return info.Size() != size || info.ModTime().Before(modTime), nil
+	case errors.Is(err, fs.ErrNotExist):
+		return true, nil // if not found, then allow object writing
+	case errors.Is(err, fs.ErrPermission):
+		return false, cloudsync.ErrFatalStorage
+	default:
+		return false, err
+	}
+}
+
+func (l *LocalFS) Download(ctx context.Context, key string, w io.WriterAt) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return newLocalFSError(err)
+	}
+	defer f.Close()
+	return copyToWriterAt(ctx, w, f)
+}
+
+func (l *LocalFS) List(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	return &localFSIterator{ctx: ctx, fs: l, prefix: prefix}
+}
+
+// Stat retrieves an object properties. Its SHA-256 checksum is read from its metadata file, being calculated only
+// if missing.
+func (l *LocalFS) Stat(ctx context.Context, key string) (cloudsync.ObjectInfo, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return cloudsync.ObjectInfo{}, err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return cloudsync.ObjectInfo{}, newLocalFSError(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return cloudsync.ObjectInfo{}, newLocalFSError(err)
+	} else if info.IsDir() {
+		return cloudsync.ObjectInfo{}, cloudsync.ErrObjectNotFound
+	}
+
+	metadata, checksum, err := l.readMetadata(key)
+	if err != nil {
+		return cloudsync.ObjectInfo{}, newLocalFSError(err)
+	}
+	if checksum == "" {
+		hash := sha256.New()
+		if _, err = io.Copy(hash, readerWithContext{ctx: ctx, r: f}); err != nil {
+			return cloudsync.ObjectInfo{}, err
+		}
+		checksum = base64.StdEncoding.EncodeToString(hash.Sum(nil))
+	}
+	return cloudsync.ObjectInfo{
+		Key:               key,
+		Size:              info.Size(),
+		ModTime:           info.ModTime(),
+		Checksum:          checksum,
+		ChecksumAlgorithm: cloudsync.ChecksumSHA256,
+		Metadata:          metadata,
+	}, nil
+}
+
+func (l *LocalFS) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		filePath, err := l.path(key)
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return newLocalFSError(err)
+		} else if err = l.writeMetadata(key, nil, ""); err != nil {
+			return newLocalFSError(err)
+		}
+	}
+	return nil
+}
+
+func (l *LocalFS) Copy(ctx context.Context, srcKey, dstKey string) error {
+	srcPath, err := l.path(srcKey)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return newLocalFSError(err)
+	}
+	defer f.Close()
+	metadata, _, err := l.readMetadata(srcKey)
+	if err != nil {
+		return newLocalFSError(err)
+	}
+	return l.Upload(ctx, cloudsync.Object{
+		Key:      dstKey,
+		Data:     f,
+		Metadata: metadata,
+	})
+}
+
+// newLocalFSError converts errors returned by host's file system into cloudsync errors.
+func newLocalFSError(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return cloudsync.ErrObjectNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return cloudsync.ErrFatalStorage
+	default:
+		return err
+	}
+}
+
+// localFSIterator cloudsync.ObjectIterator implementation walking through LocalFS objects. Objects are read
+// from host's file system at the first Next call.
+type localFSIterator struct {
+	ctx    context.Context
+	fs     *LocalFS
+	prefix string
+	objs   *cloudsync.SliceObjectIterator
+}
+
+var _ cloudsync.ObjectIterator = &localFSIterator{}
+
+func (i *localFSIterator) Next() (cloudsync.ObjectInfo, error) {
+	if i.objs == nil {
+		objs, err := i.walk()
+		if err != nil {
+			return cloudsync.ObjectInfo{}, err
+		}
+		i.objs = cloudsync.NewSliceObjectIterator(objs)
+	}
+	return i.objs.Next()
+}
+
+// walk reads every object under the deepest directory contained by the iterator's key prefix.
+func (i *localFSIterator) walk() ([]cloudsync.ObjectInfo, error) {
+	dir := i.prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	root, err := i.fs.path(dir)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]cloudsync.ObjectInfo, 0)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if ctxErr := i.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		} else if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(i.fs.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, i.prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		metadata, _, err := i.fs.readMetadata(key)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, cloudsync.ObjectInfo{
+			Key:      key,
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			Metadata: metadata,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, newLocalFSError(err)
+	}
+	return objs, nil
+}
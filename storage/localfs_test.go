@@ -0,0 +1,344 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalFS_Upload(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: root}})
+
+	err := store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "123/foo/bar.txt",
+		Data: strings.NewReader("foo"),
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(root, "123", "foo", "bar.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(data))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	err = store.Upload(ctx, cloudsync.Object{
+		Key:  "123/foo/baz.txt",
+		Data: strings.NewReader("baz"),
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = os.Stat(filepath.Join(root, "123", "foo", "baz.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLocalFS_KeyEscapesRoot(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	require.NoError(t, os.Mkdir(root, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0644))
+	store := storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: root}})
+	ctx := context.TODO()
+
+	for _, key := range []string{"../foo.txt", "bar/../../foo.txt", ".."} {
+		err := store.Upload(ctx, cloudsync.Object{Key: key, Data: strings.NewReader("foo")})
+		assert.ErrorIs(t, err, storage.ErrKeyEscapesRoot, key)
+	}
+	_, err := os.Stat(filepath.Join(parent, "foo.txt"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = store.CheckMod(ctx, "../secret.txt", time.Now(), 6)
+	assert.ErrorIs(t, err, storage.ErrKeyEscapesRoot)
+	assert.ErrorIs(t, store.Download(ctx, "../secret.txt", &fileBuffer{}), storage.ErrKeyEscapesRoot)
+	_, err = store.Stat(ctx, "../secret.txt")
+	assert.ErrorIs(t, err, storage.ErrKeyEscapesRoot)
+	assert.ErrorIs(t, store.Copy(ctx, "../secret.txt", "secret.txt"), storage.ErrKeyEscapesRoot)
+	assert.ErrorIs(t, store.Delete(ctx, "../secret.txt"), storage.ErrKeyEscapesRoot)
+	_, err = store.List(ctx, "../").Next()
+	assert.ErrorIs(t, err, storage.ErrKeyEscapesRoot)
+	_, err = os.Stat(filepath.Join(parent, "secret.txt"))
+	assert.NoError(t, err)
+
+	// keys with dot segments resolving under the target directory are kept
+	require.NoError(t, store.Upload(ctx, cloudsync.Object{Key: "bar/../foo.txt", Data: strings.NewReader("foo")}))
+	_, err = os.Stat(filepath.Join(root, "foo.txt"))
+	assert.NoError(t, err)
+}
+
+func TestLocalFS_CheckMod(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: root}})
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "foo.txt",
+		Data: strings.NewReader("foo"),
+	}))
+
+	tests := []struct {
+		name    string
+		store   cloudsync.BlobStorage
+		key     string
+		modTime time.Time
+		size    int64
+		exp     bool
+		err     error
+	}{
+		{
+			name:  "Missing target directory",
+			store: storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: filepath.Join(root, "baz")}}),
+			key:   "foo.txt",
+			exp:   false,
+			err:   cloudsync.ErrFatalStorage,
+		},
+		{
+			name:  "Not found",
+			store: store,
+			key:   "bar.txt",
+			exp:   true,
+		},
+		{
+			name:    "Not modified",
+			store:   store,
+			key:     "foo.txt",
+			modTime: time.Now().Add(-time.Hour),
+			size:    3,
+			exp:     false,
+		},
+		{
+			name:    "Size changed",
+			store:   store,
+			key:     "foo.txt",
+			modTime: time.Now().Add(-time.Hour),
+			size:    2,
+			exp:     true,
+		},
+		{
+			name:    "Newer modification time",
+			store:   store,
+			key:     "foo.txt",
+			modTime: time.Now().Add(time.Hour),
+			size:    3,
+			exp:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := tt.store.CheckMod(context.TODO(), tt.key, tt.modTime, tt.size)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.exp, out)
+		})
+	}
+}
+
+func TestLocalFS_Scanner(t *testing.T) {
+	root := t.TempDir()
+	cfg := cloudsync.Config{
+		RootDirectory: "../testdata",
+		Cloud: cloudsync.CloudConfig{
+			LocalPath: root,
+		},
+		Scanner: cloudsync.ScannerConfig{
+			PartitionID:    "123",
+			DeepTraversing: true,
+		},
+	}
+	scanner := cloudsync.NewScanner(cfg)
+	require.NoError(t, scanner.Start(storage.NewLocalFS(cfg)))
+	require.NoError(t, scanner.Shutdown(context.TODO()))
+
+	for _, key := range []string{"config.yaml", "config.1.yaml", "foo/foo.yaml", "foo/bar.yaml"} {
+		exp, err := os.ReadFile(filepath.Join("../testdata", key))
+		require.NoError(t, err)
+		out, err := os.ReadFile(filepath.Join(root, "123", key))
+		require.NoError(t, err)
+		assert.Equal(t, exp, out)
+	}
+	_, err := os.Stat(filepath.Join(root, "123", ".gitkeep"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLocalFS_ScannerRestore(t *testing.T) {
+	source, remote, destination := t.TempDir(), t.TempDir(), t.TempDir()
+	modTime := time.Date(2023, 3, 10, 12, 0, 0, 123, time.UTC)
+	path := filepath.Join(source, "foo.txt")
+	require.NoError(t, os.WriteFile(path, []byte("foo"), 0644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	cfg := cloudsync.Config{
+		RootDirectory: source,
+		Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+		Scanner:       cloudsync.ScannerConfig{PartitionID: "123"},
+	}
+	store := storage.NewLocalFS(cfg)
+	require.NoError(t, cloudsync.NewScanner(cfg).Start(store))
+
+	// original modification times are restored instead of upload times
+	restoreCfg := cloudsync.RestoreConfig{PartitionID: "123", Destination: destination}
+	res, err := cloudsync.RestoreObjects(context.TODO(), store, restoreCfg)
+	require.NoError(t, err)
+	assert.Equal(t, cloudsync.RestoreResult{TotalObjects: 1, RestoredObjects: 1}, res)
+	info, err := os.Stat(filepath.Join(destination, "foo.txt"))
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()))
+
+	res, err = cloudsync.RestoreObjects(context.TODO(), store, restoreCfg)
+	require.NoError(t, err)
+	assert.Equal(t, cloudsync.RestoreResult{TotalObjects: 1, SkippedObjects: 1}, res)
+}
+
+func TestLocalFS_ScannerChecksum(t *testing.T) {
+	root, remote := t.TempDir(), t.TempDir()
+	path := filepath.Join(root, "foo.txt")
+	require.NoError(t, os.WriteFile(path, []byte("foo"), 0644))
+	cfg := cloudsync.Config{
+		RootDirectory: root,
+		Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+		Scanner:       cloudsync.ScannerConfig{ChangeDetection: cloudsync.ChangeDetectionChecksum},
+	}
+	store := storage.NewLocalFS(cfg)
+	scan := func() uint64 {
+		scanner := cloudsync.NewScanner(cfg)
+		require.NoError(t, scanner.Start(store))
+		require.NoError(t, scanner.Shutdown(context.TODO()))
+		return scanner.Stats().GetTotalUploadJobs()
+	}
+	assert.Equal(t, uint64(1), scan())
+	assert.Equal(t, uint64(0), scan())
+
+	// same size and older modification time (e.g. restored from an archive)
+	require.NoError(t, os.WriteFile(path, []byte("bar"), 0644))
+	modTime := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	assert.Equal(t, uint64(1), scan())
+	data, err := os.ReadFile(filepath.Join(remote, "foo.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(data))
+}
+
+// listKeys reads every object key from the given iterator.
+func listKeys(t *testing.T, it cloudsync.ObjectIterator) []string {
+	keys := make([]string, 0)
+	for {
+		obj, err := it.Next()
+		if errors.Is(err, cloudsync.ErrIteratorDone) {
+			return keys
+		}
+		require.NoError(t, err)
+		keys = append(keys, obj.Key)
+	}
+}
+
+// fileBuffer in-memory io.WriterAt implementation.
+type fileBuffer struct {
+	data []byte
+}
+
+func (f *fileBuffer) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+	return copy(f.data[off:], p), nil
+}
+
+func TestLocalFS_Capabilities(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: root}})
+	for _, key := range []string{"123/foo.txt", "123/bar/baz.txt", "1234/foo.txt", "456/foo.txt"} {
+		require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+			Key:  key,
+			Data: strings.NewReader(key),
+		}))
+	}
+
+	assert.ElementsMatch(t, []string{"123/foo.txt", "123/bar/baz.txt"}, listKeys(t, store.List(context.TODO(), "123/")))
+	assert.ElementsMatch(t, []string{"123/foo.txt", "123/bar/baz.txt", "1234/foo.txt"},
+		listKeys(t, store.List(context.TODO(), "123")))
+	assert.Empty(t, listKeys(t, store.List(context.TODO(), "789/")))
+
+	info, err := store.Stat(context.TODO(), "123/bar/baz.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "123/bar/baz.txt", info.Key)
+	assert.Equal(t, int64(15), info.Size)
+	assert.Equal(t, cloudsync.ChecksumSHA256, info.ChecksumAlgorithm)
+	assert.Equal(t, "cEwydJPK2oqeZgv8Klw6r+iOebHJeE1tDafMdSKOIJY=", info.Checksum)
+	_, err = store.Stat(context.TODO(), "123/bar")
+	assert.ErrorIs(t, err, cloudsync.ErrObjectNotFound)
+
+	buf := &fileBuffer{}
+	require.NoError(t, store.Download(context.TODO(), "123/bar/baz.txt", buf))
+	assert.Equal(t, "123/bar/baz.txt", string(buf.data))
+	assert.ErrorIs(t, store.Download(context.TODO(), "123/baz.txt", buf), cloudsync.ErrObjectNotFound)
+
+	require.NoError(t, store.Copy(context.TODO(), "123/bar/baz.txt", "123/.trash/bar/baz.txt"))
+	require.NoError(t, store.Download(context.TODO(), "123/.trash/bar/baz.txt", buf))
+	assert.Equal(t, "123/bar/baz.txt", string(buf.data))
+	assert.ErrorIs(t, store.Copy(context.TODO(), "123/baz.txt", "123/qux.txt"), cloudsync.ErrObjectNotFound)
+
+	require.NoError(t, store.Delete(context.TODO(), "123/foo.txt", "123/bar/baz.txt", "123/baz.txt",
+		"123/.trash/bar/baz.txt"))
+	assert.Empty(t, listKeys(t, store.List(context.TODO(), "123/")))
+}
+
+func TestLocalFS_Metadata(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: root}})
+	metadata := map[string]string{cloudsync.MetadataKeyChecksum: "foo"}
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:      "123/foo.txt",
+		Data:     strings.NewReader("foo"),
+		Metadata: metadata,
+	}))
+
+	info, err := store.Stat(context.TODO(), "123/foo.txt")
+	require.NoError(t, err)
+	assert.Equal(t, metadata, info.Metadata)
+	infos := make([]cloudsync.ObjectInfo, 0)
+	it := store.List(context.TODO(), "123/")
+	for info, err = it.Next(); err == nil; info, err = it.Next() {
+		infos = append(infos, info)
+	}
+	require.Len(t, infos, 1) // metadata files are not listed
+	assert.Equal(t, metadata, infos[0].Metadata)
+	require.NoError(t, store.Copy(context.TODO(), "123/foo.txt", "123/bar.txt"))
+	info, err = store.Stat(context.TODO(), "123/bar.txt")
+	require.NoError(t, err)
+	assert.Equal(t, metadata, info.Metadata)
+
+	// metadata is replaced on every upload
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{Key: "123/foo.txt", Data: strings.NewReader("foo")}))
+	info, err = store.Stat(context.TODO(), "123/foo.txt")
+	require.NoError(t, err)
+	assert.Empty(t, info.Metadata)
+
+	require.NoError(t, store.Delete(context.TODO(), "123/foo.txt", "123/bar.txt"))
+	entries, err := os.ReadDir(filepath.Join(root, "123"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLocalFS_Checksum(t *testing.T) {
+	root := t.TempDir()
+	store := storage.NewLocalFS(cloudsync.Config{Cloud: cloudsync.CloudConfig{LocalPath: root}})
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{Key: "123/foo.txt", Data: strings.NewReader("foo")}))
+	const fooChecksum = "LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564="
+
+	// checksums are calculated on upload, so objects are not read again on stat
+	require.NoError(t, os.WriteFile(filepath.Join(root, "123", "foo.txt"), []byte("bar"), 0644))
+	info, err := store.Stat(context.TODO(), "123/foo.txt")
+	require.NoError(t, err)
+	assert.Equal(t, fooChecksum, info.Checksum)
+	assert.Empty(t, info.Metadata)
+
+	// objects written without checksum are hashed
+	require.NoError(t, os.WriteFile(filepath.Join(root, "123", "bar.txt"), []byte("foo"), 0644))
+	info, err = store.Stat(context.TODO(), "123/bar.txt")
+	require.NoError(t, err)
+	assert.Equal(t, fooChecksum, info.Checksum)
+}
@@ -2,9 +2,21 @@ package storage
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -12,14 +24,26 @@ import (
 )
 
 // AmazonS3 Amazon Simple Storage Service (S3) concrete implementation of cloudsync.BlobStorage.
+//
+// Works with S3-compatible services as well (e.g. MinIO, Ceph, Wasabi or Cloudflare R2) if
+// cloudsync.CloudConfig Endpoint was specified.
 type AmazonS3 struct {
-	client   *s3.Client
-	bucket   *string
-	uploader *manager.Uploader
+	client            *s3.Client
+	bucket            *string
+	uploader          *manager.Uploader
+	downloader        *manager.Downloader
+	checksumAlgorithm types.ChecksumAlgorithm
 }
 
 // compile-time interface impl. validation.
-var _ cloudsync.BlobStorage = &AmazonS3{}
+var (
+	_ cloudsync.BlobStorage    = &AmazonS3{}
+	_ cloudsync.BlobDownloader = &AmazonS3{}
+	_ cloudsync.BlobLister     = &AmazonS3{}
+	_ cloudsync.BlobStater     = &AmazonS3{}
+	_ cloudsync.BlobDeleter    = &AmazonS3{}
+	_ cloudsync.BlobCopier     = &AmazonS3{}
+)
 
 // NewAmazonS3 allocates a new AmazonS3 instance ready to perform underlying S3 API actions using cloudsync.BlobStorage
 // API.
@@ -28,39 +52,305 @@ func NewAmazonS3(c *s3.Client, cfg cloudsync.Config) *AmazonS3 {
 		u.Concurrency = 10
 		u.PartSize = 10 * 1024 * 1024 // 10 MiB
 	})
-	return &AmazonS3{client: c, bucket: &cfg.Cloud.Bucket, uploader: uploader}
+	downloader := manager.NewDownloader(c, func(d *manager.Downloader) {
+		d.Concurrency = 10
+		d.PartSize = 10 * 1024 * 1024 // 10 MiB
+	})
+	checksumAlgorithm := types.ChecksumAlgorithmSha256
+	if cfg.Cloud.DisableChecksum {
+		checksumAlgorithm = "" // some S3-compatible services reject flexible checksums
+	}
+	return &AmazonS3{
+		client:            c,
+		bucket:            &cfg.Cloud.Bucket,
+		uploader:          uploader,
+		downloader:        downloader,
+		checksumAlgorithm: checksumAlgorithm,
+	}
+}
+
+// newAmazonS3Config loads AWS SDK configuration from cloudsync.CloudConfig and host's default sources
+// (e.g. environment variables, shared credentials file).
+//
+// If cloudsync.CloudConfig Endpoint was specified, the SDK will send all requests to it instead of AWS.
+func newAmazonS3Config(ctx context.Context, cfg cloudsync.CloudConfig) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(cfg.Region)}
+	if cfg.AccessKey != "" && cfg.SecretKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKey,
+			cfg.SecretKey, "")))
+	}
+	if cfg.Endpoint != "" {
+		opts = append(opts, config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(
+			func(_, region string, _ ...interface{}) (aws.Endpoint, error) {
+				return aws.Endpoint{
+					URL:               cfg.Endpoint,
+					SigningRegion:     region,
+					HostnameImmutable: cfg.UsePathStyle,
+					Source:            aws.EndpointSourceCustom,
+				}, nil
+			})))
+	}
+	if cfg.InsecureSkipVerify || cfg.CACertFile != "" {
+		tlsCfg, err := newTLSConfig(cfg)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		opts = append(opts, config.WithHTTPClient(awshttp.NewBuildableClient().
+			WithTransportOptions(func(tr *http.Transport) {
+				tr.TLSClientConfig = tlsCfg
+			})))
+	}
+	return config.LoadDefaultConfig(ctx, opts...)
+}
+
+// newTLSConfig allocates a TLS configuration trusting cloudsync.CloudConfig CACertFile certificates
+// (besides host's root certificates) or skipping server certificate verification.
+func newTLSConfig(cfg cloudsync.CloudConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CACertFile == "" {
+		return tlsCfg, nil
+	}
+
+	certs, err := os.ReadFile(cfg.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(certs) {
+		return nil, ErrInvalidCACert
+	}
+	tlsCfg.RootCAs = pool
+	return tlsCfg, nil
 }
 
+// Upload stores an object along its content type, Cache-Control directives and metadata. The original file
+// modification time (if any) is persisted as metadata as well (cloudsync.MetadataKeyModTime), as S3 always sets
+// LastModified to the upload time.
 func (a *AmazonS3) Upload(ctx context.Context, obj cloudsync.Object) error {
-	_, err := a.uploader.Upload(ctx, &s3.PutObjectInput{
+	metadata := obj.Metadata
+	if !obj.ModTime.IsZero() {
+		metadata = make(map[string]string, len(obj.Metadata)+1)
+		for k, v := range obj.Metadata {
+			metadata[k] = v
+		}
+		metadata[cloudsync.MetadataKeyModTime] = cloudsync.FormatModTime(obj.ModTime)
+	}
+	input := &s3.PutObjectInput{
 		Bucket:            a.bucket,
 		Key:               &obj.Key,
 		Body:              obj.Data,
-		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
-	})
+		ChecksumAlgorithm: a.checksumAlgorithm,
+		Metadata:          metadata,
+	}
+	if obj.ContentType != "" {
+		input.ContentType = &obj.ContentType
+	}
+	if obj.CacheControl != "" {
+		input.CacheControl = &obj.CacheControl
+	}
+	_, err := a.uploader.Upload(ctx, input)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// CheckMod compares modTime against the original file modification time persisted by AmazonS3.Upload, falling back
+// to the object LastModified time for objects uploaded without it.
 func (a *AmazonS3) CheckMod(ctx context.Context, key string, modTime time.Time, size int64) (bool, error) {
 	out, err := a.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket:            a.bucket,
-		Key:               &key,
-		IfUnmodifiedSince: &modTime,
+		Bucket: a.bucket,
+		Key:    &key,
 	})
 	if err == nil {
-		return out.ContentLength < size || out.LastModified.Before(modTime), nil
+		return out.ContentLength < size || amazonS3ModTime(out).Before(modTime), nil
 	}
 	switch {
 	case strings.HasSuffix(err.Error(), "api error NotFound: Not Found"):
 		return true, nil // if not found, then allow object writing
 	case strings.HasSuffix(err.Error(), "api error Forbidden: Forbidden"):
 		return false, cloudsync.ErrFatalStorage
-	case strings.HasSuffix(err.Error(), "api error PreconditionFailed: Precondition Failed"):
-		return false, nil // object exists, ignore error
 	default:
 		return false, err
 	}
 }
+
+func (a *AmazonS3) Download(ctx context.Context, key string, w io.WriterAt) error {
+	_, err := a.downloader.Download(ctx, w, &s3.GetObjectInput{
+		Bucket: a.bucket,
+		Key:    &key,
+	})
+	var noSuchKey *types.NoSuchKey
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &noSuchKey) || strings.HasSuffix(err.Error(), "api error NotFound: Not Found"):
+		return cloudsync.ErrObjectNotFound
+	case strings.HasSuffix(err.Error(), "api error Forbidden: Forbidden"):
+		return cloudsync.ErrFatalStorage
+	default:
+		return err
+	}
+}
+
+func (a *AmazonS3) List(ctx context.Context, prefix string) cloudsync.ObjectIterator {
+	return &amazonS3Iterator{
+		ctx: ctx,
+		paginator: s3.NewListObjectsV2Paginator(a.client, &s3.ListObjectsV2Input{
+			Bucket: a.bucket,
+			Prefix: &prefix,
+		}),
+	}
+}
+
+func (a *AmazonS3) Stat(ctx context.Context, key string) (cloudsync.ObjectInfo, error) {
+	out, err := a.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       a.bucket,
+		Key:          &key,
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	switch {
+	case err == nil:
+		info := cloudsync.ObjectInfo{
+			Key:      key,
+			Size:     out.ContentLength,
+			ModTime:  amazonS3ModTime(out),
+			Metadata: out.Metadata,
+		}
+		if out.ChecksumSHA256 != nil {
+			info.Checksum = *out.ChecksumSHA256
+			info.ChecksumAlgorithm = cloudsync.ChecksumSHA256
+		}
+		return info, nil
+	case strings.HasSuffix(err.Error(), "api error NotFound: Not Found"):
+		return cloudsync.ObjectInfo{}, cloudsync.ErrObjectNotFound
+	case strings.HasSuffix(err.Error(), "api error Forbidden: Forbidden"):
+		return cloudsync.ObjectInfo{}, cloudsync.ErrFatalStorage
+	default:
+		return cloudsync.ObjectInfo{}, err
+	}
+}
+
+// amazonS3ModTime retrieves the original file modification time of an object, or its LastModified time if it was
+// uploaded without it.
+func amazonS3ModTime(out *s3.HeadObjectOutput) time.Time {
+	if modTime, err := cloudsync.ParseModTime(out.Metadata[cloudsync.MetadataKeyModTime]); err == nil {
+		return modTime
+	} else if out.LastModified != nil {
+		return *out.LastModified
+	}
+	return time.Time{}
+}
+
+// amazonS3DeleteBatchSize maximum number of keys accepted by a single S3 DeleteObjects call.
+const amazonS3DeleteBatchSize = 1000
+
+func (a *AmazonS3) Delete(ctx context.Context, keys ...string) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > amazonS3DeleteBatchSize {
+			n = amazonS3DeleteBatchSize
+		}
+		objs := make([]types.ObjectIdentifier, 0, n)
+		for i := range keys[:n] {
+			objs = append(objs, types.ObjectIdentifier{Key: &keys[i]})
+		}
+		out, err := a.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: a.bucket,
+			Delete: &types.Delete{
+				Objects: objs,
+				Quiet:   true,
+			},
+		})
+		if err != nil {
+			return err
+		} else if len(out.Errors) > 0 {
+			return newAmazonS3DeleteError(out.Errors[0])
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// Copy duplicates an object using a server-side copy (objects up to 5 GiB).
+func (a *AmazonS3) Copy(ctx context.Context, srcKey, dstKey string) error {
+	segments := strings.Split(srcKey, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	source := url.PathEscape(*a.bucket) + "/" + strings.Join(segments, "/")
+	_, err := a.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     a.bucket,
+		Key:        &dstKey,
+		CopySource: &source,
+	})
+	var noSuchKey *types.NoSuchKey
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &noSuchKey) || strings.Contains(err.Error(), "api error NoSuchKey"):
+		return cloudsync.ErrObjectNotFound
+	case strings.HasSuffix(err.Error(), "api error Forbidden: Forbidden") ||
+		strings.Contains(err.Error(), "api error AccessDenied"):
+		return cloudsync.ErrFatalStorage
+	default:
+		return err
+	}
+}
+
+// newAmazonS3DeleteError converts a failed key deletion from an S3 DeleteObjects call into an error.
+func newAmazonS3DeleteError(err types.Error) error {
+	var key, code, msg string
+	if err.Key != nil {
+		key = *err.Key
+	}
+	if err.Code != nil {
+		code = *err.Code
+	}
+	if err.Message != nil {
+		msg = *err.Message
+	}
+	if code == "AccessDenied" {
+		return cloudsync.ErrFatalStorage
+	}
+	return fmt.Errorf("cloudsync: Could not delete object %s, %s: %s", key, code, msg)
+}
+
+// amazonS3Iterator cloudsync.ObjectIterator implementation fetching S3 object pages lazily.
+type amazonS3Iterator struct {
+	ctx       context.Context
+	paginator *s3.ListObjectsV2Paginator
+	page      []types.Object
+}
+
+var _ cloudsync.ObjectIterator = &amazonS3Iterator{}
+
+func (i *amazonS3Iterator) Next() (cloudsync.ObjectInfo, error) {
+	for len(i.page) == 0 {
+		if !i.paginator.HasMorePages() {
+			return cloudsync.ObjectInfo{}, cloudsync.ErrIteratorDone
+		}
+		out, err := i.paginator.NextPage(i.ctx)
+		if err != nil {
+			return cloudsync.ObjectInfo{}, err
+		}
+		i.page = out.Contents
+	}
+
+	obj := i.page[0]
+	i.page = i.page[1:]
+	info := cloudsync.ObjectInfo{Size: obj.Size}
+	if obj.Key != nil {
+		info.Key = *obj.Key
+	}
+	if obj.LastModified != nil {
+		info.ModTime = *obj.LastModified
+	}
+	return info, nil
+}
@@ -0,0 +1,193 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3Request minimal S3 request information received by a fake S3-compatible server.
+type fakeS3Request struct {
+	method            string
+	path              string
+	checksumAlgorithm string
+}
+
+func newFakeS3Server(t *testing.T) (*httptest.Server, func() []fakeS3Request) {
+	mu := sync.Mutex{}
+	reqs := make([]fakeS3Request, 0)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reqs = append(reqs, fakeS3Request{
+			method:            r.Method,
+			path:              r.URL.Path,
+			checksumAlgorithm: r.Header.Get("X-Amz-Sdk-Checksum-Algorithm"),
+		})
+		mu.Unlock()
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"foo"`)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []fakeS3Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return reqs
+	}
+}
+
+func TestNewBlobStorage_AmazonS3Compatible(t *testing.T) {
+	server, getRequests := newFakeS3Server(t)
+	store, err := storage.NewBlobStorage(cloudsync.Config{
+		Cloud: cloudsync.CloudConfig{
+			Region:             "us-east-1",
+			Bucket:             "ncorp-dev-cloudsync",
+			AccessKey:          "XXXX",
+			SecretKey:          "XXXX",
+			Endpoint:           server.URL,
+			UsePathStyle:       true,
+			InsecureSkipVerify: true,
+			DisableChecksum:    true,
+		},
+	}, storage.AmazonS3Str)
+	require.NoError(t, err)
+
+	wasMod, err := store.CheckMod(context.TODO(), "123/foo.txt", time.Now(), 3)
+	require.NoError(t, err)
+	assert.True(t, wasMod)
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:  "123/foo.txt",
+		Data: strings.NewReader("foo"),
+	}))
+
+	reqs := getRequests()
+	require.Len(t, reqs, 2)
+	assert.Equal(t, fakeS3Request{method: http.MethodHead, path: "/ncorp-dev-cloudsync/123/foo.txt"}, reqs[0])
+	assert.Equal(t, fakeS3Request{method: http.MethodPut, path: "/ncorp-dev-cloudsync/123/foo.txt"}, reqs[1])
+}
+
+func TestNewBlobStorage_AmazonS3InvalidCACert(t *testing.T) {
+	_, err := storage.NewBlobStorage(cloudsync.Config{
+		Cloud: cloudsync.CloudConfig{
+			Region:     "us-east-1",
+			Endpoint:   "https://localhost:9000",
+			CACertFile: "../testdata/config.yaml",
+		},
+	}, storage.AmazonS3Str)
+	assert.ErrorIs(t, err, storage.ErrInvalidCACert)
+}
+
+// newFakeS3ObjectServer starts a fake S3-compatible server storing object headers, so HEAD requests retrieve them.
+// Returned function retrieves the headers of an object using its request path.
+func newFakeS3ObjectServer(t *testing.T) (*httptest.Server, func(string) http.Header) {
+	mu := sync.Mutex{}
+	objects := make(map[string]http.Header)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			header := http.Header{}
+			for name, values := range r.Header {
+				if name == "Content-Type" || name == "Cache-Control" || strings.HasPrefix(name, "X-Amz-Meta-") {
+					header[name] = values
+				}
+			}
+			header.Set("Content-Length", strconv.Itoa(len(data)))
+			header.Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			objects[r.URL.Path] = header
+			w.Header().Set("ETag", `"foo"`)
+		case http.MethodHead:
+			header, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func(path string) http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return objects[path]
+	}
+}
+
+func TestAmazonS3_Metadata(t *testing.T) {
+	server, getHeader := newFakeS3ObjectServer(t)
+	store, err := storage.NewBlobStorage(cloudsync.Config{
+		Cloud: cloudsync.CloudConfig{
+			Region:             "us-east-1",
+			Bucket:             "ncorp-dev-cloudsync",
+			AccessKey:          "XXXX",
+			SecretKey:          "XXXX",
+			Endpoint:           server.URL,
+			UsePathStyle:       true,
+			InsecureSkipVerify: true,
+			DisableChecksum:    true,
+		},
+	}, storage.AmazonS3Str)
+	require.NoError(t, err)
+
+	modTime := time.Date(2023, 3, 10, 12, 0, 0, 123, time.UTC)
+	require.NoError(t, store.Upload(context.TODO(), cloudsync.Object{
+		Key:          "123/foo.json",
+		Data:         strings.NewReader("{}"),
+		Metadata:     map[string]string{cloudsync.MetadataKeyMode: "0644"},
+		ContentType:  "application/json",
+		CacheControl: "max-age=60",
+		ModTime:      modTime,
+	}))
+
+	header := getHeader("/ncorp-dev-cloudsync/123/foo.json")
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "max-age=60", header.Get("Cache-Control"))
+
+	info, err := store.(cloudsync.BlobStater).Stat(context.TODO(), "123/foo.json")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), info.Size)
+	assert.True(t, modTime.Equal(info.ModTime)) // original mtime instead of LastModified
+	assert.Equal(t, map[string]string{
+		cloudsync.MetadataKeyMode:    "0644",
+		cloudsync.MetadataKeyModTime: "2023-03-10T12:00:00.000000123Z",
+	}, info.Metadata)
+
+	tests := []struct {
+		name    string
+		modTime time.Time
+		size    int64
+		exp     bool
+	}{
+		{name: "Same mtime", modTime: modTime, size: 2},
+		{name: "Older mtime", modTime: modTime.Add(-time.Hour), size: 2},
+		{name: "Newer mtime", modTime: modTime.Add(time.Second), size: 2, exp: true},
+		{name: "Bigger size", modTime: modTime, size: 3, exp: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wasMod, errMod := store.CheckMod(context.TODO(), "123/foo.json", tt.modTime, tt.size)
+			require.NoError(t, errMod)
+			assert.Equal(t, tt.exp, wasMod)
+		})
+	}
+}
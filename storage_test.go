@@ -20,3 +20,30 @@ func TestNoopBlobStorage(t *testing.T) {
 	assert.Equal(t, "bar err", err.Error())
 	assert.True(t, b)
 }
+
+func TestNoopBlobStorage_Capabilities(t *testing.T) {
+	storage := cloudsync.NoopBlobStorage{
+		DownloadErr: errors.New("foo err"),
+		ListObjects: []cloudsync.ObjectInfo{{Key: "123/foo"}, {Key: "123/bar"}, {Key: "456/baz"}},
+		StatInfo:    cloudsync.ObjectInfo{Key: "foo", Size: 3},
+		StatErr:     errors.New("bar err"),
+		DeleteErr:   errors.New("baz err"),
+	}
+	assert.Equal(t, "foo err", storage.Download(nil, "", nil).Error())
+	info, err := storage.Stat(nil, "")
+	assert.Equal(t, "bar err", err.Error())
+	assert.Equal(t, cloudsync.ObjectInfo{Key: "foo", Size: 3}, info)
+	assert.Equal(t, "baz err", storage.Delete(nil).Error())
+
+	it := storage.List(nil, "123/")
+	keys := make([]string, 0)
+	for {
+		obj, errIt := it.Next()
+		if errIt != nil {
+			assert.ErrorIs(t, errIt, cloudsync.ErrIteratorDone)
+			break
+		}
+		keys = append(keys, obj.Key)
+	}
+	assert.Equal(t, []string{"123/foo", "123/bar"}, keys)
+}
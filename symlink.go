@@ -0,0 +1,176 @@
+package cloudsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SymlinkPolicy strategy used by Scanner to handle symbolic links found during traversal.
+type SymlinkPolicy string
+
+const (
+	// SymlinksSkip ignores symbolic links.
+	SymlinksSkip SymlinkPolicy = "skip"
+	// SymlinksFollow handles symbolic links as their targets: linked files are uploaded using the link path as key
+	// and linked directories are traversed. Links pointing to a directory being traversed (cycles) are skipped.
+	SymlinksFollow SymlinkPolicy = "follow"
+	// SymlinksStoreAsLink uploads symbolic links as objects holding the link target path, both as data and
+	// metadata (MetadataKeySymlink). Targets are never read.
+	SymlinksStoreAsLink SymlinkPolicy = "store-as-link"
+)
+
+// MetadataKeySymlink Object.Metadata key holding the target path of a symbolic link uploaded using
+// SymlinksStoreAsLink.
+const MetadataKeySymlink = "cloudsync_symlink"
+
+// ErrInvalidSymlinkPolicy the specified ScannerConfig.Symlinks policy is not supported.
+var ErrInvalidSymlinkPolicy = errors.New("cloudsync: Invalid symlink policy")
+
+func (p SymlinkPolicy) validate() error {
+	switch p {
+	case SymlinksSkip, SymlinksFollow, SymlinksStoreAsLink:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidSymlinkPolicy, p)
+	}
+}
+
+// symlinkInfo fs.FileInfo of a symbolic link uploaded using SymlinksStoreAsLink, reporting the length of the link
+// target path as size (as some platforms report zero).
+type symlinkInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i symlinkInfo) Size() int64 {
+	return i.size
+}
+
+// newSymlinkJob builds the job of a symbolic link uploaded using SymlinksStoreAsLink.
+func newSymlinkJob(path string, info fs.FileInfo) (fileJob, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return fileJob{}, err
+	}
+	return fileJob{
+		path:       path,
+		info:       symlinkInfo{FileInfo: info, size: int64(len(target))},
+		linkTarget: target,
+	}, nil
+}
+
+// scheduleLink handles a symbolic link found during traversal based on the source's SymlinkPolicy.
+//
+// Followed directories are traversed using the link path, so object keys of their files are built from it. chain
+// holds the real path of the source root and every directory followed to reach the link; links pointing to any of
+// them (or their parents) are skipped as they would create a cycle.
+func (s *Scanner) scheduleLink(ctx context.Context, src *scanSource, path string, onDir func(path string) error,
+	chain []string) error {
+	switch src.symlinks {
+	case SymlinksFollow:
+		info, err := os.Stat(path)
+		if err != nil {
+			s.sendLinkErr(src, path, err) // broken link
+			return nil
+		} else if !info.IsDir() {
+			if s.isFileSkipped(src, path) {
+				return nil
+			}
+			return s.scheduleFile(ctx, src, fileJob{path: path, info: info})
+		} else if s.isDirSkipped(src, path) {
+			return nil
+		}
+		realPath, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			s.sendLinkErr(src, path, err)
+			return nil
+		} else if isSymlinkCycle(realPath, chain) {
+			log.Warn().Str("path", path).Str("target", realPath).Msg("cloudsync: Skipped symbolic link cycle")
+			return nil
+		}
+		return s.walkDirectory(ctx, src, path, onDir, append(chain[:len(chain):len(chain)], realPath))
+	case SymlinksStoreAsLink:
+		if s.isFileSkipped(src, path) {
+			return nil
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			s.sendLinkErr(src, path, err)
+			return nil
+		}
+		job, err := newSymlinkJob(path, info)
+		if err != nil {
+			s.sendLinkErr(src, path, err)
+			return nil
+		}
+		return s.scheduleFile(ctx, src, job)
+	default:
+		log.Debug().Str("path", path).Msg("cloudsync: Skipped symbolic link")
+		return nil
+	}
+}
+
+// scheduleFailedLink schedules a failed job of a symbolic link (see Scanner.RetryFailed) based on the SymlinkPolicy
+// of its source, or ScannerConfig.Symlinks if none. The job is removed from the Journal if the link is skipped.
+func (s *Scanner) scheduleFailedLink(ctx context.Context, failed FailedJob, info fs.FileInfo) error {
+	src := s.sourceOf(failed.Path)
+	policy := s.cfg.Scanner.Symlinks
+	if src != nil {
+		policy = src.symlinks
+	}
+
+	job := fileJob{path: failed.Path, info: info}
+	var err error
+	switch policy {
+	case SymlinksFollow:
+		job.info, err = os.Stat(failed.Path)
+		if err == nil && job.info.IsDir() {
+			log.Warn().Str("path", failed.Path).Msg("cloudsync: Symbolic link points to a directory, skipping")
+			s.resolveFailedJob(failed.Key)
+			return nil
+		}
+	case SymlinksStoreAsLink:
+		job, err = newSymlinkJob(failed.Path, info)
+	default:
+		log.Warn().Str("path", failed.Path).Msg("cloudsync: Skipped symbolic link")
+		s.resolveFailedJob(failed.Key)
+		return nil
+	}
+	if err != nil {
+		s.objectUploadJobQueueErr <- ErrFileUpload{
+			Key:    failed.Key,
+			Path:   failed.Path,
+			Parent: err,
+		}
+		return nil
+	}
+	job.key, job.source = failed.Key, src
+	return s.scheduleJob(ctx, job)
+}
+
+// sendLinkErr reports a symbolic link which could not be read.
+func (s *Scanner) sendLinkErr(src *scanSource, path string, err error) {
+	s.objectUploadJobQueueErr <- ErrFileUpload{
+		Key:    src.failedObjectKey(path, nil),
+		Path:   path,
+		Parent: err,
+	}
+}
+
+// isSymlinkCycle verifies if a directory (real path) is any of the given directories or one of their parents.
+func isSymlinkCycle(realPath string, chain []string) bool {
+	for _, dir := range chain {
+		rel, err := filepath.Rel(realPath, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
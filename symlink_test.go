@@ -0,0 +1,155 @@
+package cloudsync_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_Symlinks(t *testing.T) {
+	tmp := t.TempDir()
+	root, outside := filepath.Join(tmp, "root"), filepath.Join(tmp, "outside")
+	for _, path := range []string{
+		filepath.Join(root, "a.txt"),
+		filepath.Join(root, "sub", "c.txt"),
+		filepath.Join(outside, "target.txt"),
+		filepath.Join(outside, "dir", "b.txt"),
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, []byte("foo"), 0644))
+	}
+	links := map[string]string{
+		filepath.Join(root, "link.txt"):        filepath.Join(outside, "target.txt"),
+		filepath.Join(root, "linkdir"):         filepath.Join(outside, "dir"),
+		filepath.Join(root, "sub", "loop"):     root,
+		filepath.Join(outside, "dir", "cycle"): filepath.Join(root, "linkdir"),
+		filepath.Join(root, "broken"):          filepath.Join(outside, "missing.txt"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("symbolic links are not supported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		policy    cloudsync.SymlinkPolicy
+		expKeys   []string
+		expFailed uint64
+	}{
+		{
+			name:    "Default",
+			expKeys: []string{"a.txt", "sub/c.txt"},
+		},
+		{
+			name:    "Skip",
+			policy:  cloudsync.SymlinksSkip,
+			expKeys: []string{"a.txt", "sub/c.txt"},
+		},
+		{
+			name:      "Follow",
+			policy:    cloudsync.SymlinksFollow,
+			expKeys:   []string{"a.txt", "link.txt", "linkdir/b.txt", "sub/c.txt"},
+			expFailed: 1, // broken link
+		},
+		{
+			name:    "Store as link",
+			policy:  cloudsync.SymlinksStoreAsLink,
+			expKeys: []string{"a.txt", "broken", "link.txt", "linkdir", "sub/c.txt", "sub/loop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := t.TempDir()
+			cfg := cloudsync.Config{
+				RootDirectory: root,
+				Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+				Scanner: cloudsync.ScannerConfig{
+					DeepTraversing: true,
+					Symlinks:       tt.policy,
+					Retry:          cloudsync.RetryPolicy{MaxAttempts: 1},
+				},
+			}
+			scanner := cloudsync.NewScanner(cfg)
+			require.NoError(t, scanner.Start(storage.NewLocalFS(cfg)))
+			assert.Equal(t, strings.Join(tt.expKeys, ","), strings.Join(listRemoteKeys(t, remote), ","))
+			assert.Equal(t, tt.expFailed, scanner.Stats().GetTotalFailedJobs())
+			if tt.policy == cloudsync.SymlinksStoreAsLink {
+				data, err := os.ReadFile(filepath.Join(remote, "link.txt"))
+				require.NoError(t, err)
+				assert.Equal(t, filepath.Join(outside, "target.txt"), string(data))
+			}
+		})
+	}
+}
+
+func TestScanner_SymlinkRoot(t *testing.T) {
+	tmp, remote := t.TempDir(), t.TempDir()
+	root := filepath.Join(tmp, "root")
+	require.NoError(t, os.MkdirAll(filepath.Join(tmp, "data"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "data", "a.txt"), []byte("foo"), 0644))
+	if err := os.Symlink(filepath.Join(tmp, "data"), root); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+
+	// source directories are always followed
+	cfg := cloudsync.Config{
+		RootDirectory: root,
+		Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+	}
+	require.NoError(t, cloudsync.NewScanner(cfg).Start(storage.NewLocalFS(cfg)))
+	assert.Equal(t, []string{"a.txt"}, listRemoteKeys(t, remote))
+}
+
+func TestScanner_InvalidSymlinkPolicy(t *testing.T) {
+	cfg := cloudsync.Config{
+		RootDirectory: "./testdata",
+		Scanner:       cloudsync.ScannerConfig{Symlinks: "copy"},
+	}
+	assert.ErrorIs(t, cloudsync.NewScanner(cfg).Start(cloudsync.NoopBlobStorage{}), cloudsync.ErrInvalidSymlinkPolicy)
+
+	cfg.Scanner.Symlinks = ""
+	cfg.Scanner.Sources = []cloudsync.SourceConfig{{Path: t.TempDir(), Symlinks: "copy"}}
+	assert.ErrorIs(t, cloudsync.NewScanner(cfg).Start(cloudsync.NoopBlobStorage{}), cloudsync.ErrInvalidSymlinkPolicy)
+}
+
+func TestScanner_MaxDepth(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "b/b.txt", "b/c/c.txt", "b/c/d/d.txt"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, []byte("foo"), 0644))
+	}
+	tests := []struct {
+		name           string
+		deepTraversing bool
+		maxDepth       int
+		expKeys        []string
+	}{
+		{name: "No deep traversing", maxDepth: 2, expKeys: []string{"a.txt"}},
+		{name: "Unlimited", deepTraversing: true, expKeys: []string{"a.txt", "b/b.txt", "b/c/c.txt", "b/c/d/d.txt"}},
+		{name: "One level", deepTraversing: true, maxDepth: 1, expKeys: []string{"a.txt", "b/b.txt"}},
+		{name: "Two levels", deepTraversing: true, maxDepth: 2, expKeys: []string{"a.txt", "b/b.txt", "b/c/c.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := t.TempDir()
+			cfg := cloudsync.Config{
+				RootDirectory: root,
+				Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+				Scanner: cloudsync.ScannerConfig{
+					DeepTraversing: tt.deepTraversing,
+					MaxDepth:       tt.maxDepth,
+				},
+			}
+			require.NoError(t, cloudsync.NewScanner(cfg).Start(storage.NewLocalFS(cfg)))
+			assert.Equal(t, tt.expKeys, listRemoteKeys(t, remote))
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package cloudsync
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultWatchDebounce time Scanner.Watch waits after the latest write to a file before scheduling it, if
+// ScannerConfig.WatchDebounce was not set.
+const DefaultWatchDebounce = time.Second
+
+// Watch bootstraps and runs internal processes to read files and schedule upload jobs (same as Start). Once every
+// file found was scheduled, it subscribes to file system events within every source (see Config.Sources),
+// scheduling files as they get written.
+//
+// Writes are debounced per file (see ScannerConfig.WatchDebounce), so files are scheduled once they stop changing.
+// Scheduled files still go through change detection, so only modified files are uploaded. Hidden-file, traversal
+// and ignore settings of each source are honored for new files and directories as well.
+//
+// Blocks until the given context is done or the Scanner gets shut down.
+func (s *Scanner) Watch(ctx context.Context, store BlobStorage) error {
+	if err := validateSources(s.cfg); err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	s.localKeys = nil // mirror mode is not supported while watching
+	err = s.run(ctx, store, func(ctx context.Context) error {
+		for _, src := range s.sources {
+			log.Info().
+				Str("root_directory", src.root).
+				Str("debounce", s.cfg.Scanner.WatchDebounce.String()).
+				Msg("Starting directory watch")
+			if errScan := s.scheduleDirectory(ctx, src, src.root, watcher.Add); errScan != nil {
+				return errScan
+			}
+		}
+		return s.scheduleFileEvents(ctx, watcher)
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil // stopped by caller
+	}
+	return err
+}
+
+// scheduleFileEvents schedules files written within watched directories once they stop changing. New
+// directories are traversed and watched as well.
+//
+// Blocks until the given context is done or the watcher gets closed.
+func (s *Scanner) scheduleFileEvents(ctx context.Context, watcher *fsnotify.Watcher) error {
+	debouncer := newFileDebouncer(s.cfg.Scanner.WatchDebounce)
+	defer debouncer.stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case path := <-debouncer.ready:
+			s.resolveTimeFilters(time.Now()) // relative bounds move along while watching
+			info, err := os.Lstat(path)
+			src := s.sourceOf(path)
+			switch {
+			case err != nil || info.IsDir() || src == nil:
+				continue // removed or replaced before being scheduled
+			case info.Mode()&fs.ModeSymlink != 0:
+				err = s.scheduleLink(ctx, src, path, watcher.Add, []string{src.realRoot})
+			default:
+				err = s.scheduleFile(ctx, src, fileJob{path: path, info: info})
+			}
+			if err != nil {
+				return err
+			}
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			} else if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			info, err := os.Lstat(event.Name)
+			src := s.sourceOf(event.Name)
+			switch {
+			case err != nil || src == nil:
+				continue
+			case info.IsDir() && event.Has(fsnotify.Create):
+				// files might be written into the new directory before it gets watched
+				err = s.scheduleDirectory(ctx, src, event.Name, watcher.Add)
+			case !info.IsDir() && info.Name() == IgnoreFile:
+				s.loadIgnoreFile(src, filepath.Dir(event.Name))
+				if !s.isFileSkipped(src, event.Name) {
+					debouncer.touch(event.Name)
+				}
+			case !info.IsDir() && !s.isFileSkipped(src, event.Name):
+				debouncer.touch(event.Name)
+			}
+			if err != nil && ctx.Err() != nil {
+				return ctx.Err()
+			} else if err != nil && s.cfg.Scanner.LogErrors {
+				log.Err(err).Str("path", event.Name).Msg("cloudsync: Could not watch directory")
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			} else if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// events were lost, traverse the whole tree again so no changes are missed
+				log.Warn().Msg("cloudsync: File system events overflowed, scanning directories again")
+				for _, src := range s.sources {
+					if err = s.scheduleDirectory(ctx, src, src.root, watcher.Add); err != nil {
+						break
+					}
+				}
+			}
+			if err != nil && ctx.Err() != nil {
+				return ctx.Err()
+			} else if err != nil && s.cfg.Scanner.LogErrors {
+				log.Err(err).Msg("cloudsync: Got file system watcher error")
+			}
+		}
+	}
+}
+
+// fileDebouncer delays file paths until no writes were received for a given interval. Paths are sent through
+// ready channel afterwards.
+type fileDebouncer struct {
+	interval time.Duration
+	ready    chan string
+	done     chan struct{}
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newFileDebouncer(interval time.Duration) *fileDebouncer {
+	return &fileDebouncer{
+		interval: interval,
+		ready:    make(chan string),
+		done:     make(chan struct{}),
+		timers:   make(map[string]*time.Timer),
+	}
+}
+
+// touch (re)starts the interval of a path.
+func (d *fileDebouncer) touch(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if timer, ok := d.timers[path]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d.interval, func() {
+		d.mu.Lock()
+		if d.timers[path] == timer {
+			delete(d.timers, path)
+		}
+		d.mu.Unlock()
+		select {
+		case d.ready <- path:
+		case <-d.done:
+		}
+	})
+	d.timers[path] = timer
+}
+
+// stop cancels every pending path.
+func (d *fileDebouncer) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	close(d.done)
+	for path, timer := range d.timers {
+		timer.Stop()
+		delete(d.timers, path)
+	}
+}
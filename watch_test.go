@@ -0,0 +1,68 @@
+package cloudsync_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neutrinocorp/cloudsync"
+	"github.com/neutrinocorp/cloudsync/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_Watch(t *testing.T) {
+	root, remote := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo.txt"), []byte("foo"), 0644))
+	cfg := cloudsync.Config{
+		RootDirectory: root,
+		Cloud:         cloudsync.CloudConfig{LocalPath: remote},
+		Scanner: cloudsync.ScannerConfig{
+			PartitionID:    "123",
+			DeepTraversing: true,
+			IgnoredKeys:    []string{"*.log"},
+			WatchDebounce:  time.Millisecond * 20,
+		},
+	}
+	scanner := cloudsync.NewScanner(cfg)
+	ctx, cancel := context.WithCancel(context.TODO())
+	errChan := make(chan error)
+	go func() {
+		errChan <- scanner.Watch(ctx, storage.NewLocalFS(cfg))
+	}()
+	assertUploaded := func(key, exp string) {
+		assert.Eventually(t, func() bool {
+			data, err := os.ReadFile(filepath.Join(remote, "123", filepath.FromSlash(key)))
+			return err == nil && string(data) == exp
+		}, time.Second*5, time.Millisecond*10, key)
+	}
+
+	assertUploaded("foo.txt", "foo")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "bar.txt"), []byte("bar"), 0644))
+	assertUploaded("bar.txt", "bar")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo.txt"), []byte("foo bar"), 0644))
+	assertUploaded("foo.txt", "foo bar")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "baz", "qux"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "baz", "qux", "baz.txt"), []byte("baz"), 0644))
+	assertUploaded("baz/qux/baz.txt", "baz")
+	require.NoError(t, os.WriteFile(filepath.Join(root, "baz", "qux", "baz.log"), []byte("baz"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".baz.txt"), []byte("baz"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".qux"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".qux", "qux.txt"), []byte("qux"), 0644))
+	time.Sleep(cfg.Scanner.WatchDebounce * 5)
+
+	cancel()
+	select {
+	case err := <-errChan:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		t.Fatal("TestScanner_Watch: timeout reached")
+	}
+	for _, key := range []string{"baz/qux/baz.log", ".baz.txt", ".qux/qux.txt"} {
+		_, err := os.Stat(filepath.Join(remote, "123", filepath.FromSlash(key)))
+		assert.ErrorIs(t, err, os.ErrNotExist, key)
+	}
+	assert.Equal(t, uint64(0), scanner.Stats().GetTotalFailedJobs())
+}
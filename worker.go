@@ -2,74 +2,252 @@ package cloudsync
 
 import (
 	"context"
-	"sync"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"path/filepath"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
-// ShutdownUploadWorkers closes internal job queues and stores new configuration variables (if required).
-func ShutdownUploadWorkers(ctx context.Context, wg *sync.WaitGroup) {
-	wg.Add(1)
-	select {
-	case <-ctx.Done():
-		log.Debug().Msg("cloudsync: Shutting down workers")
-		if objectUploadJobQueue != nil {
-			close(objectUploadJobQueue)
-			objectUploadJobQueue = nil
+const (
+	// DefaultMaxConcurrentUploads number of upload workers used if ScannerConfig.MaxConcurrentUploads was not set.
+	DefaultMaxConcurrentUploads = 8
+	// DefaultMaxConcurrentChecks number of check workers used if ScannerConfig.MaxConcurrentChecks was not set.
+	DefaultMaxConcurrentChecks = 32
+)
+
+// listenAndExecuteCheckJobs waits and executes file modification check jobs received from Scanner queues. Modified
+// files are scheduled as object upload jobs. Failed checks are retried based on ScannerConfig.Retry. Non-recovery
+// errors (ErrFatalStorage) stop the whole Scanner execution instead.
+//
+// Jobs received once the given context is done are discarded. A single call runs a single worker. Will break
+// listening loop once the file check queue is closed.
+func (s *Scanner) listenAndExecuteCheckJobs(ctx context.Context, storage BlobStorage) {
+	for job := range s.fileCheckJobQueue {
+		if ctx.Err() != nil || s.isSynced(job) {
+			continue
+		}
+		var reason ChangeReason
+		attempts, err := s.retry(ctx, job.key, func() (errCheck error) {
+			reason, errCheck = s.detectChange(ctx, storage, &job)
+			return errCheck
+		})
+		if errors.Is(err, ErrFatalStorage) {
+			s.abort(err)
+		}
+		if err != nil {
+			s.objectUploadJobQueueErr <- ErrFileUpload{
+				Key:      job.key,
+				Path:     job.path,
+				Attempts: attempts,
+				Parent:   err,
+			}
+			continue
+		} else if reason == "" {
+			s.saveIndexEntry(job, "", nil)
+			s.resolveFailedJob(job.key)
+			continue
 		}
-		if objectUploadJobQueueErr != nil {
-			close(objectUploadJobQueueErr)
-			objectUploadJobQueueErr = nil
+		job.reason = reason
+		s.stats.increaseUploadJobs()
+		s.stats.addUploadBytes(job.info.Size())
+		if job.source != nil {
+			job.source.stats.increaseTotalUploadJobs()
+			job.source.stats.addUploadBytes(job.info.Size())
 		}
-		wg.Done()
+		if s.cfg.Scanner.DryRun {
+			s.stats.decreaseUploadJobs()
+			log.Info().
+				Str("object_key", job.key).
+				Str("reason", string(reason)).
+				Int64("size", job.info.Size()).
+				Msg("cloudsync: Would upload file")
+			continue
+		}
+		s.objectUploadJobQueue <- job
 	}
 }
 
-// ListenAndExecuteUploadJobs waits and executes object upload jobs asynchronously received from internal queues.
+// listenAndExecuteUploadJobs waits and executes object upload jobs received from Scanner queues. Files are
+// opened right before being uploaded and closed right after.
 //
-// Will break listening loop if context was cancelled.
-func ListenAndExecuteUploadJobs(ctx context.Context, storage BlobStorage, wg *sync.WaitGroup) {
-	for job := range objectUploadJobQueue {
-		go func(startTime time.Time, obj Object) {
-			defer wg.Done()
-			if obj.CleanupFunc != nil {
-				defer obj.CleanupFunc()
-			}
-			log.Info().
-				Str("object_key", obj.Key).
-				Msg("cloudsync: Uploading file")
-			err := storage.Upload(ctx, obj)
-			DefaultStats.decreaseUploadJobs()
-			if err != nil && objectUploadJobQueueErr != nil {
-				objectUploadJobQueueErr <- ErrFileUpload{
-					Key:    obj.Key,
-					Parent: err,
-				}
-				return
+// Failed uploads are retried based on ScannerConfig.Retry. Non-recovery errors (ErrFatalStorage) stop the whole
+// Scanner execution instead.
+//
+// Jobs received once the given context is done are discarded. A single call runs a single worker. Will break
+// listening loop once the object upload queue is closed.
+func (s *Scanner) listenAndExecuteUploadJobs(ctx context.Context, storage BlobStorage) {
+	for job := range s.objectUploadJobQueue {
+		if ctx.Err() != nil {
+			s.stats.decreaseUploadJobs()
+			continue
+		}
+		startTime := time.Now()
+		var checksum string
+		attempts, err := s.retry(ctx, job.key, func() (errUpload error) {
+			checksum, errUpload = executeUploadJob(ctx, storage, job, s.cfg.Scanner.CacheControl,
+				s.cfg.Scanner.ChangeDetection.usesChecksums())
+			return errUpload
+		})
+		s.stats.decreaseUploadJobs()
+		s.saveIndexEntry(job, checksum, err)
+		if errors.Is(err, ErrFatalStorage) {
+			s.abort(err)
+		}
+		if err != nil {
+			s.objectUploadJobQueueErr <- ErrFileUpload{
+				Key:      job.key,
+				Path:     job.path,
+				Attempts: attempts,
+				Parent:   err,
 			}
-			log.Info().
-				Str("took", time.Since(startTime).String()).
-				Str("object_key", obj.Key).
-				Uint64("total_upload_jobs", DefaultStats.GetTotalUploadJobs()).
-				Uint64("jobs_left", DefaultStats.GetCurrentUploadJobs()).
-				Msg("cloudsync: Uploaded file")
-		}(time.Now(), job)
+			continue
+		}
+		s.resolveFailedJob(job.key)
+		log.Info().
+			Str("took", time.Since(startTime).String()).
+			Str("object_key", job.key).
+			Uint64("total_upload_jobs", s.stats.GetTotalUploadJobs()).
+			Uint64("jobs_left", s.stats.GetCurrentUploadJobs()).
+			Msg("cloudsync: Uploaded file")
+	}
+}
+
+// executeUploadJob opens and uploads a file to the given BlobStorage, along its metadata (see fileMetadata), content
+// type, modification time and the given Cache-Control directives. Returns the base64-encoded SHA-256 checksum of the
+// uploaded file, empty if it was not calculated.
+//
+// The checksum is only stored (MetadataKeyChecksum) if withChecksum is set (e.g. checksum change detection compares
+// against it) or if it was already calculated while building the object key or detecting changes. As metadata is sent
+// along the object data, missing digests are calculated from the opened file right before the upload starts. Files
+// are otherwise read by the upload only.
+func executeUploadJob(ctx context.Context, storage BlobStorage, job fileJob, cacheControl string,
+	withChecksum bool) (string, error) {
+	data, closeData, err := job.open()
+	if err != nil {
+		return "", err
+	}
+	defer closeData()
+
+	checksum := ""
+	if job.digest == nil && withChecksum {
+		h := sha256.New()
+		if _, err = io.Copy(h, data); err != nil {
+			return "", err
+		} else if _, err = data.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		job.digest = h.Sum(nil)
+	}
+	if job.digest != nil {
+		checksum = base64.StdEncoding.EncodeToString(job.digest)
 	}
+
+	log.Info().
+		Str("object_key", job.key).
+		Str("reason", string(job.reason)).
+		Msg("cloudsync: Uploading file")
+	err = storage.Upload(ctx, Object{
+		Key:          job.key,
+		Data:         data,
+		Metadata:     fileMetadata(job, checksum),
+		ContentType:  detectContentType(job, data),
+		CacheControl: cacheControl,
+		ModTime:      job.info.ModTime(),
+	})
+	return checksum, err
 }
 
-// ListenUploadErrors waits and performs actions when object upload jobs fail. These errors are sent asynchronously
-// through an internal error queue as all internal jobs are scheduled the same way.
+// isSynced verifies if a file is unchanged since its latest synchronization using the local state index.
 //
-// Will break listening loop if context was cancelled.
-func ListenUploadErrors(cfg Config) {
-	for err := range objectUploadJobQueueErr {
-		if cfg.Scanner.LogErrors {
+// Always returns false if no Index was set or if ScannerConfig.ForceReconcile was set as true.
+func (s *Scanner) isSynced(job fileJob) bool {
+	if s.index == nil || s.cfg.Scanner.ForceReconcile {
+		return false
+	}
+	entry, err := s.index.Get(job.key)
+	if err != nil && !errors.Is(err, ErrIndexEntryNotFound) && s.cfg.Scanner.LogErrors {
+		log.Err(err).Str("object_key", job.key).Msg("cloudsync: Could not read local index")
+	}
+	return err == nil && entry.IsSynced(job.info.ModTime(), job.info.Size())
+}
+
+// saveIndexEntry records a file synchronization result into the local state index (if any).
+//
+// Dry runs never update the index.
+func (s *Scanner) saveIndexEntry(job fileJob, checksum string, syncErr error) {
+	if s.index == nil || s.cfg.Scanner.DryRun {
+		return
+	}
+	entry := IndexEntry{
+		Key:      job.key,
+		Size:     job.info.Size(),
+		ModTime:  job.info.ModTime(),
+		Checksum: checksum,
+		SyncedAt: time.Now().UTC(),
+	}
+	if syncErr != nil {
+		entry.LastError = syncErr.Error()
+	}
+	if err := s.index.Put(entry); err != nil && s.cfg.Scanner.LogErrors {
+		log.Err(err).Str("object_key", job.key).Msg("cloudsync: Could not update local index")
+	}
+}
+
+// listenUploadErrors waits and performs actions when object upload jobs fail. These errors are sent asynchronously
+// through the Scanner error queue as all internal jobs are scheduled the same way.
+//
+// Failed jobs are recorded into the Journal (if any), unless they were stopped by a context cancellation.
+//
+// Will break listening loop once the error queue is closed.
+func (s *Scanner) listenUploadErrors() {
+	for err := range s.objectUploadJobQueueErr {
+		if s.cfg.Scanner.LogErrors {
 			log.
 				Err(err).
 				Str("parent", err.Parent.Error()).
 				Msg("cloudsync: File upload failed")
 		}
-		DefaultStats.increaseFailedJobs()
+		s.stats.increaseFailedJobs()
+		if stats := s.sourceStats(err.Path); err.Path != "" && stats != nil {
+			stats.increaseFailedJobs()
+		}
+		s.recordFailedJob(err)
+	}
+}
+
+// recordFailedJob stores a failed job into the Journal (if any). Errors without a local file path are skipped as
+// they could not be retried.
+func (s *Scanner) recordFailedJob(errUpload ErrFileUpload) {
+	if s.journal == nil || s.cfg.Scanner.DryRun || errUpload.Path == "" ||
+		errors.Is(errUpload.Parent, context.Canceled) {
+		return
+	}
+	path, err := filepath.Abs(errUpload.Path)
+	if err != nil {
+		path = errUpload.Path
+	}
+	err = s.journal.Record(FailedJob{
+		Key:      errUpload.Key,
+		Path:     path,
+		Error:    errUpload.Parent.Error(),
+		Attempts: errUpload.Attempts,
+		FailedAt: time.Now().UTC(),
+	})
+	if err != nil && s.cfg.Scanner.LogErrors {
+		log.Err(err).Str("object_key", errUpload.Key).Msg("cloudsync: Could not update failed jobs journal")
+	}
+}
+
+// resolveFailedJob removes a job from the Journal (if any) once it succeeded.
+func (s *Scanner) resolveFailedJob(key string) {
+	if s.journal == nil || s.cfg.Scanner.DryRun {
+		return
+	}
+	if err := s.journal.Resolve(key); err != nil && s.cfg.Scanner.LogErrors {
+		log.Err(err).Str("object_key", key).Msg("cloudsync: Could not update failed jobs journal")
 	}
 }
@@ -1,85 +1,198 @@
 package cloudsync
 
 import (
-	"bytes"
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"runtime"
-	"sync"
+	"strconv"
 	"testing"
 	"time"
 
-	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func testShutdownUploadWorkers(t *testing.T) {
-	wg := sync.WaitGroup{}
-	initRoutines := runtime.NumGoroutine()
-	go ListenUploadErrors(Config{Scanner: ScannerConfig{LogErrors: false}})
-	require.Equal(t, initRoutines+1, runtime.NumGoroutine())
-
-	objectUploadJobQueueErr <- ErrFileUpload{
+func TestScanner_ListenUploadErrors(t *testing.T) {
+	scanner := newTestScanner(Config{Scanner: ScannerConfig{LogErrors: true}})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner.listenUploadErrors()
+	}()
+	scanner.objectUploadJobQueueErr <- ErrFileUpload{
 		Key:    "",
-		Parent: errors.New("testShutdownUploadWorkers: foo error"),
+		Parent: errors.New("TestScanner_ListenUploadErrors: foo error"),
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
-	defer cancel()
-	ShutdownUploadWorkers(ctx, &wg)
-	wg.Wait()
-	runtime.Gosched()
-	runtime.GC()
-	time.Sleep(time.Millisecond)
-	require.Equal(t, initRoutines, runtime.NumGoroutine())
-}
-
-func testListenUploadErrors(t *testing.T) {
-	initRoutines := runtime.NumGoroutine()
-	go ListenUploadErrors(Config{Scanner: ScannerConfig{LogErrors: true}})
-	objectUploadJobQueueErr <- ErrFileUpload{
+	scanner.objectUploadJobQueueErr <- ErrFileUpload{
 		Key:    "",
-		Parent: errors.New("testListenUploadErrors: foo error"),
+		Parent: errors.New("TestScanner_ListenUploadErrors: bar error"),
 	}
-	require.Equal(t, initRoutines+1, runtime.NumGoroutine())
-	close(objectUploadJobQueueErr)
-	objectUploadJobQueueErr = nil
-	runtime.Gosched()
-	runtime.GC()
-	time.Sleep(time.Millisecond)
-	require.Equal(t, initRoutines, runtime.NumGoroutine())
+	close(scanner.objectUploadJobQueueErr)
+	<-done
+	assert.Equal(t, uint64(2), scanner.Stats().GetTotalFailedJobs())
 }
 
-func testListenUpload(t *testing.T) {
-	wg := sync.WaitGroup{}
-	wg.Add(2)
-	initRoutines := runtime.NumGoroutine()
+func TestScanner_ListenUpload(t *testing.T) {
+	info, err := os.Stat("./testdata/config.yaml")
+	require.NoError(t, err)
+	scanner := newTestScanner(Config{Scanner: ScannerConfig{Retry: RetryPolicy{BaseBackoff: time.Millisecond}}})
 	storage := &NoopBlobStorage{UploadErr: nil}
-	go ListenUploadErrors(Config{})
-	go ListenAndExecuteUploadJobs(context.TODO(), storage, &wg)
-	objectUploadJobQueue <- Object{
-		Key:  "foo",
-		Data: bytes.NewReader([]byte("foo")),
-		CleanupFunc: func() error {
-			log.Debug().Msg("testListenUpload: cleaning up")
-			return nil
-		},
+	errDone, workerDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(errDone)
+		scanner.listenUploadErrors()
+	}()
+	go func() {
+		defer close(workerDone)
+		scanner.listenAndExecuteUploadJobs(context.TODO(), storage)
+	}()
+	scanner.stats.increaseUploadJobs()
+	scanner.objectUploadJobQueue <- fileJob{
+		path: "./testdata/config.yaml",
+		key:  "foo",
+		info: info,
+	}
+	scanner.stats.increaseUploadJobs()
+	scanner.objectUploadJobQueue <- fileJob{ // file not found
+		path: "./testdata/baz.yaml",
+		key:  "baz",
+		info: info,
 	}
-	time.Sleep(time.Millisecond)
 	storage.UploadErr = errors.New("bar error")
-	objectUploadJobQueue <- Object{
-		Key:         "bar",
-		Data:        bytes.NewReader([]byte("bar")),
-		CleanupFunc: nil,
+	scanner.stats.increaseUploadJobs()
+	scanner.objectUploadJobQueue <- fileJob{
+		path: "./testdata/config.yaml",
+		key:  "bar",
+		info: info,
+	}
+	close(scanner.objectUploadJobQueue)
+	<-workerDone
+	close(scanner.objectUploadJobQueueErr)
+	<-errDone
+	assert.Equal(t, uint64(3), scanner.Stats().GetTotalUploadJobs())
+	assert.Equal(t, uint64(0), scanner.Stats().GetCurrentUploadJobs())
+	assert.Equal(t, uint64(2), scanner.Stats().GetTotalFailedJobs())
+}
+
+func TestScanner_ListenCheck(t *testing.T) {
+	info, err := os.Stat("./testdata/config.yaml")
+	require.NoError(t, err)
+	scanner := newTestScanner(Config{Scanner: ScannerConfig{Retry: RetryPolicy{BaseBackoff: time.Millisecond}}})
+	storage := &NoopBlobStorage{CheckModBool: true}
+	errDone, workerDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(errDone)
+		scanner.listenUploadErrors()
+	}()
+	go func() {
+		defer close(workerDone)
+		scanner.listenAndExecuteCheckJobs(context.TODO(), storage)
+	}()
+	scanner.fileCheckJobQueue <- fileJob{
+		path: "./testdata/config.yaml",
+		key:  "foo",
+		info: info,
+	}
+	job := <-scanner.objectUploadJobQueue
+	require.Equal(t, "foo", job.key)
+
+	storage.CheckModBool = false
+	storage.CheckModErr = errors.New("bar error")
+	scanner.fileCheckJobQueue <- fileJob{
+		path: "./testdata/config.yaml",
+		key:  "bar",
+		info: info,
 	}
-	require.Equal(t, initRoutines+2, runtime.NumGoroutine())
-	wg.Wait()
-	close(objectUploadJobQueue)
-	objectUploadJobQueue = nil
-	close(objectUploadJobQueueErr)
-	objectUploadJobQueueErr = nil
-	runtime.Gosched()
-	runtime.GC()
-	time.Sleep(time.Millisecond)
-	require.Equal(t, initRoutines, runtime.NumGoroutine())
+	close(scanner.fileCheckJobQueue)
+	<-workerDone
+	close(scanner.objectUploadJobQueueErr)
+	<-errDone
+	assert.Equal(t, uint64(1), scanner.Stats().GetCurrentUploadJobs())
+	assert.Equal(t, uint64(1), scanner.Stats().GetTotalFailedJobs())
+}
+
+// objectBlobStorage BlobStorage implementation keeping the latest uploaded Object (without its data).
+type objectBlobStorage struct {
+	NoopBlobStorage
+	obj Object
+}
+
+func (o *objectBlobStorage) Upload(_ context.Context, obj Object) error {
+	obj.Data = nil
+	o.obj = obj
+	return nil
+}
+
+func TestExecuteUploadJob(t *testing.T) {
+	root := t.TempDir()
+	modTime := time.Date(2023, 3, 10, 12, 0, 0, 123, time.UTC)
+	tests := []struct {
+		name       string
+		file       string
+		data       string
+		linkTarget string
+		exp        string
+	}{
+		{name: "Extension", file: "data.json", data: "{}", exp: "application/json"},
+		{name: "Sniffed text", file: "NOTES", data: "foo", exp: "text/plain; charset=utf-8"},
+		{name: "Sniffed image", file: "image", data: "\x89PNG\r\n\x1a\n", exp: "image/png"},
+		{name: "Symlink", file: "link.json", linkTarget: "data.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(root, tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0640))
+			require.NoError(t, os.Chmod(path, 0640)) // ignore umask
+			require.NoError(t, os.Chtimes(path, modTime, modTime))
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+
+			store := &objectBlobStorage{}
+			_, err = executeUploadJob(context.TODO(), store, fileJob{
+				path:       path,
+				key:        "123/" + tt.file,
+				info:       info,
+				linkTarget: tt.linkTarget,
+			}, "max-age=60", true)
+			require.NoError(t, err)
+			assert.Equal(t, "123/"+tt.file, store.obj.Key)
+			assert.Equal(t, tt.exp, store.obj.ContentType)
+			assert.Equal(t, "max-age=60", store.obj.CacheControl)
+			assert.True(t, modTime.Equal(store.obj.ModTime))
+			assert.Equal(t, FormatModTime(modTime), store.obj.Metadata[MetadataKeyModTime])
+			assert.Equal(t, "0640", store.obj.Metadata[MetadataKeyMode])
+			assert.NotEmpty(t, store.obj.Metadata[MetadataKeyChecksum])
+			if runtime.GOOS != "windows" {
+				assert.Equal(t, strconv.Itoa(os.Getuid()), store.obj.Metadata[MetadataKeyUID])
+			}
+		})
+	}
+}
+
+func TestExecuteUploadJob_Digest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "foo.txt")
+	require.NoError(t, os.WriteFile(path, []byte("foo"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// digests calculated while building keys or detecting changes are not calculated again
+	store := &objectBlobStorage{}
+	job := fileJob{path: path, key: "foo.txt", info: info, digest: []byte("bar")}
+	checksum, err := executeUploadJob(context.TODO(), store, job, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "YmFy", checksum)
+	assert.Equal(t, "YmFy", store.obj.Metadata[MetadataKeyChecksum])
+
+	// files are only hashed if checksums are required
+	job.digest = nil
+	checksum, err = executeUploadJob(context.TODO(), store, job, "", false)
+	require.NoError(t, err)
+	assert.Empty(t, checksum)
+	assert.NotContains(t, store.obj.Metadata, MetadataKeyChecksum)
+	checksum, err = executeUploadJob(context.TODO(), store, job, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, "LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=", checksum)
+	assert.Equal(t, checksum, store.obj.Metadata[MetadataKeyChecksum])
 }